@@ -1,3 +1,3 @@
 module github.com/gotrino/fusion
 
-go 1.18
+go 1.21
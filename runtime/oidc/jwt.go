@@ -0,0 +1,318 @@
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// leeway tolerates clock differences between the client and the identity provider.
+const leeway = time.Minute
+
+// refetchInterval limits how often a key set is fetched because of unknown key ids, so that tokens with
+// arbitrary key ids cannot flood the identity provider.
+const refetchInterval = time.Minute
+
+var keySets = map[string]*keySet{}
+var keySetsLock sync.Mutex
+
+// keySet caches the public keys of a jwks_uri.
+type keySet struct {
+	keys    map[string]signingKey
+	fetched time.Time // fetched is the time of the last attempt
+}
+
+// signingKey is a public key of a key set.
+type signingKey struct {
+	pub any
+	alg string // alg is the only algorithm the key has been published for. Empty allows any of its type.
+}
+
+// key returns the key with the id. A single key without id is used for all tokens.
+func (s *keySet) key(kid string) (signingKey, bool) {
+	if key, ok := s.keys[kid]; ok {
+		return key, true
+	}
+
+	if len(s.keys) == 1 && kid == "" {
+		for _, key := range s.keys {
+			return key, true
+		}
+	}
+
+	return signingKey{}, false
+}
+
+// JWK is a public key of a json web key set.
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg,omitempty"`
+	Use string `json:"use,omitempty"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+// JWKS is a json web key set, as served by the jwks_uri of a Provider.
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// verify checks the signature and the claims of the ID token and returns its claims.
+func verify(ctx context.Context, client *http.Client, p Provider, clientID, token, nonce string) (Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("oidc: malformed id token")
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, err
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("oidc: malformed id token signature: %w", err)
+	}
+
+	key, err := publicKey(ctx, client, p.JWKSURI, header.Kid)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := verifySignature(header.Alg, key, []byte(parts[0]+"."+parts[1]), sig); err != nil {
+		return nil, err
+	}
+
+	var claims Claims
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, err
+	}
+
+	if strings.TrimSuffix(claims.String("iss"), "/") != strings.TrimSuffix(p.Issuer, "/") {
+		return nil, fmt.Errorf("oidc: unexpected issuer %s", claims.String("iss"))
+	}
+
+	if !audience(claims["aud"], clientID) {
+		return nil, fmt.Errorf("oidc: id token is not issued for %s", clientID)
+	}
+
+	exp, ok := claims["exp"].(float64)
+	if !ok || time.Unix(int64(exp), 0).Add(leeway).Before(time.Now()) {
+		return nil, fmt.Errorf("oidc: id token has expired")
+	}
+
+	if nonce != "" && claims.String("nonce") != nonce {
+		return nil, fmt.Errorf("oidc: nonce mismatch")
+	}
+
+	return claims, nil
+}
+
+func audience(aud any, clientID string) bool {
+	switch aud := aud.(type) {
+	case string:
+		return aud == clientID
+	case []any:
+		for _, a := range aud {
+			if a == clientID {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// verifySignature checks the signature with the key, which must have been published for the algorithm. An EC key
+// must also use the curve of the algorithm.
+func verifySignature(alg string, key signingKey, signed, sig []byte) error {
+	if key.alg != "" && key.alg != alg {
+		return fmt.Errorf("oidc: key is published for %s, not %s", key.alg, alg)
+	}
+
+	switch alg {
+	case "RS256", "RS384", "RS512":
+		pub, ok := key.pub.(*rsa.PublicKey)
+		if !ok {
+			return fmt.Errorf("oidc: key does not match %s", alg)
+		}
+
+		h, sum := digest(alg, signed)
+		if err := rsa.VerifyPKCS1v15(pub, h, sum, sig); err != nil {
+			return fmt.Errorf("oidc: invalid id token signature: %w", err)
+		}
+
+		return nil
+	case "ES256", "ES384", "ES512":
+		pub, ok := key.pub.(*ecdsa.PublicKey)
+		if !ok || pub.Curve != curves[alg] {
+			return fmt.Errorf("oidc: key does not match %s", alg)
+		}
+
+		size := (pub.Curve.Params().BitSize + 7) / 8
+		if len(sig) != 2*size {
+			return fmt.Errorf("oidc: invalid id token signature length %d", len(sig))
+		}
+
+		_, sum := digest(alg, signed)
+		r, s := new(big.Int).SetBytes(sig[:size]), new(big.Int).SetBytes(sig[size:])
+		if !ecdsa.Verify(pub, sum, r, s) {
+			return fmt.Errorf("oidc: invalid id token signature")
+		}
+
+		return nil
+	default:
+		return fmt.Errorf("oidc: unsupported id token algorithm %q", alg)
+	}
+}
+
+// curves are the curves of the ECDSA algorithms.
+var curves = map[string]elliptic.Curve{"ES256": elliptic.P256(), "ES384": elliptic.P384(), "ES512": elliptic.P521()}
+
+func digest(alg string, signed []byte) (crypto.Hash, []byte) {
+	switch alg[2:] {
+	case "384":
+		sum := sha512.Sum384(signed)
+		return crypto.SHA384, sum[:]
+	case "512":
+		sum := sha512.Sum512(signed)
+		return crypto.SHA512, sum[:]
+	default:
+		sum := sha256.Sum256(signed)
+		return crypto.SHA256, sum[:]
+	}
+}
+
+// publicKey returns the key of the set. The set is fetched again for an unknown key id, because the identity
+// provider may have rotated its keys, but at most once per refetchInterval. Until a set has been fetched
+// successfully, every call tries again.
+func publicKey(ctx context.Context, client *http.Client, uri, kid string) (signingKey, error) {
+	keySetsLock.Lock()
+	set, ok := keySets[uri]
+	if !ok {
+		set = &keySet{}
+		keySets[uri] = set
+	}
+
+	if key, ok := set.key(kid); ok {
+		keySetsLock.Unlock()
+		return key, nil
+	}
+
+	if set.keys != nil && time.Since(set.fetched) < refetchInterval {
+		keySetsLock.Unlock()
+		return signingKey{}, fmt.Errorf("oidc: unknown key %q", kid)
+	}
+
+	set.fetched = time.Now()
+	keySetsLock.Unlock()
+
+	req, err := http.NewRequestWithContext(ctx, "GET", uri, nil)
+	if err != nil {
+		return signingKey{}, err
+	}
+
+	var jwks JWKS
+	if err := fetchJSON(client, req, &jwks); err != nil {
+		return signingKey{}, fmt.Errorf("oidc: cannot fetch keys: %w", err)
+	}
+
+	keys := map[string]signingKey{}
+	for _, k := range jwks.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+
+		if pub, err := k.PublicKey(); err == nil {
+			keys[k.Kid] = signingKey{pub: pub, alg: k.Alg}
+		}
+	}
+
+	keySetsLock.Lock()
+	set.keys = keys
+	key, ok := set.key(kid)
+	keySetsLock.Unlock()
+
+	if ok {
+		return key, nil
+	}
+
+	return signingKey{}, fmt.Errorf("oidc: unknown key %q", kid)
+}
+
+// PublicKey decodes the RSA or EC key.
+func (k JWK) PublicKey() (any, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, err
+		}
+
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return nil, err
+		}
+
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, err
+		}
+
+		y, err := base64.RawURLEncoding.DecodeString(k.Y)
+		if err != nil {
+			return nil, err
+		}
+
+		return &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+	}
+}
+
+func decodeSegment(seg string, v any) error {
+	buf, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return fmt.Errorf("oidc: malformed id token: %w", err)
+	}
+
+	if err := json.Unmarshal(buf, v); err != nil {
+		return fmt.Errorf("oidc: malformed id token: %w", err)
+	}
+
+	return nil
+}
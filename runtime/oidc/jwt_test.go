@@ -0,0 +1,233 @@
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// keyServer serves the public key of a new RSA key with the given id and counts the requests.
+func keyServer(t *testing.T, kid string) (*rsa.PrivateKey, *httptest.Server, *atomic.Int32) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var fetches atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches.Add(1)
+		_ = json.NewEncoder(w).Encode(JWKS{Keys: []JWK{{
+			Kty: "RSA",
+			Kid: kid,
+			N:   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	}))
+	t.Cleanup(srv.Close)
+
+	return key, srv, &fetches
+}
+
+func sign(t *testing.T, key *rsa.PrivateKey, header, claims map[string]any) string {
+	h, _ := json.Marshal(header)
+	c, _ := json.Marshal(claims)
+	signed := base64.RawURLEncoding.EncodeToString(h) + "." + base64.RawURLEncoding.EncodeToString(c)
+	sum := sha256.Sum256([]byte(signed))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, sum[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func TestVerify(t *testing.T) {
+	key, srv, _ := keyServer(t, "k1")
+	other, _ := rsa.GenerateKey(rand.Reader, 2048)
+	p := Provider{Issuer: "https://id.example.com/", JWKSURI: srv.URL}
+	header := map[string]any{"alg": "RS256", "kid": "k1"}
+	claims := func(change map[string]any) map[string]any {
+		c := map[string]any{"iss": "https://id.example.com", "aud": "app", "exp": time.Now().Add(time.Hour).Unix(), "nonce": "n", "sub": "1"}
+		for k, v := range change {
+			c[k] = v
+		}
+
+		return c
+	}
+
+	tests := []struct {
+		name  string
+		token string
+		err   string
+	}{
+		{"valid", sign(t, key, header, claims(nil)), ""},
+		{"audience list", sign(t, key, header, claims(map[string]any{"aud": []string{"other", "app"}})), ""},
+		{"within leeway", sign(t, key, header, claims(map[string]any{"exp": time.Now().Add(-leeway / 2).Unix()})), ""},
+		{"signature", sign(t, other, header, claims(nil)), "invalid id token signature"},
+		{"issuer", sign(t, key, header, claims(map[string]any{"iss": "https://evil.example.com"})), "unexpected issuer"},
+		{"audience", sign(t, key, header, claims(map[string]any{"aud": "other"})), "not issued for app"},
+		{"expired", sign(t, key, header, claims(map[string]any{"exp": time.Now().Add(-2 * leeway).Unix()})), "expired"},
+		{"missing expiry", sign(t, key, header, claims(map[string]any{"exp": nil})), "expired"},
+		{"nonce", sign(t, key, header, claims(map[string]any{"nonce": "replayed"})), "nonce mismatch"},
+		{"algorithm", sign(t, key, map[string]any{"alg": "none", "kid": "k1"}, claims(nil)), "unsupported id token algorithm"},
+		{"malformed", "a.b", "malformed"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := verify(context.Background(), http.DefaultClient, p, "app", tt.token, "n")
+			switch {
+			case tt.err == "" && err != nil:
+				t.Fatal(err)
+			case tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)):
+				t.Fatalf("expected %q, got %v", tt.err, err)
+			}
+		})
+	}
+}
+
+func TestPublicKeyRefetch(t *testing.T) {
+	_, srv, fetches := keyServer(t, "k1")
+	ctx := context.Background()
+	if _, err := publicKey(ctx, http.DefaultClient, srv.URL, "k1"); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 10; i++ {
+		if _, err := publicKey(ctx, http.DefaultClient, srv.URL, "unknown"); err == nil {
+			t.Fatal("expected an unknown key")
+		}
+	}
+
+	if n := fetches.Load(); n != 1 {
+		t.Fatalf("expected unknown keys to be rate limited, got %d fetches", n)
+	}
+
+	keySetsLock.Lock()
+	keySets[srv.URL].fetched = time.Now().Add(-refetchInterval)
+	keySetsLock.Unlock()
+
+	_, _ = publicKey(ctx, http.DefaultClient, srv.URL, "rotated")
+	if n := fetches.Load(); n != 2 {
+		t.Fatalf("expected a refetch after the interval, got %d fetches", n)
+	}
+
+	if _, err := publicKey(ctx, http.DefaultClient, srv.URL, "k1"); err != nil || fetches.Load() != 2 {
+		t.Fatalf("expected the known key from the cache, got %v", err)
+	}
+}
+
+func TestVerifySignature(t *testing.T) {
+	signed := []byte("header.claims")
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signRSA := func(alg string) []byte {
+		h, sum := digest(alg, signed)
+		sig, err := rsa.SignPKCS1v15(rand.Reader, rsaKey, h, sum)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return sig
+	}
+
+	ecKeys := map[elliptic.Curve]*ecdsa.PrivateKey{}
+	for _, curve := range []elliptic.Curve{elliptic.P256(), elliptic.P384(), elliptic.P521()} {
+		if ecKeys[curve], err = ecdsa.GenerateKey(curve, rand.Reader); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// signEC returns r and s padded to the given size each, which is the size of the curve for a valid signature.
+	signEC := func(alg string, key *ecdsa.PrivateKey, size int) []byte {
+		_, sum := digest(alg, signed)
+		r, s, err := ecdsa.Sign(rand.Reader, key, sum)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return append(r.FillBytes(make([]byte, size)), s.FillBytes(make([]byte, size))...)
+	}
+
+	p256, p384, p521 := ecKeys[elliptic.P256()], ecKeys[elliptic.P384()], ecKeys[elliptic.P521()]
+	tests := []struct {
+		name string
+		alg  string
+		key  signingKey
+		sig  []byte
+		err  string
+	}{
+		{"RS256", "RS256", signingKey{pub: &rsaKey.PublicKey}, signRSA("RS256"), ""},
+		{"RS384 with any alg", "RS384", signingKey{pub: &rsaKey.PublicKey}, signRSA("RS384"), ""},
+		{"RS256 published", "RS256", signingKey{pub: &rsaKey.PublicKey, alg: "RS256"}, signRSA("RS256"), ""},
+		{"RS384 with RS256 key", "RS384", signingKey{pub: &rsaKey.PublicKey, alg: "RS256"}, signRSA("RS384"), "published for RS256"},
+		{"RS256 with EC key", "RS256", signingKey{pub: &p256.PublicKey}, signRSA("RS256"), "key does not match"},
+		{"ES256", "ES256", signingKey{pub: &p256.PublicKey}, signEC("ES256", p256, 32), ""},
+		{"ES384", "ES384", signingKey{pub: &p384.PublicKey}, signEC("ES384", p384, 48), ""},
+		{"ES512", "ES512", signingKey{pub: &p521.PublicKey}, signEC("ES512", p521, 66), ""},
+		{"ES256 with P-384 key", "ES256", signingKey{pub: &p384.PublicKey}, signEC("ES256", p384, 48), "key does not match"},
+		{"ES384 with P-256 key", "ES384", signingKey{pub: &p256.PublicKey}, signEC("ES384", p256, 32), "key does not match"},
+		{"ES256 with ES384 key", "ES256", signingKey{pub: &p256.PublicKey, alg: "ES384"}, signEC("ES256", p256, 32), "published for ES384"},
+		{"ES256 padded", "ES256", signingKey{pub: &p256.PublicKey}, signEC("ES256", p256, 33), "signature length"},
+		{"ES256 truncated", "ES256", signingKey{pub: &p256.PublicKey}, signEC("ES256", p256, 32)[:63], "signature length"},
+		{"ES256 with RSA key", "ES256", signingKey{pub: &rsaKey.PublicKey}, signEC("ES256", p256, 32), "key does not match"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := verifySignature(tt.alg, tt.key, signed, tt.sig)
+			switch {
+			case tt.err == "" && err != nil:
+				t.Fatal(err)
+			case tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)):
+				t.Fatalf("expected %q, got %v", tt.err, err)
+			}
+		})
+	}
+}
+
+func TestPublicKeyAlgorithm(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(JWKS{Keys: []JWK{{
+			Kty: "RSA",
+			Kid: "k1",
+			Alg: "RS256",
+			N:   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	}))
+	defer srv.Close()
+
+	p := Provider{Issuer: "https://id.example.com", JWKSURI: srv.URL}
+	claims := map[string]any{"iss": "https://id.example.com", "aud": "app", "exp": time.Now().Add(time.Hour).Unix()}
+	if _, err := verify(context.Background(), http.DefaultClient, p, "app", sign(t, key, map[string]any{"alg": "RS256", "kid": "k1"}, claims), ""); err != nil {
+		t.Fatal(err)
+	}
+
+	// the signature is made with SHA-256, but the header claims RS512, which the published key does not allow
+	token := sign(t, key, map[string]any{"alg": "RS512", "kid": "k1"}, claims)
+	if _, err := verify(context.Background(), http.DefaultClient, p, "app", token, ""); err == nil || !strings.Contains(err.Error(), "published for RS256") {
+		t.Fatalf("expected the algorithm of the key to be enforced, got %v", err)
+	}
+}
@@ -0,0 +1,497 @@
+// Package oidc implements the app.OIDC authentication: discovery, the authorization code flow with PKCE, the
+// verification of ID tokens, the refresh of access tokens and the logout. Importing the package registers the
+// authorizer, which attaches the access token to the requests, and the refresher, which renews it after a 401.
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gotrino/fusion/spec/app"
+	http2 "github.com/gotrino/fusion/spec/http"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrLoginRequired means that there is no session or that it cannot be refreshed anymore.
+var ErrLoginRequired = errors.New("oidc: login required")
+
+// expirySkew refreshes access tokens a little before they actually expire.
+const expirySkew = 30 * time.Second
+
+var providers = map[string]Provider{}
+var providersLock sync.Mutex
+
+var refreshLocks = map[string]*sync.Mutex{}
+var refreshLocksLock sync.Mutex
+
+func init() {
+	http2.RegisterAuthorizer(func(ctx context.Context, connection string, auth app.OIDC, req *http.Request) *http.Request {
+		if token, err := Token(ctx, auth, connection); err == nil {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+
+		return req
+	})
+
+	http2.RegisterRefresher(func(ctx context.Context, connection string, auth app.OIDC) error {
+		lock := refreshLock(auth.Issuer + "#" + connection)
+		lock.Lock()
+		defer lock.Unlock()
+
+		_, err := Refresh(ctx, auth, connection)
+		return err
+	})
+}
+
+// Provider is the discovered configuration of an identity provider.
+type Provider struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	UserInfoEndpoint      string `json:"userinfo_endpoint,omitempty"`
+	JWKSURI               string `json:"jwks_uri"`
+	EndSessionEndpoint    string `json:"end_session_endpoint,omitempty"`
+}
+
+// Session is the state of a login, which is kept in the app.TokenStore of the configuration.
+type Session struct {
+	AccessToken  string    `json:"access_token"`
+	RefreshToken string    `json:"refresh_token,omitempty"`
+	IDToken      string    `json:"id_token,omitempty"`
+	Expiry       time.Time `json:"expiry"`
+	Claims       Claims    `json:"claims"`
+}
+
+// Claims are the verified claims of the ID token, which describe the current user.
+type Claims map[string]any
+
+// String returns the claim, if it is a string.
+func (c Claims) String(name string) string {
+	s, _ := c[name].(string)
+	return s
+}
+
+func (c Claims) Subject() string {
+	return c.String("sub")
+}
+
+func (c Claims) Name() string {
+	return c.String("name")
+}
+
+func (c Claims) Email() string {
+	return c.String("email")
+}
+
+// pending is the state of a started login, which must survive the redirect to the identity provider.
+type pending struct {
+	State    string `json:"state"`
+	Nonce    string `json:"nonce"`
+	Verifier string `json:"verifier"`
+}
+
+type tokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	RefreshToken string `json:"refresh_token"`
+	IDToken      string `json:"id_token"`
+	ExpiresIn    int64  `json:"expires_in"`
+	Error        string `json:"error"`
+	Description  string `json:"error_description"`
+}
+
+// Discover loads the configuration of the issuer from its well-known location. It is cached per issuer.
+func Discover(ctx context.Context, client *http.Client, issuer string) (Provider, error) {
+	providersLock.Lock()
+	p, ok := providers[issuer]
+	providersLock.Unlock()
+	if ok {
+		return p, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", strings.TrimSuffix(issuer, "/")+"/.well-known/openid-configuration", nil)
+	if err != nil {
+		return p, err
+	}
+
+	if err := fetchJSON(client, req, &p); err != nil {
+		return p, fmt.Errorf("oidc: cannot discover %s: %w", issuer, err)
+	}
+
+	if strings.TrimSuffix(p.Issuer, "/") != strings.TrimSuffix(issuer, "/") {
+		return p, fmt.Errorf("oidc: discovered issuer %s does not match %s", p.Issuer, issuer)
+	}
+
+	providersLock.Lock()
+	providers[issuer] = p
+	providersLock.Unlock()
+
+	return p, nil
+}
+
+// AuthCodeURL starts a login and returns the url of the identity provider, where the runtime redirects to.
+// The state, nonce and PKCE verifier are kept in the store until the Callback.
+func AuthCodeURL(ctx context.Context, cfg app.OIDC, connection string) (string, error) {
+	c, err := client(ctx, connection)
+	if err != nil {
+		return "", err
+	}
+
+	p, err := Discover(ctx, c, cfg.Issuer)
+	if err != nil {
+		return "", err
+	}
+
+	flow := pending{State: random(), Nonce: random(), Verifier: random()}
+	buf, err := json.Marshal(flow)
+	if err != nil {
+		return "", err
+	}
+
+	app.StoreOf(cfg.Store).Store(pendingKey(connection), string(buf))
+
+	challenge := sha256.Sum256([]byte(flow.Verifier))
+	q := url.Values{}
+	q.Set("response_type", "code")
+	q.Set("client_id", cfg.ClientID)
+	q.Set("redirect_uri", cfg.RedirectURL)
+	q.Set("scope", strings.Join(scopes(cfg), " "))
+	q.Set("state", flow.State)
+	q.Set("nonce", flow.Nonce)
+	q.Set("code_challenge", base64.RawURLEncoding.EncodeToString(challenge[:]))
+	q.Set("code_challenge_method", "S256")
+
+	return withQuery(p.AuthorizationEndpoint, q), nil
+}
+
+// Callback completes the login using the url, which the identity provider has redirected to. The code is
+// exchanged, the ID token is verified and the session is kept in the store.
+func Callback(ctx context.Context, cfg app.OIDC, connection string, callback *url.URL) (Session, error) {
+	store := app.StoreOf(cfg.Store)
+	q := callback.Query()
+	if e := q.Get("error"); e != "" {
+		return Session{}, fmt.Errorf("oidc: login failed: %s %s", e, q.Get("error_description"))
+	}
+
+	raw, ok := store.Load(pendingKey(connection))
+	if !ok {
+		return Session{}, fmt.Errorf("oidc: no login in progress")
+	}
+
+	var flow pending
+	if err := json.Unmarshal([]byte(raw), &flow); err != nil {
+		return Session{}, err
+	}
+
+	if q.Get("state") != flow.State {
+		return Session{}, fmt.Errorf("oidc: state mismatch")
+	}
+
+	store.Delete(pendingKey(connection))
+
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", q.Get("code"))
+	form.Set("redirect_uri", cfg.RedirectURL)
+	form.Set("code_verifier", flow.Verifier)
+
+	return exchange(ctx, cfg, connection, form, flow.Nonce, Session{})
+}
+
+// Token returns a valid access token and refreshes it, if it has expired. Concurrent callers share a refresh.
+func Token(ctx context.Context, cfg app.OIDC, connection string) (string, error) {
+	s, ok := Current(cfg, connection)
+	if !ok {
+		return "", ErrLoginRequired
+	}
+
+	if valid(s) {
+		return s.AccessToken, nil
+	}
+
+	lock := refreshLock(cfg.Issuer + "#" + connection)
+	lock.Lock()
+	defer lock.Unlock()
+
+	// another caller may have refreshed meanwhile
+	if s, ok = Current(cfg, connection); !ok {
+		return "", ErrLoginRequired
+	}
+
+	if valid(s) {
+		return s.AccessToken, nil
+	}
+
+	s, err := Refresh(ctx, cfg, connection)
+	if err != nil {
+		return "", err
+	}
+
+	return s.AccessToken, nil
+}
+
+// Refresh exchanges the refresh token for new tokens, even if the access token is still valid. If the identity
+// provider rejects the refresh token, the session is removed and ErrLoginRequired is returned.
+func Refresh(ctx context.Context, cfg app.OIDC, connection string) (Session, error) {
+	s, ok := Current(cfg, connection)
+	if !ok || s.RefreshToken == "" {
+		return Session{}, ErrLoginRequired
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "refresh_token")
+	form.Set("refresh_token", s.RefreshToken)
+
+	res, err := exchange(ctx, cfg, connection, form, "", s)
+	var rejected tokenError
+	if errors.As(err, &rejected) && rejected.Code == "invalid_grant" {
+		app.StoreOf(cfg.Store).Delete(connection)
+		return Session{}, ErrLoginRequired
+	}
+
+	return res, err
+}
+
+// Current returns the session of the connection without refreshing it.
+func Current(cfg app.OIDC, connection string) (Session, bool) {
+	raw, ok := app.StoreOf(cfg.Store).Load(connection)
+	if !ok {
+		return Session{}, false
+	}
+
+	var s Session
+	if err := json.Unmarshal([]byte(raw), &s); err != nil {
+		return Session{}, false
+	}
+
+	return s, true
+}
+
+// User returns the claims of the user, who is logged in on the named connection of the application.
+func User(ctx context.Context, connection string) (Claims, bool) {
+	a, ok := app.Lookup[app.Application](ctx)
+	if !ok {
+		return nil, false
+	}
+
+	cfg, ok := a.AuthenticationOf(connection).(app.OIDC)
+	if !ok {
+		return nil, false
+	}
+
+	s, ok := Current(cfg, connection)
+	return s.Claims, ok
+}
+
+// Logout removes the session and returns the end session url of the identity provider, where the runtime should
+// redirect to. The url is empty, if the provider does not support it.
+func Logout(ctx context.Context, cfg app.OIDC, connection string) (string, error) {
+	s, _ := Current(cfg, connection)
+	app.StoreOf(cfg.Store).Delete(connection)
+
+	c, err := client(ctx, connection)
+	if err != nil {
+		return "", err
+	}
+
+	p, err := Discover(ctx, c, cfg.Issuer)
+	if err != nil {
+		return "", err
+	}
+
+	if p.EndSessionEndpoint == "" {
+		return "", nil
+	}
+
+	q := url.Values{}
+	q.Set("client_id", cfg.ClientID)
+	if s.IDToken != "" {
+		q.Set("id_token_hint", s.IDToken)
+	}
+
+	if cfg.PostLogoutRedirectURL != "" {
+		q.Set("post_logout_redirect_uri", cfg.PostLogoutRedirectURL)
+	}
+
+	return withQuery(p.EndSessionEndpoint, q), nil
+}
+
+// tokenError is an error response of the token endpoint.
+type tokenError struct {
+	Code        string
+	Description string
+}
+
+func (e tokenError) Error() string {
+	return fmt.Sprintf("oidc: token request failed: %s %s", e.Code, e.Description)
+}
+
+// exchange posts the form to the token endpoint and stores the resulting session. Values which are not
+// returned, like the refresh token or the ID token on a refresh, are kept from the former session.
+func exchange(ctx context.Context, cfg app.OIDC, connection string, form url.Values, nonce string, former Session) (Session, error) {
+	c, err := client(ctx, connection)
+	if err != nil {
+		return Session{}, err
+	}
+
+	p, err := Discover(ctx, c, cfg.Issuer)
+	if err != nil {
+		return Session{}, err
+	}
+
+	form.Set("client_id", cfg.ClientID)
+	req, err := http.NewRequestWithContext(ctx, "POST", p.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return Session{}, err
+	}
+
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if cfg.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(cfg.ClientID), url.QueryEscape(cfg.ClientSecret))
+	}
+
+	resp, err := c.Do(req)
+	if err != nil {
+		return Session{}, err
+	}
+
+	defer resp.Body.Close()
+
+	var res tokenResponse
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&res); err != nil {
+		return Session{}, http2.HttpError{Status: resp.StatusCode, Cause: err}
+	}
+
+	if res.Error != "" {
+		return Session{}, tokenError{Code: res.Error, Description: res.Description}
+	}
+
+	if resp.StatusCode != http.StatusOK || res.AccessToken == "" {
+		return Session{}, http2.HttpError{Status: resp.StatusCode}
+	}
+
+	s := former
+	s.AccessToken = res.AccessToken
+	s.Expiry = time.Time{}
+	if res.ExpiresIn > 0 {
+		s.Expiry = time.Now().Add(time.Duration(res.ExpiresIn) * time.Second)
+	}
+
+	if res.RefreshToken != "" {
+		s.RefreshToken = res.RefreshToken
+	}
+
+	if res.IDToken != "" {
+		claims, err := verify(ctx, c, p, cfg.ClientID, res.IDToken, nonce)
+		if err != nil {
+			return Session{}, err
+		}
+
+		s.IDToken, s.Claims = res.IDToken, claims
+	} else if nonce != "" {
+		return Session{}, fmt.Errorf("oidc: missing id token")
+	}
+
+	buf, err := json.Marshal(s)
+	if err != nil {
+		return Session{}, err
+	}
+
+	app.StoreOf(cfg.Store).Store(connection, string(buf))
+	return s, nil
+}
+
+func valid(s Session) bool {
+	return s.AccessToken != "" && (s.Expiry.IsZero() || time.Now().Add(expirySkew).Before(s.Expiry))
+}
+
+func scopes(cfg app.OIDC) []string {
+	if len(cfg.Scopes) == 0 {
+		return []string{"openid", "profile", "email", "offline_access"}
+	}
+
+	for _, s := range cfg.Scopes {
+		if s == "openid" {
+			return cfg.Scopes
+		}
+	}
+
+	return append([]string{"openid"}, cfg.Scopes...)
+}
+
+// client returns the client for the identity provider, which only shares the Proxy and the Timeout of the
+// connection. Its TLS configuration and Headers, like an api key, belong to the API and must not reach the issuer.
+func client(ctx context.Context, connection string) (*http.Client, error) {
+	a, ok := app.Lookup[app.Application](ctx)
+	if !ok {
+		return http.DefaultClient, nil
+	}
+
+	c, err := a.ConnectionOf(connection)
+	if err != nil {
+		return nil, err
+	}
+
+	return http2.SharedClient(app.Connection{Proxy: c.Proxy, Timeout: c.Timeout})
+}
+
+func refreshLock(key string) *sync.Mutex {
+	refreshLocksLock.Lock()
+	defer refreshLocksLock.Unlock()
+
+	lock, ok := refreshLocks[key]
+	if !ok {
+		lock = &sync.Mutex{}
+		refreshLocks[key] = lock
+	}
+
+	return lock
+}
+
+func pendingKey(connection string) string {
+	return connection + "#oidc-pending"
+}
+
+func random() string {
+	var buf [32]byte
+	if _, err := rand.Read(buf[:]); err != nil {
+		panic(err)
+	}
+
+	return base64.RawURLEncoding.EncodeToString(buf[:])
+}
+
+func withQuery(endpoint string, q url.Values) string {
+	sep := "?"
+	if strings.Contains(endpoint, "?") {
+		sep = "&"
+	}
+
+	return endpoint + sep + q.Encode()
+}
+
+func fetchJSON(client *http.Client, req *http.Request, v any) error {
+	req.Header.Set("Accept", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return http2.HttpError{Status: resp.StatusCode}
+	}
+
+	return json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(v)
+}
@@ -0,0 +1,228 @@
+package oidc_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/gotrino/fusion/runtime/oidc"
+	"github.com/gotrino/fusion/runtime/oidc/oidctest"
+	"github.com/gotrino/fusion/spec/app"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const connection = "api"
+
+func login(t *testing.T) (*oidctest.Provider, app.OIDC, *url.URL) {
+	p := oidctest.NewProvider("app")
+	t.Cleanup(p.Close)
+
+	cfg := app.OIDC{Issuer: p.URL, ClientID: "app", RedirectURL: "http://app/callback", Store: &app.MemoryTokenStore{}}
+	authURL, err := oidc.AuthCodeURL(context.Background(), cfg, connection)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	callback, err := p.Login(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return p, cfg, callback
+}
+
+// editPending changes the state of the started login, like an attacker or a stale tab would.
+func editPending(t *testing.T, cfg app.OIDC, edit func(flow map[string]string)) {
+	raw, ok := cfg.Store.Load(connection + "#oidc-pending")
+	if !ok {
+		t.Fatal("expected a login in progress")
+	}
+
+	var flow map[string]string
+	if err := json.Unmarshal([]byte(raw), &flow); err != nil {
+		t.Fatal(err)
+	}
+
+	edit(flow)
+	buf, _ := json.Marshal(flow)
+	cfg.Store.Store(connection+"#oidc-pending", string(buf))
+}
+
+func TestLogin(t *testing.T) {
+	p, cfg, callback := login(t)
+	if !strings.HasPrefix(callback.String(), cfg.RedirectURL) {
+		t.Fatalf("unexpected callback %s", callback)
+	}
+
+	s, err := oidc.Callback(context.Background(), cfg, connection, callback)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !p.Valid(s.AccessToken) || s.RefreshToken == "" || s.Claims.Subject() != "1234" || s.Claims.Email() != "test@example.com" {
+		t.Fatalf("unexpected session %+v", s)
+	}
+
+	if current, ok := oidc.Current(cfg, connection); !ok || current.AccessToken != s.AccessToken {
+		t.Fatal("expected the session in the store")
+	}
+
+	if _, ok := cfg.Store.Load(connection + "#oidc-pending"); ok {
+		t.Fatal("expected the pending login to be removed")
+	}
+
+	if _, err := oidc.Callback(context.Background(), cfg, connection, callback); err == nil {
+		t.Fatal("expected a replayed callback to fail")
+	}
+}
+
+func TestLoginRejected(t *testing.T) {
+	tests := []struct {
+		name string
+		edit func(t *testing.T, cfg app.OIDC, callback *url.URL)
+		err  string
+	}{
+		{"state", func(t *testing.T, cfg app.OIDC, callback *url.URL) {
+			q := callback.Query()
+			q.Set("state", "forged")
+			callback.RawQuery = q.Encode()
+		}, "state mismatch"},
+		{"nonce", func(t *testing.T, cfg app.OIDC, callback *url.URL) {
+			editPending(t, cfg, func(flow map[string]string) { flow["nonce"] = "other" })
+		}, "nonce mismatch"},
+		{"verifier", func(t *testing.T, cfg app.OIDC, callback *url.URL) {
+			editPending(t, cfg, func(flow map[string]string) { flow["verifier"] = "guessed" })
+		}, "invalid_grant"},
+		{"error", func(t *testing.T, cfg app.OIDC, callback *url.URL) {
+			callback.RawQuery = url.Values{"error": {"access_denied"}}.Encode()
+		}, "access_denied"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, cfg, callback := login(t)
+			tt.edit(t, cfg, callback)
+
+			_, err := oidc.Callback(context.Background(), cfg, connection, callback)
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Fatalf("expected %q, got %v", tt.err, err)
+			}
+
+			if _, ok := oidc.Current(cfg, connection); ok {
+				t.Fatal("expected no session")
+			}
+		})
+	}
+}
+
+func TestRefresh(t *testing.T) {
+	p, cfg, callback := login(t)
+	ctx := context.Background()
+	s, err := oidc.Callback(ctx, cfg, connection, callback)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p.Expire()
+	renewed, err := oidc.Refresh(ctx, cfg, connection)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if renewed.AccessToken == s.AccessToken || !p.Valid(renewed.AccessToken) || p.Valid(s.AccessToken) {
+		t.Fatal("expected a new access token")
+	}
+
+	if renewed.Claims.Subject() != "1234" {
+		t.Fatalf("expected the claims of the refreshed id token, got %v", renewed.Claims)
+	}
+
+	if token, err := oidc.Token(ctx, cfg, connection); err != nil || token != renewed.AccessToken {
+		t.Fatalf("expected the stored token, got %s %v", token, err)
+	}
+}
+
+func TestRefreshRevoked(t *testing.T) {
+	p, cfg, callback := login(t)
+	ctx := context.Background()
+	if _, err := oidc.Callback(ctx, cfg, connection, callback); err != nil {
+		t.Fatal(err)
+	}
+
+	p.RevokeRefreshTokens()
+	if _, err := oidc.Refresh(ctx, cfg, connection); !errors.Is(err, oidc.ErrLoginRequired) {
+		t.Fatalf("expected ErrLoginRequired, got %v", err)
+	}
+
+	if _, ok := oidc.Current(cfg, connection); ok {
+		t.Fatal("expected the session to be removed")
+	}
+
+	if _, err := oidc.Token(ctx, cfg, connection); !errors.Is(err, oidc.ErrLoginRequired) {
+		t.Fatalf("expected ErrLoginRequired, got %v", err)
+	}
+}
+
+func TestIdentityProviderClient(t *testing.T) {
+	p := oidctest.NewProvider("app")
+	defer p.Close()
+
+	var lock sync.Mutex
+	var proxied []string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		proxied = append(proxied, r.URL.Path+" "+r.Header.Get("X-Api-Key"))
+		lock.Unlock()
+
+		(&httputil.ReverseProxy{Director: func(*http.Request) {}}).ServeHTTP(w, r)
+	}))
+	defer proxy.Close()
+
+	api := app.Connection{
+		Scheme:  "https",
+		Host:    "api.example.com",
+		Port:    443,
+		Proxy:   proxy.URL,
+		Timeout: 5 * time.Second,
+		Headers: map[string]string{"X-Api-Key": "secret"},
+		TLS:     app.TLS{ServerName: "api.internal"},
+	}
+	ctx := app.WithContext(context.Background(), app.Application{Connections: map[string]app.Connection{connection: api}})
+
+	cfg := app.OIDC{Issuer: p.URL, ClientID: "app", RedirectURL: "http://app/callback", Store: &app.MemoryTokenStore{}}
+	authURL, err := oidc.AuthCodeURL(ctx, cfg, connection)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	callback, err := p.Login(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := oidc.Callback(ctx, cfg, connection, callback); err != nil {
+		t.Fatal(err)
+	}
+
+	lock.Lock()
+	defer lock.Unlock()
+	if len(proxied) == 0 {
+		t.Fatal("expected the proxy of the connection to be used")
+	}
+
+	for _, req := range proxied {
+		if strings.Contains(req, "secret") {
+			t.Fatalf("the headers of the connection must not be sent to the issuer: %v", proxied)
+		}
+	}
+
+	if _, err := oidc.AuthCodeURL(ctx, cfg, "typo"); !errors.Is(err, app.ErrUnknownConnection) {
+		t.Fatalf("expected an unknown connection, got %v", err)
+	}
+}
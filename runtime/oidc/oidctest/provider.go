@@ -0,0 +1,314 @@
+// Package oidctest provides a stand-in identity provider, which implements just enough of OpenID Connect to test
+// app.OIDC logins without a browser or a real identity provider.
+package oidctest
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"github.com/gotrino/fusion/runtime/oidc"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"time"
+)
+
+const keyID = "oidctest"
+
+// Provider auto approves every authorization request and issues RS256 signed ID tokens. Codes and refresh
+// tokens are single use, like a strict identity provider with refresh token rotation would treat them.
+type Provider struct {
+	*httptest.Server
+	ClientID string
+	// Claims are added to every ID token. Defaults to a subject, name and email of a test user.
+	Claims map[string]any
+	// AccessTokenTTL is the lifetime of the issued access tokens. Defaults to an hour.
+	AccessTokenTTL time.Duration
+
+	key     *rsa.PrivateKey
+	lock    sync.Mutex
+	codes   map[string]grant
+	refresh map[string]grant
+	access  map[string]time.Time
+	logouts int
+}
+
+type grant struct {
+	nonce     string
+	challenge string
+	redirect  string
+}
+
+// NewProvider starts an identity provider for the client. It must be closed when done.
+func NewProvider(clientID string) *Provider {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		panic(err)
+	}
+
+	p := &Provider{
+		ClientID:       clientID,
+		Claims:         map[string]any{"sub": "1234", "name": "Test User", "email": "test@example.com"},
+		AccessTokenTTL: time.Hour,
+		key:            key,
+		codes:          map[string]grant{},
+		refresh:        map[string]grant{},
+		access:         map[string]time.Time{},
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", p.discovery)
+	mux.HandleFunc("/authorize", p.authorize)
+	mux.HandleFunc("/token", p.token)
+	mux.HandleFunc("/jwks", p.jwks)
+	mux.HandleFunc("/logout", p.logout)
+	p.Server = httptest.NewServer(mux)
+
+	return p
+}
+
+// Login follows the authorization url like a browser would and returns the callback url, which the provider has
+// redirected to.
+func (p *Provider) Login(authURL string) (*url.URL, error) {
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+
+	resp, err := client.Get(authURL)
+	if err != nil {
+		return nil, err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusFound {
+		return nil, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+
+	return resp.Location()
+}
+
+// Valid reports whether the access token has been issued by the provider and has not expired yet.
+func (p *Provider) Valid(accessToken string) bool {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	exp, ok := p.access[accessToken]
+	return ok && time.Now().Before(exp)
+}
+
+// Handler wraps a resource server handler, which is only invoked for requests with a valid access token.
+// Other requests are rejected with a 401.
+func (p *Provider) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		const prefix = "Bearer "
+		auth := r.Header.Get("Authorization")
+		if len(auth) <= len(prefix) || !p.Valid(auth[len(prefix):]) {
+			w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Expire invalidates all issued access tokens, so that clients must refresh them.
+func (p *Provider) Expire() {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	p.access = map[string]time.Time{}
+}
+
+// RevokeRefreshTokens invalidates all refresh tokens, so that clients must login again.
+func (p *Provider) RevokeRefreshTokens() {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	p.refresh = map[string]grant{}
+}
+
+// Logouts returns the number of calls to the end session endpoint.
+func (p *Provider) Logouts() int {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	return p.logouts
+}
+
+func (p *Provider) discovery(w http.ResponseWriter, r *http.Request) {
+	write(w, http.StatusOK, oidc.Provider{
+		Issuer:                p.URL,
+		AuthorizationEndpoint: p.URL + "/authorize",
+		TokenEndpoint:         p.URL + "/token",
+		JWKSURI:               p.URL + "/jwks",
+		EndSessionEndpoint:    p.URL + "/logout",
+	})
+}
+
+func (p *Provider) authorize(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	switch {
+	case q.Get("response_type") != "code" || q.Get("client_id") != p.ClientID:
+		http.Error(w, "invalid request", http.StatusBadRequest)
+		return
+	case q.Get("code_challenge_method") != "S256" || q.Get("code_challenge") == "":
+		http.Error(w, "pkce required", http.StatusBadRequest)
+		return
+	}
+
+	redirect, err := url.Parse(q.Get("redirect_uri"))
+	if err != nil || redirect.Scheme == "" {
+		http.Error(w, "invalid redirect_uri", http.StatusBadRequest)
+		return
+	}
+
+	code := random()
+	p.lock.Lock()
+	p.codes[code] = grant{nonce: q.Get("nonce"), challenge: q.Get("code_challenge"), redirect: q.Get("redirect_uri")}
+	p.lock.Unlock()
+
+	cb := redirect.Query()
+	cb.Set("code", code)
+	cb.Set("state", q.Get("state"))
+	redirect.RawQuery = cb.Encode()
+
+	http.Redirect(w, r, redirect.String(), http.StatusFound)
+}
+
+func (p *Provider) token(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		tokenError(w, "invalid_request")
+		return
+	}
+
+	if r.PostForm.Get("client_id") != p.ClientID {
+		tokenError(w, "invalid_client")
+		return
+	}
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	var g grant
+	switch r.PostForm.Get("grant_type") {
+	case "authorization_code":
+		var ok bool
+		g, ok = p.codes[r.PostForm.Get("code")]
+		delete(p.codes, r.PostForm.Get("code"))
+
+		sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+		if !ok || g.redirect != r.PostForm.Get("redirect_uri") || g.challenge != base64.RawURLEncoding.EncodeToString(sum[:]) {
+			tokenError(w, "invalid_grant")
+			return
+		}
+	case "refresh_token":
+		var ok bool
+		g, ok = p.refresh[r.PostForm.Get("refresh_token")]
+		delete(p.refresh, r.PostForm.Get("refresh_token"))
+		if !ok {
+			tokenError(w, "invalid_grant")
+			return
+		}
+
+		g.nonce = "" // a refreshed ID token carries no nonce
+	default:
+		tokenError(w, "unsupported_grant_type")
+		return
+	}
+
+	access, refresh := random(), random()
+	p.access[access] = time.Now().Add(p.AccessTokenTTL)
+	p.refresh[refresh] = g
+
+	write(w, http.StatusOK, map[string]any{
+		"access_token":  access,
+		"token_type":    "Bearer",
+		"refresh_token": refresh,
+		"id_token":      p.idToken(g.nonce),
+		"expires_in":    int64(p.AccessTokenTTL / time.Second),
+	})
+}
+
+func (p *Provider) jwks(w http.ResponseWriter, r *http.Request) {
+	write(w, http.StatusOK, oidc.JWKS{Keys: []oidc.JWK{{
+		Kty: "RSA",
+		Kid: keyID,
+		Alg: "RS256",
+		Use: "sig",
+		N:   base64.RawURLEncoding.EncodeToString(p.key.N.Bytes()),
+		E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(p.key.E)).Bytes()),
+	}}})
+}
+
+func (p *Provider) logout(w http.ResponseWriter, r *http.Request) {
+	p.lock.Lock()
+	p.logouts++
+	p.lock.Unlock()
+
+	if redirect := r.URL.Query().Get("post_logout_redirect_uri"); redirect != "" {
+		http.Redirect(w, r, redirect, http.StatusFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// idToken signs the claims, the caller must hold the lock.
+func (p *Provider) idToken(nonce string) string {
+	now := time.Now()
+	claims := map[string]any{}
+	for k, v := range p.Claims {
+		claims[k] = v
+	}
+
+	claims["iss"] = p.URL
+	claims["aud"] = p.ClientID
+	claims["iat"] = now.Unix()
+	claims["exp"] = now.Add(p.AccessTokenTTL).Unix()
+	if nonce != "" {
+		claims["nonce"] = nonce
+	}
+
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT", "kid": keyID})
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		panic(err)
+	}
+
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	sum := sha256.Sum256([]byte(signed))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, p.key, crypto.SHA256, sum[:])
+	if err != nil {
+		panic(err)
+	}
+
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func tokenError(w http.ResponseWriter, code string) {
+	write(w, http.StatusBadRequest, map[string]string{"error": code})
+}
+
+func write(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func random() string {
+	var buf [24]byte
+	if _, err := rand.Read(buf[:]); err != nil {
+		panic(err)
+	}
+
+	return base64.RawURLEncoding.EncodeToString(buf[:])
+}
@@ -0,0 +1,132 @@
+package rest
+
+import (
+	"context"
+	"github.com/gotrino/fusion/spec/app"
+	http2 "github.com/gotrino/fusion/spec/http"
+	"sync"
+)
+
+// DefaultConcurrency is the amount of parallel requests used by SaveAll and DeleteAll, if a repository does not
+// support batches natively.
+const DefaultConcurrency = 4
+
+// BatchRepository is an optional extension of a Repository, which saves or deletes many entities at once.
+// The returned results have the same order as the given items and the error is an app.BatchError, if at least one
+// item failed.
+type BatchRepository[T any] interface {
+	SaveAll(ctx context.Context, ts []T) ([]app.BatchResult, error)
+	DeleteAll(ctx context.Context, ids []string) ([]app.BatchResult, error)
+}
+
+// SaveAll uses the BatchRepository capability of the repository or saves each entity concurrently otherwise.
+// A concurrency of zero means DefaultConcurrency.
+func SaveAll[T any](ctx context.Context, repo Repository[T], ts []T, concurrency int) ([]app.BatchResult, error) {
+	if b, ok := repo.(BatchRepository[T]); ok {
+		return b.SaveAll(ctx, ts)
+	}
+
+	return fanOut(len(ts), concurrency, func(i int) app.BatchResult {
+		id, err := GetID(ts[i])
+		if err != nil {
+			return app.BatchResult{Err: err}
+		}
+
+		return app.BatchResult{ID: id, Err: saveContext(ctx, repo, ts[i])}
+	})
+}
+
+// DeleteAll uses the BatchRepository capability of the repository or deletes each entity concurrently otherwise.
+// A concurrency of zero means DefaultConcurrency.
+func DeleteAll[T any](ctx context.Context, repo Repository[T], ids []string, concurrency int) ([]app.BatchResult, error) {
+	if b, ok := repo.(BatchRepository[T]); ok {
+		return b.DeleteAll(ctx, ids)
+	}
+
+	return fanOut(len(ids), concurrency, func(i int) app.BatchResult {
+		return app.BatchResult{ID: ids[i], Err: deleteContext(ctx, repo, ids[i])}
+	})
+}
+
+// fanOut invokes op for each index using at most concurrency goroutines.
+func fanOut(n, concurrency int, op func(i int) app.BatchResult) ([]app.BatchResult, error) {
+	if concurrency <= 0 {
+		concurrency = DefaultConcurrency
+	}
+
+	res := make([]app.BatchResult, n)
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			res[i] = op(i)
+		}(i)
+	}
+
+	wg.Wait()
+
+	return batchResult(res)
+}
+
+// batchResult returns an app.BatchError, if any result failed.
+func batchResult(res []app.BatchResult) ([]app.BatchResult, error) {
+	for _, r := range res {
+		if r.Err != nil {
+			return res, app.BatchError{Results: res}
+		}
+	}
+
+	return res, nil
+}
+
+// sameResult applies the same outcome to all items of a native batch request.
+func sameResult(ids []string, err error) ([]app.BatchResult, error) {
+	res := make([]app.BatchResult, 0, len(ids))
+	for _, id := range ids {
+		res = append(res, app.BatchResult{ID: id, Err: err})
+	}
+
+	return batchResult(res)
+}
+
+// each invokes op for the results at the valid indices using at most concurrency goroutines. The other results
+// keep their error.
+func each(res []app.BatchResult, valid []int, concurrency int, op func(i int) error) ([]app.BatchResult, error) {
+	_, _ = fanOut(len(valid), concurrency, func(k int) app.BatchResult {
+		res[valid[k]].Err = op(valid[k])
+		return res[valid[k]]
+	})
+
+	return batchResult(res)
+}
+
+// BulkOutcome is the result of a single item of a bulk request. A BulkPath reports them in the order of the
+// request, using a 207 Multi-Status or a 200 response like
+//
+//	[{"id": "1", "status": 204}, {"id": "2", "status": 409, "detail": "outdated version"}]
+//
+// Outcomes are matched by id or by their position, if the id is missing.
+type BulkOutcome struct {
+	ID     string `json:"id,omitempty"`
+	Status int    `json:"status"`
+	Title  string `json:"title,omitempty"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// err returns nil for a successful status or an HttpError carrying the details otherwise.
+func (o BulkOutcome) err() error {
+	if o.Status >= 200 && o.Status < 300 {
+		return nil
+	}
+
+	e := http2.HttpError{Status: o.Status}
+	if o.Title != "" || o.Detail != "" {
+		e.Problem = &http2.Problem{Title: o.Title, Detail: o.Detail, Status: o.Status}
+	}
+
+	return e
+}
@@ -0,0 +1,136 @@
+package rest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/gotrino/fusion/spec/app"
+	http2 "github.com/gotrino/fusion/spec/http"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+)
+
+// bulkServer answers the bulk path using the given handler and accepts single puts and deletes.
+func bulkServer(bulk http.HandlerFunc) (*httptest.Server, func() []string) {
+	var lock sync.Mutex
+	var singles []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/books/batch" {
+			bulk(w, r)
+			return
+		}
+
+		lock.Lock()
+		singles = append(singles, r.Method+" "+r.URL.Path)
+		lock.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	return srv, func() []string {
+		lock.Lock()
+		defer lock.Unlock()
+		return append([]string{}, singles...)
+	}
+}
+
+func bulkRepo[T any](srv *httptest.Server, bulkPath string) RESTRepo[T] {
+	base, _ := url.Parse(srv.URL + "/books")
+	return RESTRepo[T]{Base: base, BulkPath: bulkPath}
+}
+
+type ref struct {
+	ID *string
+}
+
+func TestSaveAllWithoutID(t *testing.T) {
+	srv, singles := bulkServer(func(w http.ResponseWriter, r *http.Request) {
+		var items []ref
+		if err := json.NewDecoder(r.Body).Decode(&items); err != nil || len(items) != 1 {
+			t.Errorf("expected only the valid item, got %v %v", items, err)
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	})
+	defer srv.Close()
+
+	id := "1"
+	for _, bulkPath := range []string{"", "batch"} {
+		res, err := bulkRepo[ref](srv, bulkPath).SaveAll(context.Background(), []ref{{ID: &id}, {}})
+		var batchErr app.BatchError
+		if !errors.As(err, &batchErr) || len(batchErr.Failed()) != 1 {
+			t.Fatalf("expected a single failure, got %v", err)
+		}
+
+		if res[0].ID != "1" || res[0].Err != nil || res[1].Err == nil {
+			t.Fatalf("got %+v", res)
+		}
+	}
+
+	if got := singles(); len(got) != 1 || got[0] != "PUT /books/1" {
+		t.Fatalf("expected a single put, got %v", got)
+	}
+}
+
+func TestSaveAllOutcomes(t *testing.T) {
+	srv, _ := bulkServer(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusMultiStatus)
+		_ = json.NewEncoder(w).Encode([]BulkOutcome{
+			{ID: "2", Status: http.StatusConflict, Detail: "outdated version"},
+			{ID: "1", Status: http.StatusCreated},
+		})
+	})
+	defer srv.Close()
+
+	res, err := bulkRepo[book](srv, "batch").SaveAll(context.Background(), []book{{ID: "1"}, {ID: "2"}, {ID: "3"}})
+	if err == nil {
+		t.Fatal("expected a batch error")
+	}
+
+	var conflict http2.HttpError
+	if res[0].Err != nil || !errors.As(res[1].Err, &conflict) || conflict.Status != http.StatusConflict || conflict.Problem.Detail != "outdated version" {
+		t.Fatalf("got %+v", res)
+	}
+
+	if res[2].Err == nil {
+		t.Fatal("an item without outcome must fail")
+	}
+}
+
+func TestDeleteAllBulk(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		singles int
+		failed  int
+	}{
+		{"applied as a whole", http.StatusNoContent, 0, 0},
+		{"rejected as a whole", http.StatusForbidden, 0, 2},
+		{"unknown bulk path", http.StatusNotFound, 2, 0},
+		{"unsupported method", http.StatusMethodNotAllowed, 2, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, singles := bulkServer(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+			})
+			defer srv.Close()
+
+			res, _ := bulkRepo[book](srv, "batch").DeleteAll(context.Background(), []string{"1", "2"})
+			failed := 0
+			for _, r := range res {
+				if r.Err != nil {
+					failed++
+				}
+			}
+
+			if failed != tt.failed || len(singles()) != tt.singles {
+				t.Fatalf("got %d failures and %d single requests: %+v", failed, len(singles()), res)
+			}
+		})
+	}
+}
@@ -0,0 +1,522 @@
+package rest
+
+import (
+	"context"
+	"github.com/gotrino/fusion/spec/app"
+	"sort"
+	"sync"
+	"time"
+)
+
+const listKey = "list"
+
+// DefaultMaxEntries limits a Cache or ETags store, which does not declare its own limit.
+const DefaultMaxEntries = 1000
+
+// revalidateTimeout bounds a background refresh, which is detached from the canceled caller.
+const revalidateTimeout = 30 * time.Second
+
+var sharedCaches = map[string]*Cache{}
+var sharedETags = map[string]*ETags{}
+var sharedLock sync.Mutex
+
+// CacheOptions declares how long cached results are used.
+type CacheOptions struct {
+	// TTL is the duration in which a cached result is considered fresh and returned without asking the server.
+	TTL time.Duration
+	// StaleWhileRevalidate is the duration after the TTL in which a stale result is still returned, while the
+	// result is refreshed in the background.
+	StaleWhileRevalidate time.Duration
+	// MaxEntries limits the amount of cached results. Expired results are evicted first, then the least recently
+	// used ones. Zero means DefaultMaxEntries.
+	MaxEntries int
+}
+
+// Cache is an in-memory store of List and Load results. It is safe for concurrent use. The zero value is an empty
+// Cache, whose results are never fresh, see NewCache.
+type Cache struct {
+	opts    CacheOptions
+	lock    sync.Mutex
+	entries map[string]*cacheEntry
+	// generation is incremented by each invalidation, so that fetches which have been started before are not
+	// written back.
+	generation uint64
+}
+
+type cacheEntry struct {
+	value      any
+	fetched    time.Time
+	used       time.Time
+	refreshing bool
+	hits       int
+}
+
+// CacheEntry describes the state of a single cached result for debugging purposes.
+type CacheEntry struct {
+	Key        string
+	Age        time.Duration
+	State      string // State is either fresh, stale or expired.
+	Refreshing bool
+	Hits       int
+}
+
+// NewCache allocates a new empty Cache.
+func NewCache(opts CacheOptions) *Cache {
+	return &Cache{opts: opts, entries: map[string]*cacheEntry{}}
+}
+
+// SharedCache returns the Cache registered with the given name or allocates a new one. Usually the name is
+// the resource URL, so that all repository instances of a resource use the same cache, even across renderings.
+func SharedCache(name string, opts CacheOptions) *Cache {
+	sharedLock.Lock()
+	defer sharedLock.Unlock()
+
+	c, ok := sharedCaches[name]
+	if !ok {
+		c = NewCache(opts)
+		sharedCaches[name] = c
+	}
+
+	return c
+}
+
+// Inspect returns a snapshot of all entries, sorted by key.
+func (c *Cache) Inspect() []CacheEntry {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	now := time.Now()
+	res := make([]CacheEntry, 0, len(c.entries))
+	for k, e := range c.entries {
+		res = append(res, CacheEntry{
+			Key:        k,
+			Age:        now.Sub(e.fetched),
+			State:      c.state(e, now),
+			Refreshing: e.refreshing,
+			Hits:       e.hits,
+		})
+	}
+
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].Key < res[j].Key
+	})
+
+	return res
+}
+
+// Invalidate removes the given keys. The list has the key "list" and entities have the key "entity/{id}".
+func (c *Cache) Invalidate(keys ...string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.generation++
+	for _, k := range keys {
+		delete(c.entries, k)
+	}
+}
+
+// Purge removes all entries.
+func (c *Cache) Purge() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.generation++
+	c.entries = map[string]*cacheEntry{}
+}
+
+func (c *Cache) state(e *cacheEntry, now time.Time) string {
+	age := now.Sub(e.fetched)
+	switch {
+	case age < c.opts.TTL:
+		return "fresh"
+	case age < c.opts.TTL+c.opts.StaleWhileRevalidate:
+		return "stale"
+	default:
+		return "expired"
+	}
+}
+
+// get returns a cached value or invokes fetch.
+func (c *Cache) get(ctx context.Context, key string, fetch func(ctx context.Context) (any, error)) (any, error) {
+	if v, ok := c.cached(ctx, key, fetch); ok {
+		return v, nil
+	}
+
+	gen := c.begin()
+	v, err := fetch(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	c.put(key, v, gen)
+	return v, nil
+}
+
+// cached returns a fresh or stale value. A stale value is refreshed in the background using fetch with a
+// context, which keeps the values but not the cancellation of the caller.
+func (c *Cache) cached(ctx context.Context, key string, fetch func(ctx context.Context) (any, error)) (any, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	e, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+
+	now := time.Now()
+	switch c.state(e, now) {
+	case "fresh":
+	case "stale":
+		if !e.refreshing {
+			e.refreshing = true
+			go c.refresh(context.WithoutCancel(ctx), key, e, fetch)
+		}
+	default:
+		delete(c.entries, key)
+		return nil, false
+	}
+
+	e.hits++
+	e.used = now
+	return e.value, true
+}
+
+// begin returns the generation, which must be passed to put after the fetch.
+func (c *Cache) begin() uint64 {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return c.generation
+}
+
+func (c *Cache) refresh(ctx context.Context, key string, old *cacheEntry, fetch func(ctx context.Context) (any, error)) {
+	ctx, cancel := context.WithTimeout(ctx, revalidateTimeout)
+	defer cancel()
+
+	v, err := fetch(ctx)
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	old.refreshing = false
+	if err != nil || c.entries[key] != old {
+		// keep the stale value on failure and never resurrect an invalidated entry
+		return
+	}
+
+	now := time.Now()
+	c.entries[key] = &cacheEntry{value: v, fetched: now, used: old.used, hits: old.hits}
+}
+
+// put stores the value, unless the cache has been invalidated since the generation has been taken.
+func (c *Cache) put(key string, v any, gen uint64) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if gen != c.generation {
+		return
+	}
+
+	if c.entries == nil {
+		c.entries = map[string]*cacheEntry{}
+	}
+
+	now := time.Now()
+	c.entries[key] = &cacheEntry{value: v, fetched: now, used: now}
+	c.evict(now)
+}
+
+// evict removes the expired entries and then the least recently used ones, until the limit is kept.
+func (c *Cache) evict(now time.Time) {
+	limit := c.opts.MaxEntries
+	if limit <= 0 {
+		limit = DefaultMaxEntries
+	}
+
+	if len(c.entries) <= limit {
+		return
+	}
+
+	for k, e := range c.entries {
+		if c.state(e, now) == "expired" && !e.refreshing {
+			delete(c.entries, k)
+		}
+	}
+
+	for len(c.entries) > limit {
+		var oldest string
+		for k, e := range c.entries {
+			if oldest == "" || e.used.Before(c.entries[oldest].used) {
+				oldest = k
+			}
+		}
+
+		delete(c.entries, oldest)
+	}
+}
+
+// CachedRepo decorates any Repository with a Cache. Save and Delete invalidate the list and the affected entity.
+type CachedRepo[T any] struct {
+	Repo  Repository[T]
+	Cache *Cache
+}
+
+// Cached wraps the given repository. Note, that a stencil can be cached using Cached[any], because any
+// app.RepositoryImplStencil is also a Repository[any].
+func Cached[T any](repo Repository[T], cache *Cache) CachedRepo[T] {
+	return CachedRepo[T]{Repo: repo, Cache: cache}
+}
+
+func (r CachedRepo[T]) ToStencil() app.RepositoryImplStencil {
+	return Stencil[T](r)
+}
+
+func (r CachedRepo[T]) List() ([]T, error) {
+	return r.list(context.Background(), func(context.Context) ([]T, error) {
+		return r.Repo.List()
+	})
+}
+
+func (r CachedRepo[T]) ListContext(ctx context.Context) ([]T, error) {
+	return r.list(ctx, r.fetchList)
+}
+
+func (r CachedRepo[T]) fetchList(ctx context.Context) ([]T, error) {
+	return listContext(ctx, r.Repo)
+}
+
+func (r CachedRepo[T]) list(ctx context.Context, fetch func(ctx context.Context) ([]T, error)) ([]T, error) {
+	v, err := r.Cache.get(ctx, listKey, func(ctx context.Context) (any, error) {
+		return fetch(ctx)
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return v.([]T), nil
+}
+
+func (r CachedRepo[T]) Load(id string) (T, error) {
+	return r.load(context.Background(), id, func(_ context.Context, id string) (T, error) {
+		return r.Repo.Load(id)
+	})
+}
+
+func (r CachedRepo[T]) LoadContext(ctx context.Context, id string) (T, error) {
+	return r.load(ctx, id, func(ctx context.Context, id string) (T, error) {
+		return loadContext(ctx, r.Repo, id)
+	})
+}
+
+func (r CachedRepo[T]) load(ctx context.Context, id string, fetch func(ctx context.Context, id string) (T, error)) (T, error) {
+	v, err := r.Cache.get(ctx, entityKey(id), func(ctx context.Context) (any, error) {
+		return fetch(ctx, id)
+	})
+
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+
+	return v.(T), nil
+}
+
+func (r CachedRepo[T]) Delete(id string) error {
+	err := r.Repo.Delete(id)
+	r.Cache.Invalidate(listKey, entityKey(id))
+	return err
+}
+
+func (r CachedRepo[T]) DeleteContext(ctx context.Context, id string) error {
+	err := deleteContext(ctx, r.Repo, id)
+	r.Cache.Invalidate(listKey, entityKey(id))
+	return err
+}
+
+func (r CachedRepo[T]) Save(t T) error {
+	err := r.Repo.Save(t)
+	r.invalidate(t)
+	return err
+}
+
+func (r CachedRepo[T]) SaveContext(ctx context.Context, t T) error {
+	err := saveContext(ctx, r.Repo, t)
+	r.invalidate(t)
+	return err
+}
+
+func (r CachedRepo[T]) invalidate(t T) {
+	if id, err := GetID(t); err == nil {
+		r.Cache.Invalidate(listKey, entityKey(id))
+	} else {
+		r.Cache.Purge()
+	}
+}
+
+func (r CachedRepo[T]) SaveAll(ctx context.Context, ts []T) ([]app.BatchResult, error) {
+	defer r.Cache.Purge()
+	return SaveAll(ctx, r.Repo, ts, 0)
+}
+
+func (r CachedRepo[T]) DeleteAll(ctx context.Context, ids []string) ([]app.BatchResult, error) {
+	defer r.Cache.Purge()
+	return DeleteAll(ctx, r.Repo, ids, 0)
+}
+
+// Iterate returns the cached list or streams it from the repository, if it is an IterableRepository. A list which
+// has been streamed completely is cached.
+func (r CachedRepo[T]) Iterate(ctx context.Context) (Iterator[T], error) {
+	it, ok := r.Repo.(IterableRepository[T])
+	if !ok {
+		res, err := r.ListContext(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		return &sliceIterator[T]{values: res, pos: -1}, nil
+	}
+
+	fetch := func(ctx context.Context) (any, error) {
+		return r.fetchList(ctx)
+	}
+
+	if v, ok := r.Cache.cached(ctx, listKey, fetch); ok {
+		return &sliceIterator[T]{values: v.([]T), pos: -1}, nil
+	}
+
+	gen := r.Cache.begin()
+	inner, err := it.Iterate(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &recordingIterator[T]{Iterator: inner, done: func(res []T) {
+		r.Cache.put(listKey, res, gen)
+	}}, nil
+}
+
+// recordingIterator collects the streamed values and passes them to done, once the iteration has completed
+// without an error.
+type recordingIterator[T any] struct {
+	Iterator[T]
+	values []T
+	done   func(res []T)
+}
+
+func (it *recordingIterator[T]) Next() bool {
+	if it.Iterator.Next() {
+		it.values = append(it.values, it.Iterator.Value())
+		return true
+	}
+
+	if it.done != nil && it.Iterator.Err() == nil {
+		if it.values == nil {
+			it.values = []T{}
+		}
+
+		it.done(it.values)
+	}
+
+	it.done, it.values = nil, nil
+	return false
+}
+
+func entityKey(id string) string {
+	return "entity/" + id
+}
+
+// ETags remembers entity tags together with the according response bodies, so that a RESTRepo can perform
+// conditional GET requests and decode a 304 (not modified) response. It is safe for concurrent use and the zero
+// value is ready to use.
+type ETags struct {
+	// MaxEntries limits the amount of remembered responses. The least recently used one is evicted first.
+	// Zero means DefaultMaxEntries.
+	MaxEntries int
+
+	lock    sync.Mutex
+	entries map[string]etagEntry
+}
+
+type etagEntry struct {
+	tag         string
+	contentType string
+	body        []byte
+	used        time.Time
+}
+
+// NewETags allocates a new empty ETags store.
+func NewETags() *ETags {
+	return &ETags{entries: map[string]etagEntry{}}
+}
+
+// SharedETags returns the ETags registered with the given name or allocates a new one.
+func SharedETags(name string) *ETags {
+	sharedLock.Lock()
+	defer sharedLock.Unlock()
+
+	e, ok := sharedETags[name]
+	if !ok {
+		e = NewETags()
+		sharedETags[name] = e
+	}
+
+	return e
+}
+
+func (e *ETags) lookup(url string) (tag, contentType string, body []byte, ok bool) {
+	if e == nil {
+		return "", "", nil, false
+	}
+
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	entry, ok := e.entries[url]
+	if ok {
+		entry.used = time.Now()
+		e.entries[url] = entry
+	}
+
+	return entry.tag, entry.contentType, entry.body, ok
+}
+
+func (e *ETags) store(url, tag, contentType string, body []byte) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	if e.entries == nil {
+		e.entries = map[string]etagEntry{}
+	}
+
+	limit := e.MaxEntries
+	if limit <= 0 {
+		limit = DefaultMaxEntries
+	}
+
+	if _, ok := e.entries[url]; !ok && len(e.entries) >= limit {
+		var oldest string
+		for u, entry := range e.entries {
+			if oldest == "" || entry.used.Before(e.entries[oldest].used) {
+				oldest = u
+			}
+		}
+
+		delete(e.entries, oldest)
+	}
+
+	e.entries[url] = etagEntry{tag: tag, contentType: contentType, body: body, used: time.Now()}
+}
+
+func (e *ETags) forget(urls ...string) {
+	if e == nil {
+		return
+	}
+
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	for _, u := range urls {
+		delete(e.entries, u)
+	}
+}
@@ -0,0 +1,265 @@
+package rest
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type book struct {
+	ID    string `json:"id"`
+	Title string `json:"title"`
+}
+
+// countingRepo counts the calls of List and Load.
+type countingRepo struct {
+	*MemoryRepo[book]
+	lists, loads int32
+	block        chan struct{} // block delays List, if not nil
+}
+
+func (r *countingRepo) List() ([]book, error) {
+	atomic.AddInt32(&r.lists, 1)
+	if r.block != nil {
+		<-r.block
+	}
+
+	return r.MemoryRepo.List()
+}
+
+func (r *countingRepo) Load(id string) (book, error) {
+	atomic.AddInt32(&r.loads, 1)
+	return r.MemoryRepo.Load(id)
+}
+
+func newCountingRepo(books ...book) *countingRepo {
+	return &countingRepo{MemoryRepo: NewMemory(books...)}
+}
+
+func TestCacheTTL(t *testing.T) {
+	repo := newCountingRepo(book{ID: "1"})
+	cached := Cached[book](repo, NewCache(CacheOptions{TTL: time.Hour}))
+
+	for i := 0; i < 3; i++ {
+		if _, err := cached.List(); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := cached.Load("1"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if repo.lists != 1 || repo.loads != 1 {
+		t.Fatalf("expected a single fetch each, got %d lists and %d loads", repo.lists, repo.loads)
+	}
+
+	if err := cached.Save(book{ID: "1", Title: "changed"}); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := cached.Load("1")
+	if err != nil || b.Title != "changed" || repo.loads != 2 {
+		t.Fatalf("expected the saved entity to be fetched again, got %v %v after %d loads", b, err, repo.loads)
+	}
+}
+
+func TestCacheDoesNotResurrectInvalidated(t *testing.T) {
+	repo := newCountingRepo(book{ID: "1"})
+	repo.block = make(chan struct{})
+	cache := NewCache(CacheOptions{TTL: time.Hour})
+	cached := Cached[book](repo, cache)
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		if _, err := cached.List(); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	for atomic.LoadInt32(&repo.lists) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	cache.Invalidate(listKey)
+	close(repo.block)
+	wg.Wait()
+
+	if entries := cache.Inspect(); len(entries) != 0 {
+		t.Fatalf("the fetch started before the invalidation must not be cached, got %v", entries)
+	}
+}
+
+func TestCacheEviction(t *testing.T) {
+	repo := newCountingRepo(book{ID: "1"}, book{ID: "2"}, book{ID: "3"})
+	cache := NewCache(CacheOptions{TTL: time.Hour, MaxEntries: 2})
+	cached := Cached[book](repo, cache)
+
+	for _, id := range []string{"1", "2", "1", "3"} {
+		if _, err := cached.Load(id); err != nil {
+			t.Fatal(err)
+		}
+
+		time.Sleep(time.Millisecond) // make the usage distinguishable
+	}
+
+	entries := cache.Inspect()
+	if len(entries) != 2 || entries[0].Key != entityKey("1") || entries[1].Key != entityKey("3") {
+		t.Fatalf("expected the least recently used entry to be evicted, got %v", entries)
+	}
+}
+
+func TestCacheRevalidatesDetached(t *testing.T) {
+	repo := newCountingRepo(book{ID: "1"})
+	cache := NewCache(CacheOptions{TTL: time.Millisecond, StaleWhileRevalidate: time.Hour})
+	cached := Cached[book](repo, cache)
+
+	if _, err := cached.ListContext(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	time.Sleep(2 * time.Millisecond)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel() // the caller has gone away, but the stale value is still served and refreshed
+	if _, err := cache.get(ctx, listKey, func(ctx context.Context) (any, error) {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		return cached.fetchList(ctx)
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for atomic.LoadInt32(&repo.lists) < 2 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+
+	if n := atomic.LoadInt32(&repo.lists); n != 2 {
+		t.Fatalf("expected a background refresh, got %d lists", n)
+	}
+}
+
+func TestETagsEviction(t *testing.T) {
+	e := NewETags()
+	e.MaxEntries = 2
+	e.store("a", "1", "application/json", nil)
+	time.Sleep(time.Millisecond)
+	e.store("b", "2", "application/json", nil)
+	time.Sleep(time.Millisecond)
+	e.lookup("a")
+	e.store("c", "3", "application/json", nil)
+
+	if _, _, _, ok := e.lookup("b"); ok {
+		t.Fatal("expected the least recently used tag to be evicted")
+	}
+
+	for _, u := range []string{"a", "c"} {
+		if _, _, _, ok := e.lookup(u); !ok {
+			t.Fatalf("expected %s to be kept", u)
+		}
+	}
+}
+
+func TestZeroValues(t *testing.T) {
+	e := &ETags{MaxEntries: 1}
+	e.store("a", "1", "application/json", nil)
+	e.store("b", "2", "application/json", nil)
+	if _, _, _, ok := e.lookup("b"); !ok || len(e.entries) != 1 {
+		t.Fatal("expected a literal ETags store to remember and evict tags")
+	}
+
+	repo := newCountingRepo(book{ID: "1"})
+	cached := Cached[book](repo, &Cache{})
+	for i := 0; i < 2; i++ {
+		if list, err := cached.List(); err != nil || len(list) != 1 {
+			t.Fatal(list, err)
+		}
+	}
+
+	if repo.lists != 2 {
+		t.Fatalf("expected the zero Cache to fetch every time, got %d lists", repo.lists)
+	}
+
+	cached.Cache.Invalidate(listKey)
+	cached.Cache.Purge()
+}
+
+// etagServer serves the books with an ETag and counts the full and the not modified responses.
+func etagServer(t *testing.T, books []book) (*httptest.Server, *int32, *int32) {
+	var full, notModified int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			atomic.AddInt32(&notModified, 1)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+
+		atomic.AddInt32(&full, 1)
+		w.Header().Set("ETag", `"v1"`)
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(books); err != nil {
+			t.Error(err)
+		}
+	}))
+
+	return srv, &full, &notModified
+}
+
+func TestCachedIterate(t *testing.T) {
+	books := []book{{ID: "1"}, {ID: "2"}}
+	srv, full, notModified := etagServer(t, books)
+	defer srv.Close()
+
+	base, _ := url.Parse(srv.URL + "/books")
+	repo := RESTRepo[book]{Base: base, ETags: NewETags()}
+	cache := NewCache(CacheOptions{TTL: time.Hour})
+	cached := Cached[book](repo, cache)
+
+	for i := 0; i < 2; i++ {
+		it, err := Iterate[book](context.Background(), cached)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var got []book
+		for it.Next() {
+			got = append(got, it.Value())
+		}
+
+		if err := it.Close(); err != nil || it.Err() != nil || len(got) != 2 {
+			t.Fatalf("got %v %v %v", got, err, it.Err())
+		}
+	}
+
+	if *full != 1 || *notModified != 0 {
+		t.Fatalf("expected the streamed list to be cached, got %d full and %d conditional responses", *full, *notModified)
+	}
+
+	// the streamed body has been remembered with its tag, so that the server can answer with 304
+	cache.Purge()
+	res, err := Stencil[book](cached).(interface {
+		ListContext(ctx context.Context) ([]any, error)
+	}).ListContext(context.Background())
+	if err != nil || len(res) != 2 {
+		t.Fatal(res, err)
+	}
+
+	if *full != 1 || *notModified != 1 {
+		t.Fatalf("expected a conditional get, got %d full and %d conditional responses", *full, *notModified)
+	}
+
+	if list, err := repo.List(); err != nil || len(list) != 2 || *notModified != 2 {
+		t.Fatalf("expected List to use the same tags, got %v %v", list, err)
+	}
+}
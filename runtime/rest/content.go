@@ -0,0 +1,198 @@
+package rest
+
+import (
+	"context"
+	"github.com/gotrino/fusion/spec/app"
+	http2 "github.com/gotrino/fusion/spec/http"
+	"io"
+	"net/http"
+	"sync"
+)
+
+// ContentOptions declares how a RESTRepo transfers the binary content of an entity.
+type ContentOptions struct {
+	// Path is relative to the entity, like content for /api/documents/{id}/content. Defaults to content.
+	Path string
+	// Multipart is the form field name to post the file as multipart/form-data. If empty, the file is put raw
+	// with a Content-Disposition header.
+	Multipart string
+}
+
+// ContentRepository is an optional capability of a Repository, which streams the binary content of an entity.
+type ContentRepository interface {
+	Upload(ctx context.Context, id string, file app.File, progress app.Progress) error
+	Download(ctx context.Context, id string, progress app.Progress) (app.File, error)
+}
+
+func (r RESTRepo[T]) contentPath(id string) string {
+	p := r.Content.Path
+	if p == "" {
+		p = "content"
+	}
+
+	return id + "/" + p // not joined, which would resolve dot segments of the id
+}
+
+// Upload streams the file to the content of the entity, like PUT /api/documents/{id}/content. The upload is not
+// retried and the Timeout of the repository does not apply. The Content of the file is closed, even if the upload
+// fails.
+func (r RESTRepo[T]) Upload(ctx context.Context, id string, file app.File, progress app.Progress) error {
+	total := file.Size
+	if total < 0 {
+		total = -1
+	}
+
+	method := "PUT"
+	var body io.ReadCloser = file.Content
+	contentType := file.ContentType
+	if r.Content.Multipart != "" {
+		method = "POST"
+		body, contentType = http2.Multipart(r.Content.Multipart, file)
+		total = -1
+	}
+
+	// the transport closes the body only if the request has been sent, thus it is closed here again
+	closer := &closeOnce{Closer: body}
+	defer closer.Close()
+
+	req, err := r.req(ctx, method, r.contentPath(id), readCloser{Reader: http2.WithProgress(body, total, progress), Closer: closer})
+	if err != nil {
+		return err
+	}
+
+	if r.Content.Multipart == "" {
+		if file.Size >= 0 {
+			req.ContentLength = file.Size
+		}
+
+		req.Header.Set("Content-Disposition", http2.ContentDisposition(file.Name))
+	}
+
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+
+	req.Header.Set("Content-Type", contentType)
+	resp, err := r.do(req)
+	if err != nil {
+		return err
+	}
+
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusCreated, http.StatusAccepted, http.StatusNoContent:
+		r.ETags.forget(r.key(""), r.key(id))
+		return nil
+	default:
+		return http2.ResponseError(resp)
+	}
+}
+
+// Download streams the content of the entity, like GET /api/documents/{id}/content. The name of the file is taken
+// from the Content-Disposition header. The Content must be closed, which also releases the Timeout.
+func (r RESTRepo[T]) Download(ctx context.Context, id string, progress app.Progress) (app.File, error) {
+	ctx, cancel := r.bind(ctx)
+
+	req, err := r.req(ctx, "GET", r.contentPath(id), nil)
+	if err != nil {
+		cancel()
+		return app.File{}, err
+	}
+
+	resp, err := r.do(req)
+	if err != nil {
+		cancel()
+		return app.File{}, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		defer cancel()
+		defer resp.Body.Close()
+
+		return app.File{}, http2.ResponseError(resp)
+	}
+
+	resp.Body = cancelCloser{ReadCloser: resp.Body, cancel: cancel}
+	return http2.ReadFile(resp, progress), nil
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// closeOnce makes closing idempotent, so that a body may be closed by its owner and the transport.
+type closeOnce struct {
+	io.Closer
+	once sync.Once
+	err  error
+}
+
+func (c *closeOnce) Close() error {
+	c.once.Do(func() {
+		c.err = c.Closer.Close()
+	})
+
+	return c.err
+}
+
+func (s stencilAdapter[T]) Upload(ctx context.Context, id string, file app.File, progress app.Progress) error {
+	c, ok := s.impl.(ContentRepository)
+	if !ok {
+		return app.ErrFilesNotSupported
+	}
+
+	return c.Upload(ctx, id, file, progress)
+}
+
+func (s stencilAdapter[T]) Download(ctx context.Context, id string, progress app.Progress) (app.File, error) {
+	c, ok := s.impl.(ContentRepository)
+	if !ok {
+		return app.File{}, app.ErrFilesNotSupported
+	}
+
+	return c.Download(ctx, id, progress)
+}
+
+// Upload forwards to the decorated repository and invalidates the entity, whose metadata may have changed.
+func (r CachedRepo[T]) Upload(ctx context.Context, id string, file app.File, progress app.Progress) error {
+	c, ok := r.Repo.(ContentRepository)
+	if !ok {
+		return app.ErrFilesNotSupported
+	}
+
+	defer r.Cache.Invalidate(listKey, entityKey(id))
+
+	return c.Upload(ctx, id, file, progress)
+}
+
+// Download forwards to the decorated repository, the content itself is not cached.
+func (r CachedRepo[T]) Download(ctx context.Context, id string, progress app.Progress) (app.File, error) {
+	c, ok := r.Repo.(ContentRepository)
+	if !ok {
+		return app.File{}, app.ErrFilesNotSupported
+	}
+
+	return c.Download(ctx, id, progress)
+}
+
+// Upload forwards to the decorated repository. Files are never queued, so an upload fails while offline.
+func (r OfflineRepo[T]) Upload(ctx context.Context, id string, file app.File, progress app.Progress) error {
+	c, ok := r.Repo.(ContentRepository)
+	if !ok {
+		return app.ErrFilesNotSupported
+	}
+
+	return c.Upload(ctx, id, file, progress)
+}
+
+// Download forwards to the decorated repository.
+func (r OfflineRepo[T]) Download(ctx context.Context, id string, progress app.Progress) (app.File, error) {
+	c, ok := r.Repo.(ContentRepository)
+	if !ok {
+		return app.File{}, app.ErrFilesNotSupported
+	}
+
+	return c.Download(ctx, id, progress)
+}
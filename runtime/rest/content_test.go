@@ -0,0 +1,81 @@
+package rest
+
+import (
+	"context"
+	"github.com/gotrino/fusion/spec/app"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// trackedContent counts how often it has been closed.
+type trackedContent struct {
+	io.Reader
+	closed atomic.Int32
+}
+
+func (c *trackedContent) Close() error {
+	c.closed.Add(1)
+	return nil
+}
+
+func TestUploadClosesContent(t *testing.T) {
+	var received atomic.Value
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		buf, _ := io.ReadAll(r.Body)
+		received.Store(string(buf))
+		if strings.HasSuffix(r.URL.Path, "/rejected/content") {
+			w.WriteHeader(http.StatusRequestEntityTooLarge)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	ctx := serverContext(t, srv, app.Connection{})
+	tests := []struct {
+		name      string
+		multipart string
+		id        string
+		path      string // path of the resource, which fails the request if a placeholder is unbound
+		fails     bool
+	}{
+		{name: "raw", id: "1", path: "/docs"},
+		{name: "multipart", multipart: "file", id: "1", path: "/docs"},
+		{name: "rejected", id: "rejected", path: "/docs", fails: true},
+		{name: "rejected multipart", multipart: "file", id: "rejected", path: "/docs", fails: true},
+		{name: "invalid request", id: "1", path: "/{tenant}/docs", fails: true},
+		{name: "invalid multipart request", multipart: "file", id: "1", path: "/{tenant}/docs", fails: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := REST[book](ctx, tt.path)
+			repo.Content.Multipart = tt.multipart
+			content := &trackedContent{Reader: strings.NewReader("hello")}
+			err := repo.Upload(context.Background(), tt.id, app.File{Name: "a.txt", Size: 5, Content: content}, nil)
+			if (err != nil) != tt.fails {
+				t.Fatalf("unexpected error %v", err)
+			}
+
+			// a multipart body is written by a goroutine, which closes the content when it ends
+			deadline := time.Now().Add(5 * time.Second)
+			for content.closed.Load() == 0 && time.Now().Before(deadline) {
+				time.Sleep(time.Millisecond)
+			}
+
+			if n := content.closed.Load(); n != 1 {
+				t.Fatalf("expected the content to be closed once, got %d", n)
+			}
+
+			if !tt.fails && !strings.Contains(received.Load().(string), "hello") {
+				t.Fatalf("unexpected upload %q", received.Load())
+			}
+		})
+	}
+}
@@ -0,0 +1,351 @@
+package rest
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gotrino/fusion/spec/app"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// FileLayout determines how a FileRepo stores its entities.
+type FileLayout int
+
+const (
+	JSONFile      FileLayout = iota // JSONFile stores all entities as a single json array.
+	JSONLinesFile                   // JSONLinesFile stores one json entity per line.
+	JSONDir                         // JSONDir stores each entity in its own file {id}.json within a directory, where the id is encoded as a valid file name.
+)
+
+// File creates a repository for the given file or directory.
+func File[T any](path string, layout FileLayout) FileRepo[T] {
+	return FileRepo[T]{Path: path, Layout: layout}
+}
+
+// FileRepo is a Repository which keeps a collection of entities on the local disk, keyed by GetID. Each write
+// replaces the file atomically by renaming a temporary file and concurrent processes are serialized by an
+// advisory lock on the file {Path}.lock (or {Path}/.lock for a directory). A missing file is an empty collection.
+type FileRepo[T any] struct {
+	Path   string
+	Layout FileLayout
+}
+
+func (r FileRepo[T]) ToStencil() app.RepositoryImplStencil {
+	return Stencil[T](r)
+}
+
+// List returns all entities in file order or ordered by id for a directory.
+func (r FileRepo[T]) List() ([]T, error) {
+	unlock, err := r.lock(false)
+	if err != nil {
+		return nil, err
+	}
+
+	defer unlock()
+
+	if r.Layout == JSONDir {
+		return r.readDir()
+	}
+
+	res, _, err := r.readFile()
+	return res, err
+}
+
+// Load returns the entity or a NotFoundError.
+func (r FileRepo[T]) Load(id string) (T, error) {
+	var zero T
+	unlock, err := r.lock(false)
+	if err != nil {
+		return zero, err
+	}
+
+	defer unlock()
+
+	if r.Layout == JSONDir {
+		var t T
+		if err := readJSON(r.entityFile(id), &t); err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return zero, NotFoundError{ID: id}
+			}
+
+			return zero, err
+		}
+
+		return t, nil
+	}
+
+	all, ids, err := r.readFile()
+	if err != nil {
+		return zero, err
+	}
+
+	for i, other := range ids {
+		if other == id {
+			return all[i], nil
+		}
+	}
+
+	return zero, NotFoundError{ID: id}
+}
+
+// Delete removes the entity. Deleting a missing entity is not an error.
+func (r FileRepo[T]) Delete(id string) error {
+	unlock, err := r.lock(true)
+	if err != nil {
+		return err
+	}
+
+	defer unlock()
+
+	if r.Layout == JSONDir {
+		if err := os.Remove(r.entityFile(id)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+
+		return nil
+	}
+
+	all, ids, err := r.readFile()
+	if err != nil {
+		return err
+	}
+
+	for i, other := range ids {
+		if other == id {
+			return r.writeFile(append(all[:i], all[i+1:]...))
+		}
+	}
+
+	return nil
+}
+
+// Save creates or replaces the entity.
+func (r FileRepo[T]) Save(t T) error {
+	id, err := GetID(t)
+	if err != nil {
+		return err
+	}
+
+	unlock, err := r.lock(true)
+	if err != nil {
+		return err
+	}
+
+	defer unlock()
+
+	if r.Layout == JSONDir {
+		return WriteFileAtomic(r.entityFile(id), func(w io.Writer) error {
+			return json.NewEncoder(w).Encode(t)
+		})
+	}
+
+	all, ids, err := r.readFile()
+	if err != nil {
+		return err
+	}
+
+	for i, other := range ids {
+		if other == id {
+			all[i] = t
+			return r.writeFile(all)
+		}
+	}
+
+	return r.writeFile(append(all, t))
+}
+
+func (r FileRepo[T]) lock(exclusive bool) (func() error, error) {
+	dir, name := filepath.Dir(r.Path), r.Path+".lock"
+	if r.Layout == JSONDir {
+		dir, name = r.Path, filepath.Join(r.Path, ".lock")
+	}
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	return lockFile(name, exclusive)
+}
+
+func (r FileRepo[T]) entityFile(id string) string {
+	return filepath.Join(r.Path, fileName(id)+".json")
+}
+
+// reservedNames cannot be used as file names on Windows, regardless of the extension.
+var reservedNames = map[string]bool{"CON": true, "PRN": true, "AUX": true, "NUL": true}
+
+func init() {
+	for i := 1; i <= 9; i++ {
+		reservedNames[fmt.Sprintf("COM%d", i)] = true
+		reservedNames[fmt.Sprintf("LPT%d", i)] = true
+	}
+}
+
+// fileName encodes the id, so that it is a valid file name on all platforms. Letters, digits, '-', '_' and
+// inner dots are kept, all other bytes are written as %XX like in a url. The first letter of names reserved by
+// Windows, like CON or LPT1.txt, is encoded as well.
+func fileName(id string) string {
+	base, _, _ := strings.Cut(id, ".")
+	reserved := reservedNames[strings.ToUpper(base)]
+	var sb strings.Builder
+	for i := 0; i < len(id); i++ {
+		c := id[i]
+		keep := c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_' || c == '.' && i > 0
+		if keep && !(i == 0 && reserved) {
+			sb.WriteByte(c)
+		} else {
+			fmt.Fprintf(&sb, "%%%02X", c)
+		}
+	}
+
+	return sb.String()
+}
+
+// readFile returns all entities and their ids in file order.
+func (r FileRepo[T]) readFile() ([]T, []string, error) {
+	f, err := os.Open(r.Path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil, nil
+		}
+
+		return nil, nil, err
+	}
+
+	defer f.Close()
+
+	var res []T
+	dec := json.NewDecoder(bufio.NewReader(f))
+	if r.Layout == JSONLinesFile {
+		for dec.More() {
+			var t T
+			if err := dec.Decode(&t); err != nil {
+				return nil, nil, fmt.Errorf("cannot decode %s: %w", r.Path, err)
+			}
+
+			res = append(res, t)
+		}
+	} else if err := dec.Decode(&res); err != nil && !errors.Is(err, io.EOF) {
+		return nil, nil, fmt.Errorf("cannot decode %s: %w", r.Path, err)
+	}
+
+	ids := make([]string, 0, len(res))
+	for _, t := range res {
+		id, err := GetID(t)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		ids = append(ids, id)
+	}
+
+	return res, ids, nil
+}
+
+func (r FileRepo[T]) writeFile(all []T) error {
+	return WriteFileAtomic(r.Path, func(w io.Writer) error {
+		enc := json.NewEncoder(w)
+		if r.Layout == JSONLinesFile {
+			for _, t := range all {
+				if err := enc.Encode(t); err != nil {
+					return err
+				}
+			}
+
+			return nil
+		}
+
+		if all == nil {
+			all = []T{}
+		}
+
+		enc.SetIndent("", "  ")
+		return enc.Encode(all)
+	})
+}
+
+func (r FileRepo[T]) readDir() ([]T, error) {
+	files, err := os.ReadDir(r.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].Name() < files[j].Name()
+	})
+
+	var res []T
+	for _, file := range files {
+		if file.IsDir() || !strings.HasSuffix(file.Name(), ".json") {
+			continue
+		}
+
+		var t T
+		if err := readJSON(filepath.Join(r.Path, file.Name()), &t); err != nil {
+			return nil, err
+		}
+
+		res = append(res, t)
+	}
+
+	return res, nil
+}
+
+func readJSON(name string, v any) error {
+	f, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+
+	defer f.Close()
+
+	if err := json.NewDecoder(bufio.NewReader(f)).Decode(v); err != nil {
+		return fmt.Errorf("cannot decode %s: %w", name, err)
+	}
+
+	return nil
+}
+
+// WriteFileAtomic writes a temporary file next to the named file and renames it afterwards, so that readers
+// either see the old or the new content but never a partially written file.
+func WriteFileAtomic(name string, write func(w io.Writer) error) error {
+	dir := filepath.Dir(name)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(name)+".*.tmp")
+	if err != nil {
+		return err
+	}
+
+	defer os.Remove(tmp.Name()) // no-op after a successful rename
+
+	bw := bufio.NewWriter(tmp)
+	if err := write(bw); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := bw.Flush(); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), name)
+}
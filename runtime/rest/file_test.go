@@ -0,0 +1,50 @@
+package rest
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestFileName(t *testing.T) {
+	tests := []struct {
+		id   string
+		want string
+	}{
+		{"42", "42"},
+		{"a.b", "a.b"},
+		{".hidden", "%2Ehidden"},
+		{"a:b", "a%3Ab"},
+		{"a%2Fb/en", "a%252Fb%2Fen"},
+		{`<>"\|?*`, "%3C%3E%22%5C%7C%3F%2A"},
+		{"con", "%63on"},
+		{"LPT1.txt", "%4CPT1.txt"},
+		{"console", "console"},
+	}
+
+	for _, tt := range tests {
+		if got := fileName(tt.id); got != tt.want {
+			t.Errorf("%q: got %q, want %q", tt.id, got, tt.want)
+		}
+	}
+}
+
+func TestFileRepoDir(t *testing.T) {
+	repo := File[book](filepath.Join(t.TempDir(), "books"), JSONDir)
+	books := []book{{ID: "a:b"}, {ID: "CON"}, {ID: "x/y"}}
+	for _, b := range books {
+		if err := repo.Save(b); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, b := range books {
+		id, _ := GetID(b)
+		if got, err := repo.Load(id); err != nil || got != b {
+			t.Fatalf("%s: got %v %v", id, got, err)
+		}
+	}
+
+	if list, err := repo.List(); err != nil || len(list) != 3 {
+		t.Fatal(list, err)
+	}
+}
@@ -0,0 +1,347 @@
+package rest
+
+import (
+	"bytes"
+	"context"
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"github.com/gotrino/fusion/spec/app"
+	http2 "github.com/gotrino/fusion/spec/http"
+	"io"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// GraphQLQueries declares the documents of the repository operations. The Load and Delete documents receive the
+// variable $id and the Save document receives the variable $input. The result is taken from the only root field.
+type GraphQLQueries struct {
+	List   string
+	Load   string
+	Save   string
+	Delete string
+}
+
+// GraphQL creates a GraphQL repository for the given endpoint like /graphql. The requests are authorized and
+// protected by the circuit breaker like those of REST, but not retried, see postPolicy.
+func GraphQL[T any](ctx context.Context, endpoint string, collection, entity string) GraphQLRepo[T] {
+	base := REST[T](ctx, endpoint)
+	return GraphQLRepo[T]{
+		Context:        base.Context,
+		Endpoint:       base.Base,
+		WithRequest:    base.WithRequest,
+		Reauthenticate: base.Reauthenticate,
+		Client:         base.Client,
+		Resilience:     postPolicy(base.Resilience),
+		Collection:     collection,
+		Entity:         entity,
+	}
+}
+
+// GraphQLRepo maps the repository operations onto GraphQL queries and mutations. Documents which are not declared
+// in Queries are derived by convention, e.g. for the Collection books and the Entity book:
+//
+//	query { books { id title } }
+//	query ($id: ID!) { book(id: $id) { id title } }
+//	mutation ($input: BookInput!) { saveBook(input: $input) { __typename } }
+//	mutation ($id: ID!) { deleteBook(id: $id) }
+type GraphQLRepo[T any] struct {
+	Context     context.Context
+	Endpoint    *url.URL
+	WithRequest func(*http.Request) *http.Request
+	// Reauthenticate renews the credentials after a 401, see RESTRepo.
+	Reauthenticate func(rejected *http.Request) bool
+	Client         *http.Client
+	Resilience     app.Resilience
+	Timeout        time.Duration
+	Collection     string // Collection is the root field of the derived list query, like books.
+	Entity         string // Entity is the root field of the derived load query and the suffix of the mutations, like book.
+	Queries        GraphQLQueries
+	// Fields is the selection set of the derived queries. Defaults to all json field names of T.
+	Fields []string
+}
+
+// GraphQLError is a single entry of the errors array of a GraphQL response.
+type GraphQLError struct {
+	Message    string         `json:"message"`
+	Path       []any          `json:"path,omitempty"`
+	Extensions map[string]any `json:"extensions,omitempty"`
+}
+
+// Code returns the conventional extensions.code, like NOT_FOUND.
+func (e GraphQLError) Code() string {
+	code, _ := e.Extensions["code"].(string)
+	return code
+}
+
+// GraphQLErrors is the errors array of a GraphQL response, which is classified by the extension codes
+// NOT_FOUND, FORBIDDEN, UNAUTHENTICATED, INTERNAL_SERVER_ERROR and BAD_USER_INPUT.
+type GraphQLErrors []GraphQLError
+
+func (e GraphQLErrors) Error() string {
+	msgs := make([]string, 0, len(e))
+	for _, err := range e {
+		msgs = append(msgs, err.Message)
+	}
+
+	return "graphql: " + strings.Join(msgs, "; ")
+}
+
+func (e GraphQLErrors) has(code string) bool {
+	for _, err := range e {
+		if err.Code() == code {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (e GraphQLErrors) NotFound() bool {
+	return e.has("NOT_FOUND")
+}
+
+func (e GraphQLErrors) Forbidden() bool {
+	return e.has("FORBIDDEN")
+}
+
+func (e GraphQLErrors) Unauthenticated() bool {
+	return e.has("UNAUTHENTICATED")
+}
+
+func (e GraphQLErrors) InternalServerError() bool {
+	return e.has("INTERNAL_SERVER_ERROR")
+}
+
+// Unwrap returns an app.ValidationError, if the input has been rejected.
+func (e GraphQLErrors) Unwrap() error {
+	for _, err := range e {
+		if err.Code() == "BAD_USER_INPUT" {
+			return app.ValidationError{Message: err.Message}
+		}
+	}
+
+	return nil
+}
+
+type graphQLResponse struct {
+	Data   map[string]json.RawMessage `json:"data"`
+	Errors GraphQLErrors              `json:"errors"`
+}
+
+func (r GraphQLRepo[T]) ToStencil() app.RepositoryImplStencil {
+	return graphQLStencil[T]{stencilAdapter: newStencilAdapter[T](r), repo: r}
+}
+
+// Select returns a copy of the repository which only fetches the given fields.
+func (r GraphQLRepo[T]) Select(fields ...string) GraphQLRepo[T] {
+	r.Fields = fields
+	return r
+}
+
+func (r GraphQLRepo[T]) List() ([]T, error) {
+	return r.ListContext(r.Context)
+}
+
+func (r GraphQLRepo[T]) ListContext(ctx context.Context) ([]T, error) {
+	doc := r.Queries.List
+	if doc == "" {
+		doc = fmt.Sprintf("query { %s { %s } }", r.Collection, r.selection())
+	}
+
+	var res []T
+	if err := r.query(ctx, doc, nil, &res); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+func (r GraphQLRepo[T]) Load(id string) (T, error) {
+	return r.LoadContext(r.Context, id)
+}
+
+func (r GraphQLRepo[T]) LoadContext(ctx context.Context, id string) (T, error) {
+	doc := r.Queries.Load
+	if doc == "" {
+		doc = fmt.Sprintf("query ($id: ID!) { %s(id: $id) { %s } }", r.Entity, r.selection())
+	}
+
+	var res *T
+	if err := r.query(ctx, doc, map[string]any{"id": id}, &res); err != nil {
+		var zero T
+		return zero, err
+	}
+
+	if res == nil {
+		var zero T
+		return zero, NotFoundError{ID: id}
+	}
+
+	return *res, nil
+}
+
+func (r GraphQLRepo[T]) Delete(id string) error {
+	return r.DeleteContext(r.Context, id)
+}
+
+func (r GraphQLRepo[T]) DeleteContext(ctx context.Context, id string) error {
+	doc := r.Queries.Delete
+	if doc == "" {
+		doc = fmt.Sprintf("mutation ($id: ID!) { delete%s(id: $id) }", upperFirst(r.Entity))
+	}
+
+	return r.query(ctx, doc, map[string]any{"id": id}, nil)
+}
+
+func (r GraphQLRepo[T]) Save(t T) error {
+	return r.SaveContext(r.Context, t)
+}
+
+func (r GraphQLRepo[T]) SaveContext(ctx context.Context, t T) error {
+	doc := r.Queries.Save
+	if doc == "" {
+		name := upperFirst(r.Entity)
+		doc = fmt.Sprintf("mutation ($input: %sInput!) { save%s(input: $input) { __typename } }", name, name)
+	}
+
+	return r.query(ctx, doc, map[string]any{"input": t}, nil)
+}
+
+// query posts the document and decodes the only root field of the data into dst.
+func (r GraphQLRepo[T]) query(ctx context.Context, doc string, variables map[string]any, dst any) error {
+	ctx, cancel := withTimeout(ctx, r.Timeout)
+	defer cancel()
+
+	buf, err := json.Marshal(map[string]any{"query": doc, "variables": variables})
+	if err != nil {
+		return http2.HttpError{Status: http2.EncoderError, Cause: err}
+	}
+
+	endpoint := r.Endpoint
+	if endpoint == nil {
+		endpoint = defaultBase()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", endpoint.String(), bytes.NewReader(buf))
+	if err != nil {
+		panic(err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	resp, err := http2.SendAuthorized(r.Client, req, r.Resilience, r.WithRequest, r.Reauthenticate)
+	if err != nil {
+		return err
+	}
+
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return http2.HttpError{Cause: err}
+	}
+
+	var res graphQLResponse
+	decErr := json.Unmarshal(body, &res)
+	if len(res.Errors) > 0 {
+		return res.Errors
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		// the body has been consumed already, so the problem details are decoded from the read bytes
+		resp.Body = io.NopCloser(bytes.NewReader(body))
+		return http2.ResponseError(resp)
+	}
+
+	if decErr != nil {
+		return http2.HttpError{Status: http2.DecoderError, Cause: decErr}
+	}
+
+	if dst == nil {
+		return nil
+	}
+
+	if len(res.Data) != 1 {
+		return http2.HttpError{Status: http2.DecoderError, Cause: fmt.Errorf("expected a single root field but got %d", len(res.Data))}
+	}
+
+	for _, v := range res.Data {
+		if err := json.Unmarshal(v, dst); err != nil {
+			return http2.HttpError{Status: http2.DecoderError, Cause: err}
+		}
+	}
+
+	return nil
+}
+
+func (r GraphQLRepo[T]) selection() string {
+	if len(r.Fields) > 0 {
+		return strings.Join(r.Fields, " ")
+	}
+
+	var t T
+	return selectionOf(reflect.TypeOf(t), 0)
+}
+
+var textMarshaler = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+
+// selectionOf derives a selection set from the json field names of a struct, including nested structs.
+func selectionOf(t reflect.Type, depth int) string {
+	for t != nil && (t.Kind() == reflect.Pointer || t.Kind() == reflect.Slice || t.Kind() == reflect.Array) {
+		t = t.Elem()
+	}
+
+	if t == nil || t.Kind() != reflect.Struct || t.Implements(textMarshaler) || reflect.PointerTo(t).Implements(textMarshaler) || depth > 5 {
+		return ""
+	}
+
+	var fields []string
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "-" || !f.IsExported() {
+			continue
+		}
+
+		if f.Anonymous && name == "" {
+			if sub := selectionOf(f.Type, depth); sub != "" {
+				fields = append(fields, sub)
+			}
+
+			continue
+		}
+
+		if name == "" {
+			name = f.Name
+		}
+
+		if sub := selectionOf(f.Type, depth+1); sub != "" {
+			name += " { " + sub + " }"
+		}
+
+		fields = append(fields, name)
+	}
+
+	return strings.Join(fields, " ")
+}
+
+func upperFirst(s string) string {
+	r, n := utf8.DecodeRuneInString(s)
+	return string(unicode.ToUpper(r)) + s[n:]
+}
+
+// graphQLStencil additionally implements app.FieldSelector.
+type graphQLStencil[T any] struct {
+	stencilAdapter[T]
+	repo GraphQLRepo[T]
+}
+
+func (s graphQLStencil[T]) Select(fields ...string) app.RepositoryImplStencil {
+	return s.repo.Select(fields...).ToStencil()
+}
@@ -0,0 +1,187 @@
+package rest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/gotrino/fusion/spec/app"
+	http2 "github.com/gotrino/fusion/spec/http"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type graphQLRequest struct {
+	Query     string         `json:"query"`
+	Variables map[string]any `json:"variables"`
+}
+
+// graphQLServer records the requests and responds with the body returned by respond.
+func graphQLServer(t *testing.T, respond func(req graphQLRequest) (int, string)) (*httptest.Server, *[]graphQLRequest) {
+	var reqs []graphQLRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req graphQLRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Error(err)
+		}
+
+		reqs = append(reqs, req)
+		status, body := respond(req)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte(body))
+	}))
+
+	return srv, &reqs
+}
+
+func TestGraphQLQueries(t *testing.T) {
+	srv, reqs := graphQLServer(t, func(req graphQLRequest) (int, string) {
+		switch req.Variables["id"] {
+		case "1":
+			return 200, `{"data": {"book": {"id": "1", "title": "Dune"}}}`
+		case "2":
+			return 200, `{"data": {"book": null}}`
+		}
+
+		return 200, `{"data": {"books": [{"id": "1", "title": "Dune"}, {"id": "2", "title": "Emma"}]}}`
+	})
+	defer srv.Close()
+
+	repo := GraphQL[book](serverContext(t, srv, app.Connection{}), "/graphql", "books", "book")
+	list, err := repo.List()
+	if err != nil || len(list) != 2 || list[1].Title != "Emma" {
+		t.Fatal(list, err)
+	}
+
+	if b, err := repo.Load("1"); err != nil || b.Title != "Dune" {
+		t.Fatal(b, err)
+	}
+
+	var notFound NotFoundError
+	if _, err := repo.Load("2"); !errors.As(err, &notFound) {
+		t.Fatalf("expected a null entity to be not found, got %v", err)
+	}
+
+	if _, err := repo.Select("title").List(); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{
+		"query { books { id title } }",
+		"query ($id: ID!) { book(id: $id) { id title } }",
+		"query ($id: ID!) { book(id: $id) { id title } }",
+		"query { books { title } }",
+	}
+
+	for i, q := range want {
+		if (*reqs)[i].Query != q {
+			t.Errorf("request %d: got %q, want %q", i, (*reqs)[i].Query, q)
+		}
+	}
+}
+
+func TestGraphQLMutations(t *testing.T) {
+	srv, reqs := graphQLServer(t, func(req graphQLRequest) (int, string) {
+		return 200, `{"data": {"ignored": true}}`
+	})
+	defer srv.Close()
+
+	repo := GraphQL[book](serverContext(t, srv, app.Connection{}), "/graphql", "books", "book")
+	if err := repo.Save(book{ID: "1", Title: "Dune"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := repo.Delete("1"); err != nil {
+		t.Fatal(err)
+	}
+
+	save, del := (*reqs)[0], (*reqs)[1]
+	if save.Query != "mutation ($input: BookInput!) { saveBook(input: $input) { __typename } }" {
+		t.Errorf("unexpected save mutation %q", save.Query)
+	}
+
+	if input, _ := save.Variables["input"].(map[string]any); input["title"] != "Dune" {
+		t.Errorf("expected the entity as input, got %v", save.Variables)
+	}
+
+	if del.Query != "mutation ($id: ID!) { deleteBook(id: $id) }" || del.Variables["id"] != "1" {
+		t.Errorf("unexpected delete mutation %q %v", del.Query, del.Variables)
+	}
+}
+
+func TestGraphQLErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		code  string
+		check func(err error) bool
+	}{
+		{"not found", "NOT_FOUND", func(err error) bool {
+			var e GraphQLErrors
+			return errors.As(err, &e) && e.NotFound()
+		}},
+		{"forbidden", "FORBIDDEN", func(err error) bool {
+			var e GraphQLErrors
+			return errors.As(err, &e) && e.Forbidden()
+		}},
+		{"unauthenticated", "UNAUTHENTICATED", func(err error) bool {
+			var e GraphQLErrors
+			return errors.As(err, &e) && e.Unauthenticated()
+		}},
+		{"validation", "BAD_USER_INPUT", func(err error) bool {
+			var e app.ValidationError
+			return errors.As(err, &e) && e.Message == "failed"
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, _ := graphQLServer(t, func(req graphQLRequest) (int, string) {
+				return 200, `{"data": null, "errors": [{"message": "failed", "extensions": {"code": "` + tt.code + `"}}]}`
+			})
+			defer srv.Close()
+
+			repo := GraphQL[book](serverContext(t, srv, app.Connection{}), "/graphql", "books", "book")
+			if err := repo.Save(book{ID: "1"}); !tt.check(err) {
+				t.Fatalf("unexpected classification of %v", err)
+			}
+		})
+	}
+}
+
+func TestGraphQLHTTPStatus(t *testing.T) {
+	for _, status := range []int{http.StatusUnauthorized, http.StatusServiceUnavailable} {
+		srv, _ := graphQLServer(t, func(req graphQLRequest) (int, string) {
+			return status, ""
+		})
+
+		repo := GraphQL[book](serverContext(t, srv, app.Connection{}), "/graphql", "books", "book")
+		_, err := repo.ListContext(context.Background())
+		var httpErr http2.HttpError
+		if !errors.As(err, &httpErr) || httpErr.Status != status {
+			t.Errorf("expected status %d, got %v", status, err)
+		}
+
+		srv.Close()
+	}
+}
+
+func TestGraphQLProblem(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", http2.ProblemContentType)
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		_, _ = w.Write([]byte(`{"title":"Invalid","invalid-params":[{"name":"title","reason":"required"}]}`))
+	}))
+	defer srv.Close()
+
+	repo := GraphQL[book](serverContext(t, srv, app.Connection{}), "/graphql", "books", "book")
+	err := repo.Save(book{ID: "1"})
+	var httpErr http2.HttpError
+	if !errors.As(err, &httpErr) || httpErr.Problem == nil || httpErr.Problem.Title != "Invalid" {
+		t.Fatalf("expected the problem details, got %v", err)
+	}
+
+	if fields := app.FieldErrors(err); len(fields) != 1 || fields[0].Field != "title" {
+		t.Fatalf("unexpected field errors %v", fields)
+	}
+}
@@ -0,0 +1,218 @@
+package rest
+
+import (
+	"encoding"
+	"fmt"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// idTag is the struct tag to mark one or more identifying fields, like `fusion:"id"`.
+const idTag = "fusion"
+
+var idFields sync.Map // reflect.Type => idMeta
+
+type idMeta struct {
+	fields [][]int // index paths into the struct, multiple paths mean a composite key
+	err    error
+}
+
+// GetID returns the id of the entity either by calling an ID() string method (value or pointer receiver), by
+// reading the fields tagged with `fusion:"id"` or by reading the field named ID. Tagged and ID fields may be
+// promoted from embedded structs. Multiple tagged fields represent a composite key like "42/en". Supported field
+// types are strings, integers and anything which implements encoding.TextMarshaler or fmt.Stringer, like the
+// common UUID types. Pointers to entities are dereferenced.
+//
+// The id is returned as is, e.g. for a json body or the key of a store. The segments of a composite key are joined
+// by a slash like "42/en". Only URLs contain the id escaped, see EscapeID.
+func GetID(a any) (string, error) {
+	if ider, ok := a.(interface{ ID() string }); ok {
+		return ider.ID(), nil
+	}
+
+	v := reflect.ValueOf(a)
+	if !v.IsValid() {
+		return "", fmt.Errorf("cannot get id of nil")
+	}
+
+	for v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			return "", fmt.Errorf("cannot get id of nil %T", a)
+		}
+
+		v = v.Elem()
+		if ider, ok := v.Interface().(interface{ ID() string }); ok {
+			return ider.ID(), nil
+		}
+	}
+
+	// also support pointer receivers for non-pointer entities
+	ptr := reflect.New(v.Type())
+	ptr.Elem().Set(v)
+	if ider, ok := ptr.Interface().(interface{ ID() string }); ok {
+		return ider.ID(), nil
+	}
+
+	v = ptr.Elem() // addressable, so that pointer receivers of fields are found
+
+	meta := idMetaOf(v.Type())
+	if meta.err != nil {
+		return "", meta.err
+	}
+
+	segments := make([]string, 0, len(meta.fields))
+	for _, index := range meta.fields {
+		f, err := v.FieldByIndexErr(index)
+		if err != nil {
+			return "", fmt.Errorf("cannot get id of %s: %w", v.Type(), err)
+		}
+
+		s, err := formatID(f)
+		if err != nil {
+			return "", fmt.Errorf("cannot get id of %s: %w", v.Type(), err)
+		}
+
+		segments = append(segments, s)
+	}
+
+	return strings.Join(segments, "/"), nil
+}
+
+// EscapeID path escapes each slash separated segment of the id or relative path, so that it can be attached to a
+// resource path, like "a b/en" to "a%20b/en". Thus the segments of a composite key become segments of the path.
+// The segments . and .. are escaped as well, so that they are not resolved.
+func EscapeID(id string) string {
+	segments := strings.Split(id, "/")
+	for i, s := range segments {
+		if s == "." || s == ".." {
+			segments[i] = strings.Repeat("%2E", len(s))
+		} else {
+			segments[i] = url.PathEscape(s)
+		}
+	}
+
+	return strings.Join(segments, "/")
+}
+
+// UnescapeID reverses EscapeID, e.g. for the escaped path of a request.
+func UnescapeID(escaped string) (string, error) {
+	segments := strings.Split(escaped, "/")
+	for i, s := range segments {
+		dec, err := url.PathUnescape(s)
+		if err != nil {
+			return "", err
+		}
+
+		segments[i] = dec
+	}
+
+	return strings.Join(segments, "/"), nil
+}
+
+func idMetaOf(t reflect.Type) idMeta {
+	if m, ok := idFields.Load(t); ok {
+		return m.(idMeta)
+	}
+
+	var meta idMeta
+	if t.Kind() != reflect.Struct {
+		meta.err = fmt.Errorf("type %s must either provide 'ID() string' method or an id field", t)
+	} else {
+		meta.fields = taggedFields(t, nil)
+		if len(meta.fields) == 0 {
+			if f, ok := t.FieldByName("ID"); ok {
+				meta.fields = [][]int{f.Index}
+			}
+		}
+
+		if len(meta.fields) == 0 {
+			meta.err = fmt.Errorf("type %s must either provide 'ID() string' method, an 'ID' field or fields tagged with `fusion:\"id\"`", t)
+		}
+	}
+
+	idFields.Store(t, meta)
+	return meta
+}
+
+// taggedFields collects the index paths of all fields tagged as id in declaration order, including embedded structs.
+func taggedFields(t reflect.Type, parent []int) [][]int {
+	var res [][]int
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		index := append(append([]int{}, parent...), i)
+		if tagged(f) {
+			res = append(res, index)
+			continue
+		}
+
+		ft := f.Type
+		if ft.Kind() == reflect.Pointer {
+			ft = ft.Elem()
+		}
+
+		if f.Anonymous && ft.Kind() == reflect.Struct {
+			res = append(res, taggedFields(ft, index)...)
+		}
+	}
+
+	return res
+}
+
+func tagged(f reflect.StructField) bool {
+	for _, opt := range strings.Split(f.Tag.Get(idTag), ",") {
+		if opt == "id" {
+			return true
+		}
+	}
+
+	return false
+}
+
+// formatID converts a supported id value into its string representation.
+func formatID(v reflect.Value) (string, error) {
+	if v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			return "", fmt.Errorf("id is nil")
+		}
+
+		v = v.Elem()
+	}
+
+	if v.CanInterface() {
+		if s, ok, err := formatInterface(v.Interface()); ok {
+			return s, err
+		}
+
+		if v.CanAddr() {
+			if s, ok, err := formatInterface(v.Addr().Interface()); ok {
+				return s, err
+			}
+		}
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		return v.String(), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(v.Uint(), 10), nil
+	default:
+		return "", fmt.Errorf("unsupported id type %s", v.Type())
+	}
+}
+
+func formatInterface(i any) (string, bool, error) {
+	switch t := i.(type) {
+	case encoding.TextMarshaler:
+		buf, err := t.MarshalText()
+		return string(buf), true, err
+	case fmt.Stringer:
+		return t.String(), true, nil
+	default:
+		return "", false, nil
+	}
+}
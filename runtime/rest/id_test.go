@@ -0,0 +1,115 @@
+package rest
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/gotrino/fusion/spec/app"
+	"net/url"
+	"testing"
+)
+
+type translation struct {
+	BookID int    `fusion:"id"`
+	Lang   string `fusion:"id"`
+}
+
+type named struct{ Name string }
+
+func (n named) ID() string { return n.Name }
+
+func TestGetID(t *testing.T) {
+	tests := []struct {
+		entity any
+		want   string
+	}{
+		{book{ID: "42"}, "42"},
+		{&book{ID: "a b"}, "a b"},
+		{book{ID: "a/b"}, "a/b"},
+		{translation{BookID: 42, Lang: "en"}, "42/en"},
+		{translation{BookID: 42, Lang: "a b"}, "42/a b"},
+		{named{Name: "x?y"}, "x?y"},
+	}
+
+	for _, tt := range tests {
+		got, err := GetID(tt.entity)
+		if err != nil || got != tt.want {
+			t.Errorf("%#v: got %q %v, want %q", tt.entity, got, err, tt.want)
+		}
+	}
+
+	for _, entity := range []any{nil, (*book)(nil), 42} {
+		if _, err := GetID(entity); err == nil {
+			t.Errorf("%#v: expected an error", entity)
+		}
+	}
+}
+
+func TestURLEscapesIDs(t *testing.T) {
+	base, _ := url.Parse("http://localhost/api/books")
+	repo := RESTRepo[book]{Base: base}
+
+	tests := []struct {
+		entity any
+		want   string
+	}{
+		{book{ID: "a b"}, "http://localhost/api/books/a%20b"},
+		{book{ID: "a?b#c"}, "http://localhost/api/books/a%3Fb%23c"},
+		{book{ID: "../admin"}, "http://localhost/api/books/%2E%2E/admin"},
+		{translation{BookID: 1, Lang: "a b"}, "http://localhost/api/books/1/a%20b"},
+	}
+
+	for _, tt := range tests {
+		id, err := GetID(tt.entity)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got := repo.key(id); got != tt.want {
+			t.Errorf("got %s, want %s", got, tt.want)
+		}
+
+		if unescaped, err := UnescapeID(EscapeID(id)); err != nil || unescaped != id {
+			t.Errorf("expected %q to survive escaping, got %q %v", id, unescaped, err)
+		}
+	}
+}
+
+func TestIDsAreRawOutsideOfURLs(t *testing.T) {
+	const id = "a b/c"
+	entity := book{ID: id}
+
+	mem := NewMemory(entity)
+	if _, err := mem.Load(id); err != nil {
+		t.Fatalf("expected the memory store to be keyed by the raw id, got %v", err)
+	}
+
+	var deleted []string
+	srv := rpcServer(t, func(method string, params json.RawMessage) (any, *RPCError) {
+		var args []string
+		_ = json.Unmarshal(params, &args)
+		deleted = append(deleted, args...)
+		return true, nil
+	})
+	defer srv.Close()
+
+	rpc := JSONRPC[book](serverContext(t, srv, app.Connection{}), "/rpc", RPCMethods{Delete: "books.delete"})
+	if err := Stencil[book](rpc).Delete(id); err != nil {
+		t.Fatal(err)
+	}
+
+	got, _ := GetID(entity)
+	if _, err := rpc.DeleteAll(context.Background(), []string{got}); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(deleted) != 2 || deleted[0] != id || deleted[1] != id {
+		t.Fatalf("expected the raw id as parameter, got %q", deleted)
+	}
+
+	s := &stream[book]{}
+	fromEntity, _ := s.decode(rawEvent{typ: "created", data: []byte(`{"id":"a b/c"}`)})
+	fromEnvelope, _ := s.decode(rawEvent{typ: "deleted", entityID: id})
+	if fromEntity.ID != id || fromEnvelope.ID != id {
+		t.Fatalf("expected the same event id, got %q and %q", fromEntity.ID, fromEnvelope.ID)
+	}
+}
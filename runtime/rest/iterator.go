@@ -0,0 +1,311 @@
+package rest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/gotrino/fusion/spec/app"
+	http2 "github.com/gotrino/fusion/spec/http"
+	"io"
+	"net/http"
+)
+
+// Iterator streams the entities of a list, so that only a single element is decoded at a time:
+//
+//	it, err := rest.Iterate(ctx, repo)
+//	...
+//	defer it.Close()
+//	for it.Next() {
+//		use(it.Value())
+//	}
+//
+//	return it.Err()
+type Iterator[T any] interface {
+	Next() bool
+	Value() T
+	// Err returns the error which has stopped the iteration, if any.
+	Err() error
+	// Close releases the underlying connection. It must be called, even if Next has returned false.
+	Close() error
+}
+
+// IterableRepository is an optional capability of a Repository, which streams the list.
+type IterableRepository[T any] interface {
+	Iterate(ctx context.Context) (Iterator[T], error)
+}
+
+// Iterate streams the list of the repository or falls back to the complete list, if the repository is not an
+// IterableRepository.
+func Iterate[T any](ctx context.Context, repo Repository[T]) (Iterator[T], error) {
+	if it, ok := repo.(IterableRepository[T]); ok {
+		return it.Iterate(ctx)
+	}
+
+	res, err := listContext(ctx, repo)
+	if err != nil {
+		return nil, err
+	}
+
+	return &sliceIterator[T]{values: res, pos: -1}, nil
+}
+
+// StreamJSON decodes the elements of the json array one by one. The reader is closed by Close.
+func StreamJSON[T any](r io.ReadCloser) Iterator[T] {
+	return &jsonIterator[T]{body: r, dec: json.NewDecoder(r), array: true}
+}
+
+// StreamNDJSON decodes one json value per line. The reader is closed by Close.
+func StreamNDJSON[T any](r io.ReadCloser) Iterator[T] {
+	return &jsonIterator[T]{body: r, dec: json.NewDecoder(r)}
+}
+
+// Iterate performs a get on the root resource like List but decodes the elements while they arrive. Json arrays
+// and ndjson are streamed, other codecs are decoded at once. Like List, Iterate performs a conditional get, if
+// ETags are available, and remembers a completely read body.
+func (r RESTRepo[T]) Iterate(ctx context.Context) (Iterator[T], error) {
+	ctx, cancel := r.bind(ctx)
+
+	req, err := r.req(ctx, "GET", "", nil)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	req.Header.Set("Accept", http2.Accept(r.codecs()...))
+	key := req.URL.String()
+	if tag, _, _, ok := r.ETags.lookup(key); ok {
+		req.Header.Set("If-None-Match", tag)
+	}
+
+	resp, err := r.do(req)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	var body io.ReadCloser = cancelCloser{ReadCloser: resp.Body, cancel: cancel}
+	contentType := resp.Header.Get("Content-Type")
+	switch resp.StatusCode {
+	case http.StatusOK:
+		if tag := resp.Header.Get("ETag"); tag != "" && r.ETags != nil {
+			body = &etagBody{ReadCloser: body, store: func(buf []byte) {
+				r.ETags.store(key, tag, contentType, buf)
+			}}
+		}
+	case http.StatusNotModified:
+		_, cached, buf, ok := r.ETags.lookup(key)
+		if !ok {
+			defer body.Close()
+			return nil, http2.ResponseError(resp)
+		}
+
+		resp.Body.Close()
+		contentType = cached
+		body = cancelCloser{ReadCloser: io.NopCloser(bytes.NewReader(buf)), cancel: cancel}
+	default:
+		defer body.Close()
+		return nil, http2.ResponseError(resp)
+	}
+
+	switch c := r.codec(contentType).(type) {
+	case http2.JSON:
+		return &jsonIterator[T]{body: body, dec: c.NewDecoder(body), array: true}, nil
+	case http2.NDJSON:
+		return &jsonIterator[T]{body: body, dec: c.JSON.NewDecoder(body)}, nil
+	default:
+		defer body.Close()
+
+		var res []T
+		if err := c.Decode(body, &res); err != nil {
+			return nil, http2.HttpError{Status: http2.DecoderError, Cause: err}
+		}
+
+		return &sliceIterator[T]{values: res, pos: -1}, nil
+	}
+}
+
+// etagBody records the streamed body, so that it is remembered together with its ETag, once it has been read
+// completely.
+type etagBody struct {
+	io.ReadCloser
+	buf   bytes.Buffer
+	eof   bool
+	store func(buf []byte)
+}
+
+func (b *etagBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.buf.Write(p[:n])
+	if err == io.EOF {
+		b.eof = true
+	}
+
+	return n, err
+}
+
+func (b *etagBody) Close() error {
+	if !b.eof {
+		// a completely decoded body is at most followed by some whitespace
+		_, _ = io.Copy(io.Discard, io.LimitReader(b, 4096))
+	}
+
+	if b.eof {
+		b.store(b.buf.Bytes())
+	}
+
+	return b.ReadCloser.Close()
+}
+
+// cancelCloser releases the context of the request when the body is closed.
+type cancelCloser struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (c cancelCloser) Close() error {
+	defer c.cancel()
+	return c.ReadCloser.Close()
+}
+
+type jsonIterator[T any] struct {
+	body    io.Closer
+	dec     *json.Decoder
+	array   bool
+	started bool
+	done    bool // done is set after the last element, so that further calls neither read nor fail
+	value   T
+	err     error
+}
+
+func (it *jsonIterator[T]) Next() bool {
+	if it.err != nil || it.done {
+		return false
+	}
+
+	if it.array && !it.started {
+		it.started = true
+		tok, err := it.dec.Token()
+		if err != nil {
+			it.fail(err)
+			return false
+		}
+
+		if tok == nil {
+			it.done = true
+			return false // null is an empty list
+		}
+
+		if delim, ok := tok.(json.Delim); !ok || delim != '[' {
+			it.fail(fmt.Errorf("expected a json array but found %v", tok))
+			return false
+		}
+	}
+
+	if !it.dec.More() {
+		it.done = true
+		if it.array {
+			if _, err := it.dec.Token(); err != nil {
+				it.fail(err)
+			}
+		}
+
+		return false
+	}
+
+	var t T
+	if err := it.dec.Decode(&t); err != nil {
+		it.fail(err)
+		return false
+	}
+
+	it.value = t
+	return true
+}
+
+func (it *jsonIterator[T]) fail(err error) {
+	it.done = true
+	it.err = http2.HttpError{Status: http2.DecoderError, Cause: err}
+}
+
+func (it *jsonIterator[T]) Value() T {
+	return it.value
+}
+
+func (it *jsonIterator[T]) Err() error {
+	return it.err
+}
+
+func (it *jsonIterator[T]) Close() error {
+	return it.body.Close()
+}
+
+type sliceIterator[T any] struct {
+	values []T
+	pos    int
+}
+
+func (it *sliceIterator[T]) Next() bool {
+	if it.pos+1 >= len(it.values) {
+		it.values = nil // release the elements early
+		return false
+	}
+
+	it.pos++
+	return true
+}
+
+func (it *sliceIterator[T]) Value() T {
+	return it.values[it.pos]
+}
+
+func (it *sliceIterator[T]) Err() error {
+	return nil
+}
+
+func (it *sliceIterator[T]) Close() error {
+	return nil
+}
+
+// Iterate boxes the elements one by one, see app.IterableImplStencil.
+func (s stencilAdapter[T]) Iterate(ctx context.Context) (app.Iterator, error) {
+	it, err := Iterate(ctx, s.impl)
+	if err != nil {
+		return nil, err
+	}
+
+	return boxedIterator[T]{it}, nil
+}
+
+type boxedIterator[T any] struct {
+	Iterator[T]
+}
+
+func (it boxedIterator[T]) Value() any {
+	return it.Iterator.Value()
+}
+
+// collect boxes the streamed elements directly, to avoid holding the typed and the boxed list at the same time.
+func collect[T any](ctx context.Context, repo IterableRepository[T]) ([]any, error) {
+	it, err := repo.Iterate(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	defer it.Close()
+
+	var res []any
+	for it.Next() {
+		res = append(res, it.Value())
+	}
+
+	if err := it.Err(); err != nil {
+		return nil, err
+	}
+
+	if res == nil {
+		res = []any{}
+	}
+
+	return res, nil
+}
@@ -0,0 +1,146 @@
+package rest
+
+import (
+	"context"
+	"errors"
+	"github.com/gotrino/fusion/spec/app"
+	http2 "github.com/gotrino/fusion/spec/http"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func drain[T any](it Iterator[T]) []T {
+	var res []T
+	for it.Next() {
+		res = append(res, it.Value())
+	}
+
+	return res
+}
+
+func TestStreamJSON(t *testing.T) {
+	tests := []struct {
+		name   string
+		body   string
+		ndjson bool
+		want   int
+		fails  bool
+	}{
+		{"array", `[{"id":"1"},{"id":"2"}]`, false, 2, false},
+		{"empty", `[]`, false, 0, false},
+		{"null", `null`, false, 0, false},
+		{"object", `{"id":"1"}`, false, 0, true},
+		{"truncated", `[{"id":"1"},{"id"`, false, 1, true},
+		{"unterminated", `[{"id":"1"}`, false, 1, true},
+		{"ndjson", "{\"id\":\"1\"}\n{\"id\":\"2\"}\n", true, 2, false},
+		{"ndjson invalid", "{\"id\":\"1\"}\nnope\n", true, 1, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := io.NopCloser(strings.NewReader(tt.body))
+			it := StreamJSON[book](body)
+			if tt.ndjson {
+				it = StreamNDJSON[book](body)
+			}
+
+			got := drain(it)
+			if len(got) != tt.want {
+				t.Fatalf("expected %d elements, got %v", tt.want, got)
+			}
+
+			var httpErr http2.HttpError
+			if fails := errors.As(it.Err(), &httpErr) && httpErr.Status == http2.DecoderError; fails != tt.fails {
+				t.Fatalf("unexpected error %v", it.Err())
+			}
+
+			err := it.Err()
+			for i := 0; i < 2; i++ {
+				if it.Next() || it.Err() != err {
+					t.Fatalf("expected a finished iterator to stay finished, got %v", it.Err())
+				}
+			}
+		})
+	}
+}
+
+func TestRESTIterate(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/books":
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = io.WriteString(w, `[{"id":"1","title":"Dune"},{"id":"2"}]`)
+		case "/ndjson":
+			w.Header().Set("Content-Type", "application/x-ndjson")
+			_, _ = io.WriteString(w, "{\"id\":\"1\"}\n{\"id\":\"2\"}\n{\"id\":\"3\"}\n")
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	ctx := serverContext(t, srv, app.Connection{})
+	for path, want := range map[string]int{"/books": 2, "/ndjson": 3} {
+		repo := REST[book](ctx, path)
+		repo.Codecs = []http2.Codec{http2.JSON{}, http2.NDJSON{}}
+		it, err := repo.Iterate(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		got := drain(it)
+		if err := it.Close(); err != nil || it.Err() != nil || len(got) != want || got[0].ID != "1" {
+			t.Fatalf("%s: got %v %v %v", path, got, err, it.Err())
+		}
+	}
+
+	_, err := REST[book](ctx, "/missing").Iterate(context.Background())
+	if !app.NotFound(err) {
+		t.Fatalf("expected not found, got %v", err)
+	}
+}
+
+func TestRESTIterateReleasesTimeout(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = io.WriteString(w, `[{"id":"1"},`)
+		w.(http.Flusher).Flush()
+		<-r.Context().Done() // the rest of the list never arrives
+	}))
+	defer srv.Close()
+
+	repo := REST[book](serverContext(t, srv, app.Connection{}), "/books")
+	repo.Timeout = 50 * time.Millisecond
+	it, err := repo.Iterate(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer it.Close()
+
+	if !it.Next() || it.Value().ID != "1" {
+		t.Fatal("expected the first element before the list has been completed")
+	}
+
+	if it.Next() || it.Err() == nil {
+		t.Fatal("expected the timeout to stop the iteration")
+	}
+}
+
+func TestIterateFallback(t *testing.T) {
+	repo := NewMemory(book{ID: "1"}, book{ID: "2"})
+	it, err := Iterate[book](context.Background(), repo)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer it.Close()
+
+	if got := drain(it); len(got) != 2 || it.Err() != nil {
+		t.Fatalf("got %v %v", got, it.Err())
+	}
+}
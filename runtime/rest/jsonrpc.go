@@ -0,0 +1,350 @@
+package rest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/gotrino/fusion/spec/app"
+	http2 "github.com/gotrino/fusion/spec/http"
+	"net/http"
+	"net/url"
+	"sync/atomic"
+	"time"
+)
+
+var rpcIDs int64
+
+// RPCMethods declares the JSON-RPC method names of the repository operations, like books.list.
+type RPCMethods struct {
+	List   string
+	Load   string
+	Save   string
+	Delete string
+}
+
+// JSONRPC creates a JSON-RPC 2.0 repository for the given endpoint like /rpc. The requests are authorized and
+// protected by the circuit breaker like those of REST, but not retried, see postPolicy.
+func JSONRPC[T any](ctx context.Context, endpoint string, methods RPCMethods) JSONRPCRepo[T] {
+	base := REST[T](ctx, endpoint)
+	return JSONRPCRepo[T]{
+		Context:        base.Context,
+		Endpoint:       base.Base,
+		Methods:        methods,
+		WithRequest:    base.WithRequest,
+		Reauthenticate: base.Reauthenticate,
+		Client:         base.Client,
+		Resilience:     postPolicy(base.Resilience),
+	}
+}
+
+// JSONRPCRepo maps the repository operations onto JSON-RPC 2.0 calls, which are posted to a single http endpoint.
+// Load and Delete pass the id and Save passes the entity as the only parameter.
+type JSONRPCRepo[T any] struct {
+	Context     context.Context
+	Endpoint    *url.URL
+	Methods     RPCMethods
+	WithRequest func(*http.Request) *http.Request
+	// Reauthenticate renews the credentials after a 401, see RESTRepo.
+	Reauthenticate func(rejected *http.Request) bool
+	Client         *http.Client
+	Resilience     app.Resilience
+	Timeout        time.Duration
+	// Named passes parameters by name, like {"id":"42"} or {"entity":{...}}, instead of by position.
+	Named bool
+	// Statuses maps server defined error codes onto http status codes, which classify an RPCError,
+	// e.g. -32004 => http.StatusNotFound.
+	Statuses map[int]int
+}
+
+// RPCCall is a single call of a batch. After the batch has been performed, the result has been decoded into Result
+// (if not nil) or Err contains the failure of this call.
+type RPCCall struct {
+	Method string
+	Params any
+	Result any
+	Err    error
+}
+
+// RPCError is the error object of a JSON-RPC response. The Status is derived from the Statuses of the repository and
+// classifies the error like a http.HttpError.
+type RPCError struct {
+	Code    int             `json:"code"`
+	Message string          `json:"message"`
+	Data    json.RawMessage `json:"data,omitempty"`
+	Status  int             `json:"-"`
+}
+
+func (e RPCError) Error() string {
+	return fmt.Sprintf("json-rpc error %d: %s", e.Code, e.Message)
+}
+
+func (e RPCError) NotFound() bool {
+	return e.Status == http.StatusNotFound
+}
+
+func (e RPCError) Forbidden() bool {
+	return e.Status == http.StatusForbidden
+}
+
+func (e RPCError) Unauthenticated() bool {
+	return e.Status == http.StatusUnauthorized
+}
+
+func (e RPCError) InternalServerError() bool {
+	return e.Code == -32603 || e.Status >= http.StatusInternalServerError
+}
+
+func (e RPCError) ProtocolError() bool {
+	return e.Code == -32700 || e.Code == -32600 || e.Code == -32601
+}
+
+func (e RPCError) FailedValidation() bool {
+	return e.Code == -32602 || e.Status == http.StatusBadRequest || e.Status == http.StatusUnprocessableEntity
+}
+
+type rpcRequest struct {
+	JSONRPC string `json:"jsonrpc"`
+	Method  string `json:"method"`
+	Params  any    `json:"params,omitempty"`
+	ID      int64  `json:"id"`
+}
+
+type rpcResponse struct {
+	Result json.RawMessage `json:"result"`
+	Error  *RPCError       `json:"error"`
+	ID     int64           `json:"id"`
+}
+
+func (r JSONRPCRepo[T]) ToStencil() app.RepositoryImplStencil {
+	return Stencil[T](r)
+}
+
+func (r JSONRPCRepo[T]) List() ([]T, error) {
+	return r.ListContext(r.Context)
+}
+
+func (r JSONRPCRepo[T]) ListContext(ctx context.Context) ([]T, error) {
+	var res []T
+	if err := r.call(ctx, r.Methods.List, nil, &res); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+func (r JSONRPCRepo[T]) Load(id string) (T, error) {
+	return r.LoadContext(r.Context, id)
+}
+
+// LoadContext is like Load but bound to the given context. A null result is a NotFoundError.
+func (r JSONRPCRepo[T]) LoadContext(ctx context.Context, id string) (T, error) {
+	var res T
+	var raw json.RawMessage
+	if err := r.call(ctx, r.Methods.Load, r.params("id", id), &raw); err != nil {
+		return res, err
+	}
+
+	if len(raw) == 0 || string(raw) == "null" {
+		return res, NotFoundError{ID: id}
+	}
+
+	if err := json.Unmarshal(raw, &res); err != nil {
+		return res, http2.HttpError{Status: http2.DecoderError, Cause: err}
+	}
+
+	return res, nil
+}
+
+func (r JSONRPCRepo[T]) Delete(id string) error {
+	return r.DeleteContext(r.Context, id)
+}
+
+func (r JSONRPCRepo[T]) DeleteContext(ctx context.Context, id string) error {
+	return r.call(ctx, r.Methods.Delete, r.params("id", id), nil)
+}
+
+func (r JSONRPCRepo[T]) Save(t T) error {
+	return r.SaveContext(r.Context, t)
+}
+
+func (r JSONRPCRepo[T]) SaveContext(ctx context.Context, t T) error {
+	return r.call(ctx, r.Methods.Save, r.params("entity", t), nil)
+}
+
+// SaveAll performs a single batch request with a save call for each entity.
+func (r JSONRPCRepo[T]) SaveAll(ctx context.Context, ts []T) ([]app.BatchResult, error) {
+	calls := make([]RPCCall, 0, len(ts))
+	for _, t := range ts {
+		calls = append(calls, RPCCall{Method: r.Methods.Save, Params: r.params("entity", t)})
+	}
+
+	return r.batchResult(ctx, calls, func(i int) string {
+		id, _ := GetID(ts[i])
+		return id
+	})
+}
+
+// DeleteAll performs a single batch request with a delete call for each id.
+func (r JSONRPCRepo[T]) DeleteAll(ctx context.Context, ids []string) ([]app.BatchResult, error) {
+	calls := make([]RPCCall, 0, len(ids))
+	for _, id := range ids {
+		calls = append(calls, RPCCall{Method: r.Methods.Delete, Params: r.params("id", id)})
+	}
+
+	return r.batchResult(ctx, calls, func(i int) string {
+		return ids[i]
+	})
+}
+
+func (r JSONRPCRepo[T]) batchResult(ctx context.Context, calls []RPCCall, id func(i int) string) ([]app.BatchResult, error) {
+	ids := make([]string, 0, len(calls))
+	for i := range calls {
+		ids = append(ids, id(i))
+	}
+
+	if err := r.Batch(ctx, calls); err != nil {
+		return sameResult(ids, err)
+	}
+
+	res := make([]app.BatchResult, 0, len(calls))
+	for i, c := range calls {
+		res = append(res, app.BatchResult{ID: ids[i], Err: c.Err})
+	}
+
+	return batchResult(res)
+}
+
+// Batch sends all calls within a single http request. The returned error only describes failures of the whole
+// batch, like transport failures or a single error object, which servers respond if they cannot parse the batch.
+// The outcome of each call is stored within the call itself.
+func (r JSONRPCRepo[T]) Batch(ctx context.Context, calls []RPCCall) error {
+	if len(calls) == 0 {
+		return nil
+	}
+
+	reqs := make([]rpcRequest, 0, len(calls))
+	byID := map[int64]int{}
+	for i, c := range calls {
+		req := newRPCRequest(c.Method, c.Params)
+		byID[req.ID] = i
+		reqs = append(reqs, req)
+	}
+
+	var raw json.RawMessage
+	if err := r.post(ctx, reqs, &raw); err != nil {
+		return err
+	}
+
+	var res []rpcResponse
+	if trimmed := bytes.TrimSpace(raw); len(trimmed) > 0 && trimmed[0] == '{' {
+		var single rpcResponse
+		if err := json.Unmarshal(trimmed, &single); err != nil {
+			return http2.HttpError{Status: http2.DecoderError, Cause: err}
+		}
+
+		if single.Error == nil {
+			return http2.HttpError{Status: http2.DecoderError, Cause: fmt.Errorf("json-rpc: expected a batch response")}
+		}
+
+		return r.result(single, nil)
+	}
+
+	if err := json.Unmarshal(raw, &res); err != nil {
+		return http2.HttpError{Status: http2.DecoderError, Cause: err}
+	}
+
+	for i := range calls {
+		calls[i].Err = fmt.Errorf("json-rpc: missing response for %s", calls[i].Method)
+	}
+
+	for _, resp := range res {
+		i, ok := byID[resp.ID]
+		if !ok {
+			continue
+		}
+
+		calls[i].Err = r.result(resp, calls[i].Result)
+	}
+
+	return nil
+}
+
+func (r JSONRPCRepo[T]) call(ctx context.Context, method string, params any, result any) error {
+	var res rpcResponse
+	if err := r.post(ctx, newRPCRequest(method, params), &res); err != nil {
+		return err
+	}
+
+	return r.result(res, result)
+}
+
+// result classifies the error or decodes the result of the response.
+func (r JSONRPCRepo[T]) result(res rpcResponse, dst any) error {
+	if res.Error != nil {
+		err := *res.Error
+		err.Status = r.Statuses[err.Code]
+		return err
+	}
+
+	if dst == nil || len(res.Result) == 0 {
+		return nil
+	}
+
+	if err := json.Unmarshal(res.Result, dst); err != nil {
+		return http2.HttpError{Status: http2.DecoderError, Cause: err}
+	}
+
+	return nil
+}
+
+func (r JSONRPCRepo[T]) post(ctx context.Context, body any, dst any) error {
+	ctx, cancel := withTimeout(ctx, r.Timeout)
+	defer cancel()
+
+	buf, err := json.Marshal(body)
+	if err != nil {
+		return http2.HttpError{Status: http2.EncoderError, Cause: err}
+	}
+
+	endpoint := r.Endpoint
+	if endpoint == nil {
+		endpoint = defaultBase()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", endpoint.String(), bytes.NewReader(buf))
+	if err != nil {
+		panic(err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	resp, err := http2.SendAuthorized(r.Client, req, r.Resilience, r.WithRequest, r.Reauthenticate)
+	if err != nil {
+		return err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return http2.ResponseError(resp)
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(dst); err != nil {
+		return http2.HttpError{Status: http2.DecoderError, Cause: err}
+	}
+
+	return nil
+}
+
+func (r JSONRPCRepo[T]) params(name string, v any) any {
+	if r.Named {
+		return map[string]any{name: v}
+	}
+
+	return []any{v}
+}
+
+func newRPCRequest(method string, params any) rpcRequest {
+	return rpcRequest{JSONRPC: "2.0", Method: method, Params: params, ID: atomic.AddInt64(&rpcIDs, 1)}
+}
@@ -0,0 +1,214 @@
+package rest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/gotrino/fusion/spec/app"
+	http2 "github.com/gotrino/fusion/spec/http"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// serverContext returns a context with an app.Application, whose default Connection points to the server.
+func serverContext(t *testing.T, srv *httptest.Server, c app.Connection) context.Context {
+	t.Helper()
+	parsed, err := app.ParseConnection(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c.Scheme, c.Host, c.Port = parsed.Scheme, parsed.Host, parsed.Port
+	return app.WithContext(context.Background(), app.Application{Title: "test", Connection: c})
+}
+
+// rpcServer answers each call using the given function, which returns the result or the error object.
+func rpcServer(t *testing.T, handle func(method string, params json.RawMessage) (any, *RPCError)) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		type request struct {
+			Method string          `json:"method"`
+			Params json.RawMessage `json:"params"`
+			ID     int64           `json:"id"`
+		}
+
+		type response struct {
+			JSONRPC string    `json:"jsonrpc"`
+			Result  any       `json:"result"`
+			Error   *RPCError `json:"error,omitempty"`
+			ID      int64     `json:"id"`
+		}
+
+		var body json.RawMessage
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Error(err)
+			return
+		}
+
+		answer := func(req request) response {
+			res, rpcErr := handle(req.Method, req.Params)
+			return response{JSONRPC: "2.0", Result: res, Error: rpcErr, ID: req.ID}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if body[0] == '[' {
+			var reqs []request
+			_ = json.Unmarshal(body, &reqs)
+			res := make([]response, 0, len(reqs))
+			for i := len(reqs) - 1; i >= 0; i-- { // the order of batch responses is arbitrary
+				res = append(res, answer(reqs[i]))
+			}
+
+			_ = json.NewEncoder(w).Encode(res)
+			return
+		}
+
+		var req request
+		_ = json.Unmarshal(body, &req)
+		_ = json.NewEncoder(w).Encode(answer(req))
+	}))
+}
+
+func TestJSONRPCLoad(t *testing.T) {
+	srv := rpcServer(t, func(method string, params json.RawMessage) (any, *RPCError) {
+		var args []string
+		_ = json.Unmarshal(params, &args)
+		switch args[0] {
+		case "1":
+			return book{ID: "1", Title: "Dune"}, nil
+		case "2":
+			return nil, nil
+		default:
+			return nil, &RPCError{Code: -32004, Message: "forbidden"}
+		}
+	})
+	defer srv.Close()
+
+	repo := JSONRPC[book](serverContext(t, srv, app.Connection{}), "/rpc", RPCMethods{Load: "books.load"})
+	repo.Statuses = map[int]int{-32004: http.StatusForbidden}
+
+	if b, err := repo.Load("1"); err != nil || b.Title != "Dune" {
+		t.Fatal(b, err)
+	}
+
+	var notFound NotFoundError
+	if _, err := repo.Load("2"); !errors.As(err, &notFound) {
+		t.Fatalf("expected a null result to be not found, got %v", err)
+	}
+
+	var rpcErr RPCError
+	if _, err := repo.Load("3"); !errors.As(err, &rpcErr) || !rpcErr.Forbidden() {
+		t.Fatalf("expected a classified error, got %v", err)
+	}
+}
+
+func TestJSONRPCBatch(t *testing.T) {
+	srv := rpcServer(t, func(method string, params json.RawMessage) (any, *RPCError) {
+		var args []book
+		_ = json.Unmarshal(params, &args)
+		if args[0].ID == "2" {
+			return nil, &RPCError{Code: -32602, Message: "invalid title"}
+		}
+
+		return true, nil
+	})
+	defer srv.Close()
+
+	repo := JSONRPC[book](serverContext(t, srv, app.Connection{}), "/rpc", RPCMethods{Save: "books.save"})
+	res, err := repo.SaveAll(context.Background(), []book{{ID: "1"}, {ID: "2"}, {ID: "3"}})
+	if err == nil || res[0].Err != nil || res[2].Err != nil {
+		t.Fatalf("got %+v %v", res, err)
+	}
+
+	var rpcErr RPCError
+	if !errors.As(res[1].Err, &rpcErr) || !rpcErr.FailedValidation() {
+		t.Fatalf("expected a validation error for the second item, got %v", res[1].Err)
+	}
+}
+
+func TestJSONRPCBatchLevelError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"jsonrpc":"2.0","error":{"code":-32700,"message":"parse error"},"id":null}`))
+	}))
+	defer srv.Close()
+
+	repo := JSONRPC[book](serverContext(t, srv, app.Connection{}), "/rpc", RPCMethods{Delete: "books.delete"})
+	calls := []RPCCall{{Method: "books.delete", Params: []any{"1"}}, {Method: "books.delete", Params: []any{"2"}}}
+
+	var rpcErr RPCError
+	if err := repo.Batch(context.Background(), calls); !errors.As(err, &rpcErr) || !rpcErr.ProtocolError() {
+		t.Fatalf("expected the error object of the batch, got %v", err)
+	}
+
+	res, err := repo.DeleteAll(context.Background(), []string{"1", "2"})
+	if err == nil || res[0].Err == nil || res[1].Err == nil {
+		t.Fatalf("expected all items to fail, got %+v", res)
+	}
+}
+
+func TestPostsAreNotRetried(t *testing.T) {
+	saves := map[string]func(ctx context.Context) error{
+		"json-rpc": func(ctx context.Context) error {
+			return JSONRPC[book](ctx, "/rpc", RPCMethods{Save: "books.save"}).Save(book{ID: "1"})
+		},
+		"graphql": func(ctx context.Context) error {
+			return GraphQL[book](ctx, "/graphql", "books", "book").Save(book{ID: "1"})
+		},
+	}
+
+	for name, save := range saves {
+		t.Run(name, func(t *testing.T) {
+			var calls int32
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				atomic.AddInt32(&calls, 1)
+				w.WriteHeader(http.StatusServiceUnavailable)
+			}))
+			defer srv.Close()
+
+			policy := app.Resilience{MaxRetries: 3, BaseDelay: time.Millisecond}
+			if err := save(serverContext(t, srv, app.Connection{Resilience: policy})); err == nil {
+				t.Fatal("expected an error")
+			}
+
+			if n := atomic.LoadInt32(&calls); n != 1 {
+				t.Fatalf("a post must not be repeated, got %d requests", n)
+			}
+		})
+	}
+}
+
+func TestOpenCircuitIsInternalServerError(t *testing.T) {
+	saves := map[string]func(ctx context.Context) error{
+		"json-rpc": func(ctx context.Context) error {
+			return JSONRPC[book](ctx, "/rpc", RPCMethods{Save: "books.save"}).Save(book{ID: "1"})
+		},
+		"graphql": func(ctx context.Context) error {
+			return GraphQL[book](ctx, "/graphql", "books", "book").Save(book{ID: "1"})
+		},
+		"rest": func(ctx context.Context) error {
+			return REST[book](ctx, "/books").Save(book{ID: "1"})
+		},
+	}
+
+	for name, save := range saves {
+		t.Run(name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusServiceUnavailable)
+			}))
+			defer srv.Close()
+
+			ctx := serverContext(t, srv, app.Connection{Resilience: app.Resilience{BreakerThreshold: 1, BreakerCooldown: time.Hour}})
+			if err := save(ctx); !app.InternalServerError(err) {
+				t.Fatalf("expected an internal server error, got %v", err)
+			}
+
+			err := save(ctx)
+			if !errors.Is(err, http2.ErrCircuitOpen) || !app.InternalServerError(err) {
+				t.Fatalf("expected the open circuit to be an internal server error, got %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,95 @@
+//go:build !(linux || darwin || freebsd || netbsd || openbsd || dragonfly || windows)
+
+package rest
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// lockTimeout is the duration after which acquiring a lock fails.
+const lockTimeout = 30 * time.Second
+
+// lockFile acquires an exclusive lock by creating the named file, because there is no portable advisory locking.
+// Shared locks are therefore also exclusive. The file contains the host and the process id of the holder, so
+// that a lock left behind by a crashed process is removed, but never the lock of a running one.
+func lockFile(name string, exclusive bool) (func() error, error) {
+	host, _ := os.Hostname()
+	holder := fmt.Sprintf("%s\n%d\n", host, os.Getpid())
+	start := time.Now()
+	for {
+		f, err := os.OpenFile(name, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+		if err == nil {
+			_, err = f.WriteString(holder)
+			if cerr := f.Close(); err == nil {
+				err = cerr
+			}
+
+			if err != nil {
+				os.Remove(name)
+				return nil, err
+			}
+
+			return func() error {
+				return os.Remove(name)
+			}, nil
+		}
+
+		if !errors.Is(err, fs.ErrExist) {
+			return nil, err
+		}
+
+		if abandoned(name, host) {
+			os.Remove(name)
+			continue
+		}
+
+		if time.Since(start) > lockTimeout {
+			return nil, fmt.Errorf("cannot acquire lock %s: timeout", name)
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// abandoned reports whether the holder of the lock file has died. A holder on another host cannot be checked and
+// is therefore considered alive. A file without holder is abandoned, if the holder had plenty of time to write it.
+func abandoned(name, host string) bool {
+	info, err := os.Stat(name)
+	if err != nil {
+		return false
+	}
+
+	buf, err := os.ReadFile(name)
+	if err != nil {
+		return false
+	}
+
+	lockHost, pid, ok := strings.Cut(strings.TrimSpace(string(buf)), "\n")
+	id, err := strconv.Atoi(pid)
+	if !ok || err != nil {
+		return time.Since(info.ModTime()) > lockTimeout
+	}
+
+	return lockHost == host && !alive(id)
+}
+
+// alive reports whether the process is running, which is looked up in /proc. Without /proc the process is
+// considered alive.
+func alive(pid int) bool {
+	if pid == os.Getpid() {
+		return true
+	}
+
+	if _, err := os.Stat("/proc"); err != nil {
+		return true
+	}
+
+	_, err := os.Stat(fmt.Sprintf("/proc/%d", pid))
+	return err == nil
+}
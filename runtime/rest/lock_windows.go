@@ -0,0 +1,49 @@
+//go:build windows
+
+package rest
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+var (
+	kernel32         = syscall.NewLazyDLL("kernel32.dll")
+	procLockFileEx   = kernel32.NewProc("LockFileEx")
+	procUnlockFileEx = kernel32.NewProc("UnlockFileEx")
+)
+
+// lockfileExclusiveLock requests an exclusive instead of a shared lock, see LockFileEx.
+const lockfileExclusiveLock = 0x2
+
+// lockFile acquires a lock on the first byte of the named file using LockFileEx, which is created if required.
+// The lock is released by the system, if the process dies.
+func lockFile(name string, exclusive bool) (func() error, error) {
+	f, err := os.OpenFile(name, os.O_CREATE|os.O_RDWR, 0o644)
+	if err != nil {
+		return nil, err
+	}
+
+	var flags uintptr
+	if exclusive {
+		flags = lockfileExclusiveLock
+	}
+
+	var ol syscall.Overlapped
+	if ok, _, err := procLockFileEx.Call(f.Fd(), flags, 0, 1, 0, uintptr(unsafe.Pointer(&ol))); ok == 0 {
+		f.Close()
+		return nil, &os.PathError{Op: "lock", Path: name, Err: err}
+	}
+
+	return func() error {
+		defer f.Close()
+
+		var ol syscall.Overlapped
+		if ok, _, err := procUnlockFileEx.Call(f.Fd(), 0, 1, 0, uintptr(unsafe.Pointer(&ol))); ok == 0 {
+			return &os.PathError{Op: "unlock", Path: name, Err: err}
+		}
+
+		return nil
+	}, nil
+}
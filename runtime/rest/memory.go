@@ -0,0 +1,231 @@
+package rest
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/gotrino/fusion/spec/app"
+	"io"
+	"os"
+	"reflect"
+	"sync"
+)
+
+// EventType describes the kind of change of an entity.
+type EventType string
+
+const (
+	Created EventType = "created"
+	Updated EventType = "updated"
+	Deleted EventType = "deleted"
+)
+
+// Event describes the change of a single entity. The Entity is the zero value for Deleted events.
+type Event[T any] struct {
+	Type   EventType
+	ID     string
+	Entity T
+}
+
+// MemoryRepo is a thread-safe in-memory Repository, which keys the entities using GetID and keeps them in
+// insertion order. It is intended for prototyping and as a test double. The zero value is an empty repository.
+type MemoryRepo[T any] struct {
+	lock      sync.RWMutex
+	entities  map[string]T
+	order     []string
+	listeners []listener[T]
+	nextID    int
+	pending   []Event[T] // pending events in the order of the changes
+	draining  bool       // draining is true while a goroutine delivers the pending events
+}
+
+type listener[T any] struct {
+	id int
+	fn func(Event[T])
+}
+
+// NewMemory allocates a new MemoryRepo containing the given entities.
+func NewMemory[T any](seed ...T) *MemoryRepo[T] {
+	r := &MemoryRepo[T]{}
+	for _, t := range seed {
+		if err := r.Save(t); err != nil {
+			panic(err)
+		}
+	}
+
+	return r
+}
+
+var sharedMemories = map[sharedMemoryKey]any{}
+var sharedMemoriesLock sync.Mutex
+
+type sharedMemoryKey struct {
+	name string
+	typ  reflect.Type
+}
+
+// SharedMemory returns the MemoryRepo registered for the name and the entity type, which is allocated on first
+// use. Thus all callers with the same name and type share the entities.
+func SharedMemory[T any](name string) *MemoryRepo[T] {
+	sharedMemoriesLock.Lock()
+	defer sharedMemoriesLock.Unlock()
+
+	key := sharedMemoryKey{name: name, typ: reflect.TypeOf((*T)(nil)).Elem()}
+	r, ok := sharedMemories[key].(*MemoryRepo[T])
+	if !ok {
+		r = &MemoryRepo[T]{}
+		sharedMemories[key] = r
+	}
+
+	return r
+}
+
+// ReadMemory allocates a new MemoryRepo containing the entities of the given json array.
+func ReadMemory[T any](r io.Reader) (*MemoryRepo[T], error) {
+	var seed []T
+	if err := json.NewDecoder(r).Decode(&seed); err != nil {
+		return nil, fmt.Errorf("cannot decode seed: %w", err)
+	}
+
+	return NewMemory(seed...), nil
+}
+
+// OpenMemory allocates a new MemoryRepo containing the entities of the given json file.
+func OpenMemory[T any](name string) (*MemoryRepo[T], error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+
+	defer f.Close()
+
+	return ReadMemory[T](f)
+}
+
+func (r *MemoryRepo[T]) ToStencil() app.RepositoryImplStencil {
+	return Stencil[T](r)
+}
+
+// List returns a copy of all entities in insertion order.
+func (r *MemoryRepo[T]) List() ([]T, error) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	res := make([]T, 0, len(r.order))
+	for _, id := range r.order {
+		res = append(res, r.entities[id])
+	}
+
+	return res, nil
+}
+
+// Load returns the entity or a NotFoundError.
+func (r *MemoryRepo[T]) Load(id string) (T, error) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	t, ok := r.entities[id]
+	if !ok {
+		return t, NotFoundError{ID: id}
+	}
+
+	return t, nil
+}
+
+// Delete removes the entity. Deleting a missing entity is not an error and emits no event.
+func (r *MemoryRepo[T]) Delete(id string) error {
+	r.lock.Lock()
+	if _, ok := r.entities[id]; ok {
+		delete(r.entities, id)
+		for i, o := range r.order {
+			if o == id {
+				r.order = append(r.order[:i], r.order[i+1:]...)
+				break
+			}
+		}
+
+		r.pending = append(r.pending, Event[T]{Type: Deleted, ID: id})
+	}
+	r.lock.Unlock()
+
+	r.drain()
+	return nil
+}
+
+// Save creates or replaces the entity.
+func (r *MemoryRepo[T]) Save(t T) error {
+	id, err := GetID(t)
+	if err != nil {
+		return err
+	}
+
+	r.lock.Lock()
+	if r.entities == nil {
+		r.entities = map[string]T{}
+	}
+
+	typ := Updated
+	if _, ok := r.entities[id]; !ok {
+		typ = Created
+		r.order = append(r.order, id)
+	}
+
+	r.entities[id] = t
+	r.pending = append(r.pending, Event[T]{Type: typ, ID: id, Entity: t})
+	r.lock.Unlock()
+
+	r.drain()
+	return nil
+}
+
+// Subscribe registers a listener which is invoked after each change. Listeners see the changes in the order in
+// which they have been applied. A listener may access the repository, but a change made by a listener is
+// delivered after the current event has been passed to all listeners. The returned function removes the
+// listener again.
+func (r *MemoryRepo[T]) Subscribe(fn func(Event[T])) (unsubscribe func()) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	id := r.nextID
+	r.nextID++
+	r.listeners = append(r.listeners, listener[T]{id: id, fn: fn})
+
+	return func() {
+		r.lock.Lock()
+		defer r.lock.Unlock()
+
+		for i, l := range r.listeners {
+			if l.id == id {
+				r.listeners = append(r.listeners[:i:i], r.listeners[i+1:]...)
+				break
+			}
+		}
+	}
+}
+
+// drain delivers the pending events, unless another goroutine is already doing so. The events are queued while
+// the change is applied, so that concurrent changes cannot overtake each other.
+func (r *MemoryRepo[T]) drain() {
+	r.lock.Lock()
+	if r.draining {
+		r.lock.Unlock()
+		return
+	}
+
+	r.draining = true
+	for len(r.pending) > 0 {
+		e := r.pending[0]
+		r.pending = r.pending[1:]
+		listeners := r.listeners
+		r.lock.Unlock()
+
+		for _, l := range listeners {
+			l.fn(e)
+		}
+
+		r.lock.Lock()
+	}
+
+	r.draining = false
+	r.pending = nil
+	r.lock.Unlock()
+}
@@ -0,0 +1,103 @@
+package rest
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+)
+
+func TestMemoryZeroValue(t *testing.T) {
+	var repo MemoryRepo[book]
+	if list, err := repo.List(); err != nil || len(list) != 0 {
+		t.Fatal(list, err)
+	}
+
+	if err := repo.Delete("1"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := repo.Save(book{ID: "1"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if b, err := repo.Load("1"); err != nil || b.ID != "1" {
+		t.Fatal(b, err)
+	}
+}
+
+func TestMemoryEventOrder(t *testing.T) {
+	repo := NewMemory[book]()
+	var lock sync.Mutex
+	last := map[string]Event[book]{}
+	repo.Subscribe(func(e Event[book]) {
+		lock.Lock()
+		defer lock.Unlock()
+		last[e.ID] = e
+	})
+
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 200; i++ {
+				id := fmt.Sprint(i % 4)
+				if i%7 == 0 {
+					_ = repo.Delete(id)
+				} else {
+					_ = repo.Save(book{ID: id, Title: fmt.Sprint(g, "-", i)})
+				}
+			}
+		}(g)
+	}
+
+	wg.Wait()
+
+	// the last event of each entity must describe its final state
+	for i := 0; i < 4; i++ {
+		id := fmt.Sprint(i)
+		b, err := repo.Load(id)
+		e := last[id]
+		if err != nil && e.Type != Deleted || err == nil && (e.Type == Deleted || e.Entity != b) {
+			t.Fatalf("%s: final state %v %v, but last event %+v", id, b, err, e)
+		}
+	}
+}
+
+func TestMemoryListenerMayChangeRepository(t *testing.T) {
+	repo := NewMemory[book]()
+	var got []string
+	repo.Subscribe(func(e Event[book]) {
+		got = append(got, string(e.Type)+" "+e.ID)
+		if e.ID == "1" && e.Type == Created {
+			if _, err := repo.Load("1"); err != nil {
+				t.Error(err)
+			}
+
+			_ = repo.Save(book{ID: "2"})
+		}
+	})
+
+	if err := repo.Save(book{ID: "1"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(got) != 2 || got[0] != "created 1" || got[1] != "created 2" {
+		t.Fatalf("got %v", got)
+	}
+}
+
+func TestSharedMemory(t *testing.T) {
+	a := SharedMemory[book]("shared-test")
+	if err := a.Save(book{ID: "1"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if b, err := SharedMemory[book]("shared-test").Load("1"); err != nil || b.ID != "1" {
+		t.Fatal(b, err)
+	}
+
+	if SharedMemory[translation]("shared-test") == nil {
+		t.Fatal("expected a store per type")
+	}
+}
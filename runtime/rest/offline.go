@@ -0,0 +1,609 @@
+package rest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gotrino/fusion/spec/app"
+	http2 "github.com/gotrino/fusion/spec/http"
+	"io"
+	"io/fs"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+var sharedOffline = map[string]any{}
+
+// MutationOp is the kind of a queued Mutation.
+type MutationOp string
+
+const (
+	SaveOp   MutationOp = "save"
+	DeleteOp MutationOp = "delete"
+)
+
+// Mutation is a Save or Delete which has been accepted while the Connection was unreachable.
+type Mutation[T any] struct {
+	Seq    int64      `json:"seq"`
+	Op     MutationOp `json:"op"`
+	ID     string     `json:"id"`
+	Entity T          `json:"entity"`
+	Queued time.Time  `json:"queued"`
+}
+
+// Conflict describes that the server rejected a replayed Mutation with 409 (conflict), 412 (precondition failed)
+// or a validation error.
+type Conflict[T any] struct {
+	Mutation     Mutation[T]
+	Err          error
+	Remote       T    // Remote is the current state on the server, if RemoteExists.
+	RemoteExists bool // RemoteExists is false, if the entity has been deleted on the server or cannot be loaded.
+}
+
+// OfflineStore keeps the last known List and Load results and the queue of pending mutations. If a path is given,
+// the state is written atomically to that file after each change, so that queued mutations survive restarts.
+type OfflineStore[T any] struct {
+	// OnConflict resolves a rejected mutation. It returns the mutation to replay instead, e.g. a merged entity,
+	// or nil to discard the local change. A replacement is replayed once and discarded if rejected again.
+	// If OnConflict is nil, the server wins.
+	OnConflict func(ctx context.Context, c Conflict[T]) *Mutation[T]
+
+	path     string
+	lock     sync.Mutex
+	syncLock sync.Mutex
+	state    offlineState[T]
+	wake     chan struct{} // wake triggers a sync, when the Connection is reachable again
+
+	probeLock sync.Mutex
+	probes    int                // probes is the number of Probe calls, whose context is not done yet
+	stopProbe context.CancelFunc // stopProbe stops the Run started by the first Probe
+}
+
+type offlineState[T any] struct {
+	List     []T           `json:"list"`
+	Entities map[string]T  `json:"entities"`
+	Queue    []Mutation[T] `json:"queue"`
+	Seq      int64         `json:"seq"`
+}
+
+// OpenOfflineStore loads the state from the given json file, which may not exist yet. An empty path keeps the state
+// in memory only.
+func OpenOfflineStore[T any](path string) (*OfflineStore[T], error) {
+	s := &OfflineStore[T]{path: path, state: offlineState[T]{Entities: map[string]T{}}, wake: make(chan struct{}, 1)}
+	if path == "" {
+		return s, nil
+	}
+
+	if err := readJSON(path, &s.state); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+
+	if s.state.Entities == nil {
+		s.state.Entities = map[string]T{}
+	}
+
+	return s, nil
+}
+
+// OfflineOptions enables the offline-first mode of a declared repository.
+type OfflineOptions[T any] struct {
+	Path       string // Path is the json file of the durable store. If empty, the state is kept in memory only.
+	OnConflict func(ctx context.Context, c Conflict[T]) *Mutation[T]
+	// SyncInterval is the delay between the attempts to replay pending mutations in the background. Defaults to
+	// 30 seconds.
+	SyncInterval time.Duration
+}
+
+// SharedOfflineStore returns the store registered under the given name or opens a new one.
+func SharedOfflineStore[T any](name string, opts OfflineOptions[T]) (*OfflineStore[T], error) {
+	sharedLock.Lock()
+	defer sharedLock.Unlock()
+
+	if s, ok := sharedOffline[name]; ok {
+		store, ok := s.(*OfflineStore[T])
+		if !ok {
+			return nil, fmt.Errorf("offline store %s is already used with %T", name, s)
+		}
+
+		return store, nil
+	}
+
+	store, err := OpenOfflineStore[T](opts.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	store.OnConflict = opts.OnConflict
+	sharedOffline[name] = store
+	return store, nil
+}
+
+// Pending returns a copy of the queued mutations in replay order.
+func (s *OfflineStore[T]) Pending() []Mutation[T] {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return append([]Mutation[T]{}, s.state.Queue...)
+}
+
+func (s *OfflineStore[T]) persist() error {
+	if s.path == "" {
+		return nil
+	}
+
+	return WriteFileAtomic(s.path, func(w io.Writer) error {
+		return json.NewEncoder(w).Encode(s.state)
+	})
+}
+
+// enqueue appends the mutation and applies it to the local state.
+func (s *OfflineStore[T]) enqueue(op MutationOp, id string, t T) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.state.Seq++
+	m := Mutation[T]{Seq: s.state.Seq, Op: op, ID: id, Entity: t, Queued: time.Now()}
+	s.state.Queue = append(s.state.Queue, m)
+	s.state.List = s.state.apply(s.state.List, m)
+
+	return s.persist()
+}
+
+func (s *OfflineStore[T]) peek() (Mutation[T], bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if len(s.state.Queue) == 0 {
+		return Mutation[T]{}, false
+	}
+
+	return s.state.Queue[0], true
+}
+
+func (s *OfflineStore[T]) pop(seq int64) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if len(s.state.Queue) > 0 && s.state.Queue[0].Seq == seq {
+		s.state.Queue = s.state.Queue[1:]
+	}
+
+	return s.persist()
+}
+
+// storeList remembers the remote list and returns it with the pending mutations applied.
+func (s *OfflineStore[T]) storeList(list []T) ([]T, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.state.Entities = map[string]T{}
+	for _, t := range list {
+		if id, err := GetID(t); err == nil {
+			s.state.Entities[id] = t
+		}
+	}
+
+	for _, m := range s.state.Queue {
+		list = s.state.apply(list, m)
+	}
+
+	s.state.List = list
+	return append([]T{}, list...), s.persist()
+}
+
+// commit applies a mutation, which the server has accepted, to the known entities and the last list.
+func (s *OfflineStore[T]) commit(m Mutation[T]) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if m.Op == SaveOp {
+		s.state.Entities[m.ID] = m.Entity
+	} else {
+		delete(s.state.Entities, m.ID)
+	}
+
+	s.state.List = s.state.apply(s.state.List, m)
+	return s.persist()
+}
+
+// reachable triggers a background sync, because an operation has reached the server.
+func (s *OfflineStore[T]) reachable() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// storeEntity remembers the remote entity or forgets it if it does not exist anymore.
+func (s *OfflineStore[T]) storeEntity(id string, t T, exists bool) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if exists {
+		s.state.Entities[id] = t
+	} else {
+		delete(s.state.Entities, id)
+	}
+
+	return s.persist()
+}
+
+// local returns the entity with the pending mutations applied.
+func (s *OfflineStore[T]) local(id string) (T, bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	t, ok := s.state.Entities[id]
+	for _, m := range s.state.Queue {
+		if m.ID == id {
+			t, ok = m.Entity, m.Op == SaveOp
+		}
+	}
+
+	return t, ok
+}
+
+func (s *OfflineStore[T]) list() []T {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return append([]T{}, s.state.List...)
+}
+
+// apply returns the list with the mutation applied and updates the known entities.
+func (st *offlineState[T]) apply(list []T, m Mutation[T]) []T {
+	res := make([]T, 0, len(list)+1)
+	found := false
+	for _, t := range list {
+		if id, _ := GetID(t); id == m.ID {
+			found = true
+			if m.Op == DeleteOp {
+				continue
+			}
+
+			t = m.Entity
+		}
+
+		res = append(res, t)
+	}
+
+	if !found && m.Op == SaveOp {
+		res = append(res, m.Entity)
+	}
+
+	return res
+}
+
+// Offline wraps the repository with the given store.
+func Offline[T any](repo Repository[T], store *OfflineStore[T]) OfflineRepo[T] {
+	return OfflineRepo[T]{Repo: repo, Store: store}
+}
+
+// OfflineRepo is an offline-first decorator. List and Load fall back to the last known results if the Connection
+// is unreachable. Save and Delete are queued durably, if the Connection is unavailable, see Sync, and replayed in
+// order by Sync, which is also attempted before each operation while mutations are pending. Queued operations
+// report no error.
+type OfflineRepo[T any] struct {
+	Repo  Repository[T]
+	Store *OfflineStore[T]
+}
+
+func (r OfflineRepo[T]) ToStencil() app.RepositoryImplStencil {
+	return Stencil[T](r)
+}
+
+func (r OfflineRepo[T]) List() ([]T, error) {
+	return r.ListContext(context.Background())
+}
+
+func (r OfflineRepo[T]) ListContext(ctx context.Context) ([]T, error) {
+	r.trySync(ctx)
+
+	res, err := listContext(ctx, r.Repo)
+	if err != nil {
+		if unreachable(err) {
+			return r.Store.list(), nil
+		}
+
+		return nil, err
+	}
+
+	r.Store.reachable()
+	return r.Store.storeList(res)
+}
+
+func (r OfflineRepo[T]) Load(id string) (T, error) {
+	return r.LoadContext(context.Background(), id)
+}
+
+func (r OfflineRepo[T]) LoadContext(ctx context.Context, id string) (T, error) {
+	r.trySync(ctx)
+
+	res, err := loadContext(ctx, r.Repo, id)
+	switch {
+	case err == nil:
+		r.Store.reachable()
+		if err := r.Store.storeEntity(id, res, true); err != nil {
+			return res, err
+		}
+	case unreachable(err):
+	case app.NotFound(err):
+		if err := r.Store.storeEntity(id, res, false); err != nil {
+			return res, err
+		}
+	default:
+		return res, err
+	}
+
+	if t, ok := r.Store.local(id); ok {
+		return t, nil
+	}
+
+	if err == nil {
+		return res, nil
+	}
+
+	return res, NotFoundError{ID: id}
+}
+
+func (r OfflineRepo[T]) Delete(id string) error {
+	return r.DeleteContext(context.Background(), id)
+}
+
+func (r OfflineRepo[T]) DeleteContext(ctx context.Context, id string) error {
+	var zero T
+	return r.mutate(ctx, Mutation[T]{Op: DeleteOp, ID: id, Entity: zero})
+}
+
+func (r OfflineRepo[T]) Save(t T) error {
+	return r.SaveContext(context.Background(), t)
+}
+
+func (r OfflineRepo[T]) SaveContext(ctx context.Context, t T) error {
+	id, err := GetID(t)
+	if err != nil {
+		return err
+	}
+
+	return r.mutate(ctx, Mutation[T]{Op: SaveOp, ID: id, Entity: t})
+}
+
+// mutate performs the mutation directly, if nothing is pending. Otherwise, it is queued behind the pending ones to
+// keep the order.
+func (r OfflineRepo[T]) mutate(ctx context.Context, m Mutation[T]) error {
+	if len(r.Store.Pending()) == 0 {
+		err := r.apply(ctx, m)
+		if err == nil {
+			return r.Store.commit(m)
+		}
+
+		if !unavailable(err) {
+			return err
+		}
+	}
+
+	if err := r.Store.enqueue(m.Op, m.ID, m.Entity); err != nil {
+		return err
+	}
+
+	r.trySync(ctx)
+	return nil
+}
+
+// Sync replays the pending mutations in order. It stops at the first mutation which fails transiently, i.e.
+// because the Connection is unavailable (unreachable, 5xx, 408 or 429), the credentials are rejected (401) or the
+// context is done, and returns that error while the mutation stays pending. Conflicts are passed to OnConflict.
+// Other rejections, like 403, discard the mutation and are returned after all mutations have been replayed.
+// Deleting an entity which does not exist anymore succeeds.
+func (r OfflineRepo[T]) Sync(ctx context.Context) error {
+	r.Store.syncLock.Lock()
+	defer r.Store.syncLock.Unlock()
+
+	var rejected []error
+	for {
+		m, ok := r.Store.peek()
+		if !ok {
+			return errors.Join(rejected...)
+		}
+
+		err := r.apply(ctx, m)
+		switch {
+		case err == nil:
+			if err := r.Store.storeEntity(m.ID, m.Entity, m.Op == SaveOp); err != nil {
+				return err
+			}
+		case transient(err):
+			return err
+		case m.Op == DeleteOp && app.NotFound(err):
+			if err := r.Store.storeEntity(m.ID, m.Entity, false); err != nil {
+				return err
+			}
+		case conflict(err):
+			if err := r.resolve(ctx, m, err); err != nil {
+				return err
+			}
+		default:
+			r.reconcile(ctx, m)
+			rejected = append(rejected, fmt.Errorf("%s of %s rejected: %w", m.Op, m.ID, err))
+		}
+
+		if err := r.Store.pop(m.Seq); err != nil {
+			return err
+		}
+	}
+}
+
+// Run syncs in the given interval and whenever an operation has reached the server again, until the context is
+// canceled.
+func (r OfflineRepo[T]) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-r.Store.wake:
+		}
+
+		if ctx.Err() != nil {
+			return
+		}
+
+		if len(r.Store.Pending()) > 0 {
+			_ = r.Sync(ctx)
+		}
+	}
+}
+
+// Probe starts Run in the background, unless it is already running for the store. Thus, pending mutations are
+// replayed when the Connection is back, even if no further operation is performed. Run stops as soon as the
+// contexts of all Probe calls on the store are done. The interval defaults to 30 seconds.
+func (r OfflineRepo[T]) Probe(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		interval = 30 * time.Second
+	}
+
+	s := r.Store
+	s.probeLock.Lock()
+	defer s.probeLock.Unlock()
+
+	s.probes++
+	if s.probes == 1 {
+		runCtx, cancel := context.WithCancel(context.Background())
+		s.stopProbe = cancel
+		go r.Run(runCtx, interval)
+	}
+
+	go func() {
+		<-ctx.Done()
+
+		s.probeLock.Lock()
+		defer s.probeLock.Unlock()
+
+		s.probes--
+		if s.probes == 0 {
+			s.stopProbe()
+		}
+	}()
+}
+
+func (r OfflineRepo[T]) trySync(ctx context.Context) {
+	if len(r.Store.Pending()) > 0 {
+		_ = r.Sync(ctx)
+	}
+}
+
+// resolve asks OnConflict and replays the replacement once. Only transient failures are reported.
+func (r OfflineRepo[T]) resolve(ctx context.Context, m Mutation[T], cause error) error {
+	c := r.reconcile(ctx, m)
+	c.Err = cause
+	if r.Store.OnConflict == nil {
+		return nil
+	}
+
+	replacement := r.Store.OnConflict(ctx, c)
+	if replacement == nil {
+		return nil
+	}
+
+	if err := r.apply(ctx, *replacement); err != nil {
+		if transient(err) {
+			return err
+		}
+
+		return nil
+	}
+
+	return r.Store.commit(*replacement)
+}
+
+// reconcile replaces the local state of the rejected mutation with the current state on the server.
+func (r OfflineRepo[T]) reconcile(ctx context.Context, m Mutation[T]) Conflict[T] {
+	c := Conflict[T]{Mutation: m}
+	remote, err := loadContext(ctx, r.Repo, m.ID)
+	if err == nil {
+		c.Remote, c.RemoteExists = remote, true
+	}
+
+	state := Mutation[T]{Op: DeleteOp, ID: m.ID}
+	if c.RemoteExists {
+		state = Mutation[T]{Op: SaveOp, ID: m.ID, Entity: remote}
+	}
+
+	_ = r.Store.commit(state)
+	return c
+}
+
+func (r OfflineRepo[T]) apply(ctx context.Context, m Mutation[T]) error {
+	if m.Op == DeleteOp {
+		return deleteContext(ctx, r.Repo, m.ID)
+	}
+
+	return saveContext(ctx, r.Repo, m.Entity)
+}
+
+// unreachable reports network failures and open circuits, in contrast to errors reported by the server.
+func unreachable(err error) bool {
+	if errors.Is(err, http2.ErrCircuitOpen) {
+		return true
+	}
+
+	if errors.Is(err, context.Canceled) {
+		return false
+	}
+
+	var httpErr http2.HttpError
+	if errors.As(err, &httpErr) && httpErr.Status != 0 {
+		return false
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+// unavailable reports failures of the Connection instead of the mutation: it is unreachable, or the server has
+// failed (5xx) or is overloaded (408, 429). Such a mutation is queued by Save and Delete and kept by Sync.
+func unavailable(err error) bool {
+	if unreachable(err) || app.InternalServerError(err) {
+		return true
+	}
+
+	var httpErr http2.HttpError
+	return errors.As(err, &httpErr) && (httpErr.Status == http.StatusRequestTimeout || httpErr.Status == http.StatusTooManyRequests)
+}
+
+// transient reports failures which do not depend on the mutation, so that Sync replays it again later. In
+// addition to an unavailable Connection, these are rejected credentials and a done context.
+func transient(err error) bool {
+	return unavailable(err) || app.Unauthenticated(err) || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
+}
+
+// conflict reports that the server rejected the mutation because of the current state of the entity or an
+// invalid entity, which can be resolved by OnConflict.
+func conflict(err error) bool {
+	var httpErr http2.HttpError
+	if errors.As(err, &httpErr) {
+		switch httpErr.Status {
+		case http.StatusConflict, http.StatusPreconditionFailed, http.StatusUnprocessableEntity:
+			return true
+		}
+	}
+
+	failed, _ := app.ValidationFailed(err)
+	return failed
+}
+
+// Watch forwards the changes of the decorated repository.
+func (r OfflineRepo[T]) Watch(ctx context.Context) (<-chan Event[T], error) {
+	w, ok := r.Repo.(Watcher[T])
+	if !ok {
+		return nil, app.ErrWatchNotSupported
+	}
+
+	return w.Watch(ctx)
+}
@@ -0,0 +1,257 @@
+package rest
+
+import (
+	"context"
+	"errors"
+	"github.com/gotrino/fusion/spec/app"
+	http2 "github.com/gotrino/fusion/spec/http"
+	"net"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+)
+
+// flakyRepo is a MemoryRepo whose Save and Delete fail with the injected error.
+type flakyRepo struct {
+	*MemoryRepo[book]
+	lock sync.Mutex
+	err  error
+}
+
+func (r *flakyRepo) fail(err error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.err = err
+}
+
+func (r *flakyRepo) failure() error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.err
+}
+
+func (r *flakyRepo) Save(t book) error {
+	if err := r.failure(); err != nil {
+		return err
+	}
+
+	return r.MemoryRepo.Save(t)
+}
+
+func (r *flakyRepo) Delete(id string) error {
+	if err := r.failure(); err != nil {
+		return err
+	}
+
+	return r.MemoryRepo.Delete(id)
+}
+
+var networkDown = &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}
+
+func TestOfflineSync(t *testing.T) {
+	validation := app.ValidationError{Message: "invalid", Fields: []app.FieldError{{Field: "title", Message: "required"}}}
+	tests := []struct {
+		name      string
+		op        MutationOp
+		err       error
+		pending   bool // pending means that the mutation is kept for the next sync
+		conflict  bool
+		syncError bool
+	}{
+		{name: "conflict", op: SaveOp, err: http2.HttpError{Status: http.StatusConflict}, conflict: true},
+		{name: "precondition failed", op: SaveOp, err: http2.HttpError{Status: http.StatusPreconditionFailed}, conflict: true},
+		{name: "unprocessable", op: SaveOp, err: http2.HttpError{Status: http.StatusUnprocessableEntity, Cause: validation}, conflict: true},
+		{name: "bad request problem", op: SaveOp, err: http2.HttpError{Status: http.StatusBadRequest, Cause: validation}, conflict: true},
+		{name: "unauthorized", op: SaveOp, err: http2.HttpError{Status: http.StatusUnauthorized}, pending: true, syncError: true},
+		{name: "too many requests", op: SaveOp, err: http2.HttpError{Status: http.StatusTooManyRequests}, pending: true, syncError: true},
+		{name: "unavailable", op: SaveOp, err: http2.HttpError{Status: http.StatusServiceUnavailable}, pending: true, syncError: true},
+		{name: "network down", op: SaveOp, err: networkDown, pending: true, syncError: true},
+		{name: "canceled", op: SaveOp, err: context.Canceled, pending: true, syncError: true},
+		{name: "forbidden", op: SaveOp, err: http2.HttpError{Status: http.StatusForbidden}, syncError: true},
+		{name: "delete missing", op: DeleteOp, err: http2.HttpError{Status: http.StatusNotFound}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &flakyRepo{MemoryRepo: NewMemory(book{ID: "1", Title: "remote"})}
+			store, _ := OpenOfflineStore[book]("")
+			conflicts := 0
+			store.OnConflict = func(ctx context.Context, c Conflict[book]) *Mutation[book] {
+				conflicts++
+				if !c.RemoteExists || c.Remote.Title != "remote" || c.Err == nil {
+					t.Errorf("unexpected conflict %+v", c)
+				}
+
+				return nil
+			}
+
+			if err := store.enqueue(tt.op, "1", book{ID: "1", Title: "local"}); err != nil {
+				t.Fatal(err)
+			}
+
+			repo.fail(tt.err)
+			err := Offline[book](repo, store).Sync(context.Background())
+			if (err != nil) != tt.syncError {
+				t.Errorf("unexpected sync error %v", err)
+			}
+
+			if got := len(store.Pending()) > 0; got != tt.pending {
+				t.Errorf("expected pending %v, got %v", tt.pending, got)
+			}
+
+			if got := conflicts > 0; got != tt.conflict {
+				t.Errorf("expected conflict %v, got %v", tt.conflict, got)
+			}
+
+			if !tt.pending && tt.op == SaveOp {
+				if list := store.list(); len(list) != 1 || list[0].Title != "remote" {
+					t.Errorf("expected the server to win, got %v", list)
+				}
+			}
+		})
+	}
+}
+
+func TestOfflineDirectSave(t *testing.T) {
+	repo := &flakyRepo{MemoryRepo: NewMemory(book{ID: "1", Title: "Dune"})}
+	store, _ := OpenOfflineStore[book]("")
+	off := Offline[book](repo, store)
+	if _, err := off.List(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := off.Save(book{ID: "2", Title: "Emma"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if list := store.list(); len(list) != 2 || list[1].Title != "Emma" {
+		t.Fatalf("expected the saved entity in the last list, got %v", list)
+	}
+}
+
+func TestOfflineDirectMutation(t *testing.T) {
+	tests := []struct {
+		name   string
+		err    error
+		queued bool // queued means that the save succeeds and is replayed by the next sync
+	}{
+		{name: "network down", err: networkDown, queued: true},
+		{name: "open circuit", err: http2.HttpError{Status: http.StatusServiceUnavailable, Cause: http2.ErrCircuitOpen}, queued: true},
+		{name: "unavailable", err: http2.HttpError{Status: http.StatusServiceUnavailable}, queued: true},
+		{name: "internal server error", err: http2.HttpError{Status: http.StatusInternalServerError}, queued: true},
+		{name: "too many requests", err: http2.HttpError{Status: http.StatusTooManyRequests}, queued: true},
+		{name: "unauthorized", err: http2.HttpError{Status: http.StatusUnauthorized}},
+		{name: "forbidden", err: http2.HttpError{Status: http.StatusForbidden}},
+		{name: "conflict", err: http2.HttpError{Status: http.StatusConflict}},
+		{name: "canceled", err: context.Canceled},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &flakyRepo{MemoryRepo: NewMemory[book]()}
+			repo.fail(tt.err)
+			store, _ := OpenOfflineStore[book]("")
+			off := Offline[book](repo, store)
+
+			err := off.Save(book{ID: "1"})
+			if tt.queued != (err == nil) {
+				t.Fatalf("unexpected error %v", err)
+			}
+
+			if got := len(store.Pending()) == 1; got != tt.queued {
+				t.Fatalf("expected queued %v, got %v", tt.queued, store.Pending())
+			}
+
+			repo.fail(nil)
+			if err := off.Sync(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+
+			if _, err := repo.MemoryRepo.Load("1"); (err == nil) != tt.queued {
+				t.Fatalf("expected the queued save to be replayed only, got %v", err)
+			}
+		})
+	}
+}
+
+func TestOfflineProbe(t *testing.T) {
+	repo := &flakyRepo{MemoryRepo: NewMemory[book]()}
+	repo.fail(networkDown)
+	store, _ := OpenOfflineStore[book]("")
+	off := Offline[book](repo, store)
+	if err := off.Save(book{ID: "1"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(store.Pending()) != 1 {
+		t.Fatal("expected the mutation to be queued")
+	}
+
+	first, cancelFirst := context.WithCancel(context.Background())
+	second, cancelSecond := context.WithCancel(context.Background())
+	off.Probe(first, time.Millisecond)
+	off.Probe(second, time.Millisecond)
+	repo.fail(nil)
+	awaitSynced(t, store)
+
+	if _, err := repo.MemoryRepo.Load("1"); err != nil {
+		t.Fatal(err)
+	}
+
+	cancelFirst()
+	awaitProbes(t, store, 1)
+	if err := store.enqueue(SaveOp, "2", book{ID: "2"}); err != nil {
+		t.Fatal(err)
+	}
+
+	awaitSynced(t, store) // still running for the second probe
+
+	cancelSecond()
+	awaitProbes(t, store, 0)
+	time.Sleep(5 * time.Millisecond) // let a running sync finish
+	if err := store.enqueue(SaveOp, "3", book{ID: "3"}); err != nil {
+		t.Fatal(err)
+	}
+
+	time.Sleep(20 * time.Millisecond)
+	if len(store.Pending()) != 1 {
+		t.Fatal("expected the stopped probe not to replay the mutation")
+	}
+
+	third, cancelThird := context.WithCancel(context.Background())
+	defer cancelThird()
+	off.Probe(third, time.Millisecond)
+	awaitSynced(t, store)
+}
+
+func awaitProbes(t *testing.T, s *OfflineStore[book], n int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for probes(s) != n {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected %d probes, got %d", n, probes(s))
+		}
+
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func probes(s *OfflineStore[book]) int {
+	s.probeLock.Lock()
+	defer s.probeLock.Unlock()
+
+	return s.probes
+}
+
+func awaitSynced(t *testing.T, store *OfflineStore[book]) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for len(store.Pending()) > 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("expected the probe to replay the mutation")
+		}
+
+		time.Sleep(time.Millisecond)
+	}
+}
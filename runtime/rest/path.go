@@ -0,0 +1,46 @@
+package rest
+
+import (
+	"fmt"
+	"net/url"
+	"reflect"
+	"strings"
+)
+
+// Params binds typed values to the placeholders of a path template like /api/authors/{authorID}/books.
+// Values are formatted like ids, so strings, integers, encoding.TextMarshaler and fmt.Stringer are supported.
+type Params map[string]any
+
+// Expand replaces all placeholders of the template with the path escaped values of params. It is an error, if
+// a placeholder is not bound.
+func Expand(template string, params Params) (string, error) {
+	var sb strings.Builder
+	rest := template
+	for {
+		start := strings.IndexByte(rest, '{')
+		if start < 0 {
+			sb.WriteString(rest)
+			return sb.String(), nil
+		}
+
+		end := strings.IndexByte(rest[start:], '}')
+		if end < 0 {
+			return "", fmt.Errorf("invalid path template %s: missing '}'", template)
+		}
+
+		name := rest[start+1 : start+end]
+		v, ok := params[name]
+		if !ok || v == nil {
+			return "", fmt.Errorf("invalid path template %s: parameter '%s' is not bound", template, name)
+		}
+
+		s, err := formatID(reflect.ValueOf(v))
+		if err != nil {
+			return "", fmt.Errorf("invalid path template %s: parameter '%s': %w", template, name, err)
+		}
+
+		sb.WriteString(rest[:start])
+		sb.WriteString(url.PathEscape(s))
+		rest = rest[start+end+1:]
+	}
+}
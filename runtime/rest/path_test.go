@@ -0,0 +1,58 @@
+package rest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestExpand(t *testing.T) {
+	tests := []struct {
+		template string
+		params   Params
+		want     string
+		ok       bool
+	}{
+		{"/api/books", nil, "/api/books", true},
+		{"/api/authors/{authorID}/books", Params{"authorID": 42}, "/api/authors/42/books", true},
+		{"/api/authors/{authorID}/books", Params{"authorID": "a/b"}, "/api/authors/a%2Fb/books", true},
+		{"/api/authors/{authorID}/books", Params{}, "", false},
+		{"/api/authors/{authorID/books", Params{"authorID": 1}, "", false},
+	}
+
+	for _, tt := range tests {
+		got, err := Expand(tt.template, tt.params)
+		if got != tt.want || (err == nil) != tt.ok {
+			t.Errorf("%s: got %q %v, want %q", tt.template, got, err, tt.want)
+		}
+	}
+}
+
+func TestUnboundPathParam(t *testing.T) {
+	var paths []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.EscapedPath())
+		_, _ = w.Write([]byte("[]"))
+	}))
+	defer srv.Close()
+
+	base, _ := url.Parse(srv.URL + "/api/authors/{authorID}/books")
+	repo := RESTRepo[book]{Base: base}
+	if _, err := repo.List(); err == nil {
+		t.Fatal("expected an error for the unbound placeholder")
+	}
+
+	if err := repo.Save(book{ID: "1"}); err == nil {
+		t.Fatal("expected an error for the unbound placeholder")
+	}
+
+	repo.PathParams = Params{"authorID": "a b"}
+	if _, err := repo.List(); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(paths) != 1 || paths[0] != "/api/authors/a%20b/books" {
+		t.Fatalf("got %v", paths)
+	}
+}
@@ -1,5 +1,7 @@
 package rest
 
+import "context"
+
 // A Repository which represents CRUD (create read update delete) operations on an Entity based resource set.
 // If any entity has a certain kind of ID, the repository implementation must unmarshal it from a string
 // to support Load and Delete.
@@ -12,9 +14,71 @@ type Repository[T any] interface {
 	Save(t T) error
 }
 
+// ContextRepository is an optional extension of a Repository, whose operations are bound to the given context.
+// A runtime cancels the context when the according activity goes away, which aborts any in-flight operation.
+type ContextRepository[T any] interface {
+	ListContext(ctx context.Context) ([]T, error)
+	LoadContext(ctx context.Context, id string) (T, error)
+	DeleteContext(ctx context.Context, id string) error
+	SaveContext(ctx context.Context, t T) error
+}
+
 // ResourceRepository represents an aggregate which may or may not have an id.
 type ResourceRepository[T any] interface {
 	Load() (T, error)
 	Save(t T) error
 	Delete() error
 }
+
+// ContextResourceRepository is an optional extension of a ResourceRepository, whose operations are bound to the
+// given context.
+type ContextResourceRepository[T any] interface {
+	LoadContext(ctx context.Context) (T, error)
+	SaveContext(ctx context.Context, t T) error
+	DeleteContext(ctx context.Context) error
+}
+
+// NotFoundError is returned by repositories which are not backed by http, if an entity does not exist.
+type NotFoundError struct {
+	ID string
+}
+
+func (e NotFoundError) Error() string {
+	return "entity not found: " + e.ID
+}
+
+func (e NotFoundError) NotFound() bool {
+	return true
+}
+
+func listContext[T any](ctx context.Context, repo Repository[T]) ([]T, error) {
+	if c, ok := repo.(ContextRepository[T]); ok {
+		return c.ListContext(ctx)
+	}
+
+	return repo.List()
+}
+
+func loadContext[T any](ctx context.Context, repo Repository[T], id string) (T, error) {
+	if c, ok := repo.(ContextRepository[T]); ok {
+		return c.LoadContext(ctx, id)
+	}
+
+	return repo.Load(id)
+}
+
+func deleteContext[T any](ctx context.Context, repo Repository[T], id string) error {
+	if c, ok := repo.(ContextRepository[T]); ok {
+		return c.DeleteContext(ctx, id)
+	}
+
+	return repo.Delete(id)
+}
+
+func saveContext[T any](ctx context.Context, repo Repository[T], t T) error {
+	if c, ok := repo.(ContextRepository[T]); ok {
+		return c.SaveContext(ctx, t)
+	}
+
+	return repo.Save(t)
+}
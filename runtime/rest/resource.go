@@ -0,0 +1,113 @@
+package rest
+
+import (
+	"context"
+	"fmt"
+	"github.com/gotrino/fusion/spec/app"
+	"github.com/gotrino/fusion/spec/observe"
+)
+
+// RESTResource creates a repository for a singleton resource like /api/settings or /api/me.
+func RESTResource[T any](ctx context.Context, resource string) RESTResourceRepo[T] {
+	return RESTResourceRepo[T]{Repo: REST[T](ctx, resource)}
+}
+
+// RESTResourceRepo implements a ResourceRepository by performing the verbs on the resource itself, without
+// attaching any id. The configuration, like codecs or resilience, is taken from the underlying RESTRepo.
+type RESTResourceRepo[T any] struct {
+	Repo RESTRepo[T]
+}
+
+func (r RESTResourceRepo[T]) ToStencil() app.ResourceImplStencil {
+	return resourceAdapter[T]{impl: r, name: fmt.Sprintf("%T", r)}
+}
+
+// Load performs a get on the resource, like GET /api/settings.
+func (r RESTResourceRepo[T]) Load() (T, error) {
+	return r.LoadContext(r.Repo.Context)
+}
+
+// LoadContext is like Load but bound to the given context.
+func (r RESTResourceRepo[T]) LoadContext(ctx context.Context) (T, error) {
+	return r.Repo.LoadContext(ctx, "")
+}
+
+// Save performs a put on the resource, like PUT /api/settings.
+func (r RESTResourceRepo[T]) Save(t T) error {
+	return r.SaveContext(r.Repo.Context, t)
+}
+
+// SaveContext is like Save but bound to the given context.
+func (r RESTResourceRepo[T]) SaveContext(ctx context.Context, t T) error {
+	ctx, cancel := r.Repo.bind(ctx)
+	defer cancel()
+
+	return r.Repo.put(ctx, "", t)
+}
+
+// Delete performs a delete on the resource, like DELETE /api/settings.
+func (r RESTResourceRepo[T]) Delete() error {
+	return r.DeleteContext(r.Repo.Context)
+}
+
+// DeleteContext is like Delete but bound to the given context.
+func (r RESTResourceRepo[T]) DeleteContext(ctx context.Context) error {
+	return r.Repo.DeleteContext(ctx, "")
+}
+
+type resourceAdapter[T any] struct {
+	impl RESTResourceRepo[T]
+	name string // name is the type of impl, see stencilAdapter
+}
+
+func (s resourceAdapter[T]) op(name string) observe.Operation {
+	return observe.Operation{Repository: s.name, Name: name}
+}
+
+func (s resourceAdapter[T]) Load() (any, error) {
+	_, end := observe.StartOperation(context.Background(), s.op("load"))
+	res, err := s.impl.Load()
+	end(err)
+
+	return res, err
+}
+
+func (s resourceAdapter[T]) LoadContext(ctx context.Context) (any, error) {
+	ctx, end := observe.StartOperation(ctx, s.op("load"))
+	res, err := s.impl.LoadContext(ctx)
+	end(err)
+
+	return res, err
+}
+
+func (s resourceAdapter[T]) Save(t any) error {
+	_, end := observe.StartOperation(context.Background(), s.op("save"))
+	err := s.impl.Save(t.(T))
+	end(err)
+
+	return err
+}
+
+func (s resourceAdapter[T]) SaveContext(ctx context.Context, t any) error {
+	ctx, end := observe.StartOperation(ctx, s.op("save"))
+	err := s.impl.SaveContext(ctx, t.(T))
+	end(err)
+
+	return err
+}
+
+func (s resourceAdapter[T]) Delete() error {
+	_, end := observe.StartOperation(context.Background(), s.op("delete"))
+	err := s.impl.Delete()
+	end(err)
+
+	return err
+}
+
+func (s resourceAdapter[T]) DeleteContext(ctx context.Context) error {
+	ctx, end := observe.StartOperation(ctx, s.op("delete"))
+	err := s.impl.DeleteContext(ctx)
+	end(err)
+
+	return err
+}
@@ -0,0 +1,216 @@
+package rest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/gotrino/fusion/spec/app"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+type settings struct {
+	Theme string `json:"theme"`
+}
+
+// settingsServer serves a single settings resource at /api/settings and records the requests as method and path.
+// A status other than zero is responded instead.
+type settingsServer struct {
+	*httptest.Server
+	lock     sync.Mutex
+	value    *settings
+	status   int
+	requests []string
+}
+
+func newSettingsServer(t *testing.T) *settingsServer {
+	s := &settingsServer{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.lock.Lock()
+		defer s.lock.Unlock()
+
+		s.requests = append(s.requests, r.Method+" "+r.URL.Path)
+		switch {
+		case s.status != 0:
+			w.WriteHeader(s.status)
+		case r.URL.Path != "/api/settings":
+			w.WriteHeader(http.StatusBadRequest)
+		case r.Method == http.MethodGet && s.value == nil:
+			w.WriteHeader(http.StatusNotFound)
+		case r.Method == http.MethodGet:
+			w.Header().Set("Content-Type", "application/json")
+			if err := json.NewEncoder(w).Encode(s.value); err != nil {
+				t.Error(err)
+			}
+		case r.Method == http.MethodPut:
+			var v settings
+			if err := json.NewDecoder(r.Body).Decode(&v); err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+
+			s.value = &v
+			w.WriteHeader(http.StatusNoContent)
+		case r.Method == http.MethodDelete:
+			s.value = nil
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}))
+
+	return s
+}
+
+func (s *settingsServer) recorded() []string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return append([]string{}, s.requests...)
+}
+
+func TestRESTResource(t *testing.T) {
+	srv := newSettingsServer(t)
+	defer srv.Close()
+
+	repo := RESTResource[settings](serverContext(t, srv.Server, app.Connection{}), "/api/settings")
+	if _, err := repo.Load(); !app.NotFound(err) {
+		t.Fatalf("expected not found, got %v", err)
+	}
+
+	if err := repo.Save(settings{Theme: "dark"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if v, err := repo.Load(); err != nil || v.Theme != "dark" {
+		t.Fatal(v, err)
+	}
+
+	if err := repo.Delete(); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"GET /api/settings", "PUT /api/settings", "GET /api/settings", "DELETE /api/settings"}
+	got := srv.recorded()
+	if len(got) != len(want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("expected %v, got %v", want, got)
+		}
+	}
+}
+
+func TestRESTResourceStencil(t *testing.T) {
+	srv := newSettingsServer(t)
+	defer srv.Close()
+
+	stencil := RESTResource[settings](serverContext(t, srv.Server, app.Connection{}), "/api/settings").ToStencil()
+	if err := stencil.Save(settings{Theme: "light"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if v, err := stencil.Load(); err != nil || v.(settings).Theme != "light" {
+		t.Fatal(v, err)
+	}
+
+	ctxStencil, ok := stencil.(app.ContextResourceImplStencil)
+	if !ok {
+		t.Fatal("expected the stencil to accept a context")
+	}
+
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := ctxStencil.LoadContext(canceled); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected the cancellation, got %v", err)
+	}
+
+	if err := ctxStencil.DeleteContext(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := stencil.Load(); !app.NotFound(err) {
+		t.Fatalf("expected not found, got %v", err)
+	}
+}
+
+func TestRESTResourceErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		check  func(err error) bool
+	}{
+		{"not found", http.StatusNotFound, app.NotFound},
+		{"forbidden", http.StatusForbidden, app.Forbidden},
+		{"unauthenticated", http.StatusUnauthorized, app.Unauthenticated},
+		{"internal server error", http.StatusInternalServerError, app.InternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newSettingsServer(t)
+			srv.status = tt.status
+			defer srv.Close()
+
+			repo := RESTResource[settings](serverContext(t, srv.Server, app.Connection{}), "/api/settings")
+			repo.Repo.Resilience = app.Resilience{}
+			if _, err := repo.Load(); !tt.check(err) {
+				t.Fatalf("load: unexpected error %v", err)
+			}
+
+			if err := repo.Save(settings{}); !tt.check(err) {
+				t.Fatalf("save: unexpected error %v", err)
+			}
+
+			if err := repo.Delete(); !tt.check(err) {
+				t.Fatalf("delete: unexpected error %v", err)
+			}
+		})
+	}
+}
+
+func TestRESTResourceTimeout(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	repo := RESTResource[settings](serverContext(t, srv, app.Connection{}), "/api/settings")
+	repo.Repo.Timeout = 10 * time.Millisecond
+	if err := repo.Save(settings{}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected the timeout to apply to save, got %v", err)
+	}
+
+	if _, err := repo.Load(); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected the timeout to apply to load, got %v", err)
+	}
+}
+
+func TestRESTResourcePathTemplate(t *testing.T) {
+	srv := newSettingsServer(t)
+	defer srv.Close()
+
+	repo := RESTResource[settings](serverContext(t, srv.Server, app.Connection{}), "/api/{section}")
+	if _, err := repo.Load(); err == nil {
+		t.Fatal("expected the unbound placeholder to fail")
+	}
+
+	repo.Repo.PathParams = Params{"section": "settings"}
+	if err := repo.Save(settings{Theme: "dark"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := srv.recorded(); len(got) != 1 || got[0] != "PUT /api/settings" {
+		t.Fatalf("expected a single request on the expanded path, got %v", got)
+	}
+}
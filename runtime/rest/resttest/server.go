@@ -0,0 +1,286 @@
+// Package resttest provides a fake backend which implements the conventions assumed by rest.RESTRepo, so that
+// repository declarations, error classification and runtimes can be tested without a real server.
+package resttest
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/gotrino/fusion/runtime/rest"
+	"github.com/gotrino/fusion/spec/app"
+	rest2 "github.com/gotrino/fusion/spec/rest"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Fault disturbs matching requests. A Fault without Status and Malformed only adds latency.
+type Fault struct {
+	Method    string        // Method like PUT restricts the fault to that verb. Empty matches all.
+	ID        string        // ID restricts the fault to requests of that entity, like rest.GetID returns it. Empty matches all.
+	Latency   time.Duration // Latency delays the response.
+	Status    int           // Status like 401, 403 or 500 is responded instead of performing the request.
+	Malformed bool          // Malformed responds with truncated json instead of the entity or list.
+	Times     int           // Times is the number of affected requests. Zero means all.
+}
+
+// Request is a recorded request.
+type Request struct {
+	Method string
+	Path   string
+	ID     string
+	Header http.Header
+	Body   []byte
+}
+
+// Server serves the entities of its Store following the REST conventions: GET on the collection lists all
+// entities, GET, PUT and DELETE on the collection path attached with the id load, save or delete a single entity.
+// Deleting a missing entity succeeds, as demanded by rest.Repository. Responses are json encoded and carry an ETag,
+// which is honoured by If-None-Match.
+type Server[T any] struct {
+	*httptest.Server
+	Store *rest.MemoryRepo[T]
+	// BasePath is the BasePath of the Connection, see Context, which prefixes the Path of the declaration. Set it
+	// before the first request.
+	BasePath string
+
+	connection string // connection is the Connection name of the declaration
+	template   []string
+	lock       sync.Mutex
+	faults     []*Fault
+	requests   []Request
+}
+
+// NewServer starts a server for the Path of the given repository declaration. Placeholders of a path template,
+// which are not bound by the declared Params, match any segment. The server must be closed when done.
+func NewServer[T any](spec rest2.Repository[T], seed ...T) *Server[T] {
+	p := spec.Path
+	for name, v := range spec.Params {
+		if expanded, err := rest.Expand("{"+name+"}", rest.Params{name: v}); err == nil {
+			p = strings.ReplaceAll(p, "{"+name+"}", expanded)
+		}
+	}
+
+	s := &Server[T]{Store: rest.NewMemory(seed...), connection: spec.Connection, template: segments(p)}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+
+	return s
+}
+
+// Inject adds a fault for the following requests.
+func (s *Server[T]) Inject(f Fault) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.faults = append(s.faults, &f)
+}
+
+// Reset removes all faults and recorded requests.
+func (s *Server[T]) Reset() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.faults = nil
+	s.requests = nil
+}
+
+// Requests returns the recorded requests in order of arrival.
+func (s *Server[T]) Requests() []Request {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return append([]Request{}, s.requests...)
+}
+
+// Context returns a context containing an app.Application, whose Connection points to this server and which
+// authenticates using the given bearer token. Use it to call New on repository declarations. If the declaration
+// names a Connection, only that one points to this server and the default Connection is unreachable, so that
+// requests ignoring the name fail.
+func (s *Server[T]) Context(ctx context.Context, token string) context.Context {
+	c := ConnectionOf(s.Server)
+	c.BasePath = s.BasePath
+	a := app.Application{
+		Title:          "resttest",
+		Authentication: app.HardcodedBearer{Token: token},
+		Connection:     c,
+	}
+
+	if s.connection != "" {
+		a.Connection = app.Connection{Scheme: "http", Host: "127.0.0.1", Port: 1}
+		a.Connections = map[string]app.Connection{s.connection: c}
+	}
+
+	return app.WithContext(ctx, a)
+}
+
+// ConnectionOf returns the Connection to the given test server, see app.ParseConnection.
+func ConnectionOf(srv *httptest.Server) app.Connection {
+	c, err := app.ParseConnection(srv.URL)
+	if err != nil {
+		panic(err)
+	}
+
+	return c
+}
+
+func (s *Server[T]) serve(w http.ResponseWriter, r *http.Request) {
+	id, ok := s.match(r.URL.EscapedPath())
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	var body bytes.Buffer
+	if r.Body != nil {
+		_, _ = body.ReadFrom(r.Body)
+	}
+
+	f := s.record(Request{Method: r.Method, Path: r.URL.Path, ID: id, Header: r.Header.Clone(), Body: body.Bytes()})
+	if f.Latency > 0 {
+		select {
+		case <-time.After(f.Latency):
+		case <-r.Context().Done():
+			return
+		}
+	}
+
+	if f.Status != 0 {
+		http.Error(w, http.StatusText(f.Status), f.Status)
+		return
+	}
+
+	switch {
+	case r.Method == http.MethodGet && id == "":
+		list, _ := s.Store.List()
+		s.write(w, r, list, f.Malformed)
+	case r.Method == http.MethodGet:
+		t, err := s.Store.Load(id)
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+
+		s.write(w, r, t, f.Malformed)
+	case r.Method == http.MethodPut && id != "":
+		var t T
+		if err := json.Unmarshal(body.Bytes(), &t); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if got, err := rest.GetID(t); err != nil || got != id {
+			http.Error(w, fmt.Sprintf("id of entity '%s' does not match path '%s'", got, id), http.StatusBadRequest)
+			return
+		}
+
+		_, err := s.Store.Load(id)
+		created := err != nil
+		if err := s.Store.Save(t); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		if created {
+			w.WriteHeader(http.StatusCreated)
+		} else {
+			w.WriteHeader(http.StatusNoContent)
+		}
+	case r.Method == http.MethodDelete && id != "":
+		_ = s.Store.Delete(id) // deleting a missing entity succeeds, see rest.Repository
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+	}
+}
+
+// record stores the request and returns the merged matching faults.
+func (s *Server[T]) record(req Request) Fault {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.requests = append(s.requests, req)
+
+	var res Fault
+	remaining := s.faults[:0]
+	for _, f := range s.faults {
+		if (f.Method == "" || f.Method == req.Method) && (f.ID == "" || f.ID == req.ID) {
+			res.Latency += f.Latency
+			if res.Status == 0 {
+				res.Status = f.Status
+			}
+
+			res.Malformed = res.Malformed || f.Malformed
+			if f.Times == 1 {
+				continue
+			}
+
+			if f.Times > 1 {
+				f.Times--
+			}
+		}
+
+		remaining = append(remaining, f)
+	}
+
+	s.faults = remaining
+	return res
+}
+
+func (s *Server[T]) write(w http.ResponseWriter, r *http.Request, v any, malformed bool) {
+	buf, err := json.Marshal(v)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if malformed {
+		_, _ = w.Write(buf[:len(buf)/2])
+		return
+	}
+
+	sum := sha256.Sum256(buf)
+	tag := `"` + hex.EncodeToString(sum[:8]) + `"`
+	w.Header().Set("ETag", tag)
+	if r.Header.Get("If-None-Match") == tag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	_, _ = w.Write(buf)
+}
+
+// match returns the id of an entity path or the empty id for the collection path itself. The remaining segments
+// are unescaped on their own, see rest.UnescapeID.
+func (s *Server[T]) match(escapedPath string) (string, bool) {
+	template := append(segments(s.BasePath), s.template...)
+	segs := segments(escapedPath)
+	if len(segs) < len(template) {
+		return "", false
+	}
+
+	for i, t := range template {
+		if !strings.HasPrefix(t, "{") && t != segs[i] {
+			return "", false
+		}
+	}
+
+	id, err := rest.UnescapeID(strings.Join(segs[len(template):], "/"))
+	return id, err == nil
+}
+
+func segments(p string) []string {
+	var res []string
+	for _, s := range strings.Split(p, "/") {
+		if s != "" {
+			res = append(res, s)
+		}
+	}
+
+	return res
+}
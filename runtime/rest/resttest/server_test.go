@@ -0,0 +1,130 @@
+package resttest
+
+import (
+	"context"
+	"errors"
+	"github.com/gotrino/fusion/runtime/rest"
+	"github.com/gotrino/fusion/spec/app"
+	http2 "github.com/gotrino/fusion/spec/http"
+	rest2 "github.com/gotrino/fusion/spec/rest"
+	"net/http"
+	"testing"
+)
+
+type book struct {
+	ID    string `json:"id"`
+	Title string `json:"title"`
+}
+
+func TestRESTRepo(t *testing.T) {
+	srv := NewServer(rest2.Repository[book]{Path: "/api/books"}, book{ID: "1", Title: "Dune"})
+	defer srv.Close()
+
+	repo := rest.REST[book](srv.Context(context.Background(), "secret"), "/api/books")
+	if err := repo.Save(book{ID: "a b/c", Title: "Emma"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := repo.Save(book{ID: "1", Title: "Dune Messiah"}); err != nil {
+		t.Fatal(err)
+	}
+
+	list, err := repo.List()
+	if err != nil || len(list) != 2 || list[0].Title != "Dune Messiah" || list[1].ID != "a b/c" {
+		t.Fatal(list, err)
+	}
+
+	id, _ := rest.GetID(list[1])
+	if b, err := repo.Load(id); err != nil || b.Title != "Emma" {
+		t.Fatal(b, err)
+	}
+
+	if err := repo.Delete(id); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := repo.Delete(id); err != nil {
+		t.Fatalf("expected deleting a missing entity to succeed, got %v", err)
+	}
+
+	if _, err := repo.Load(id); !app.NotFound(err) {
+		t.Fatalf("expected not found, got %v", err)
+	}
+
+	for _, req := range srv.Requests() {
+		if req.Header.Get("Authorization") != "Bearer secret" {
+			t.Fatalf("expected the bearer token, got %q", req.Header.Get("Authorization"))
+		}
+	}
+}
+
+func TestRESTRepoPathTemplate(t *testing.T) {
+	spec := rest2.Repository[book]{Path: "/api/authors/{author}/books", Params: rest.Params{"author": "frank herbert"}}
+	srv := NewServer(spec, book{ID: "1", Title: "Dune"})
+	defer srv.Close()
+
+	impl := spec.New(srv.Context(context.Background(), ""))
+	res, err := impl.Load("1")
+	if err != nil || res.(book).Title != "Dune" {
+		t.Fatal(res, err)
+	}
+
+	if got := srv.Requests()[0].Path; got != "/api/authors/frank herbert/books/1" {
+		t.Fatalf("unexpected path %s", got)
+	}
+}
+
+func TestContextOnNamedConnection(t *testing.T) {
+	spec := rest2.Repository[book]{Path: "/api/books", Connection: "books"}
+	srv := NewServer(spec, book{ID: "1", Title: "Dune"})
+	srv.BasePath = "/backend"
+	defer srv.Close()
+
+	ctx := srv.Context(context.Background(), "")
+	want := ConnectionOf(srv.Server)
+	c, err := app.FromContext[app.Application](ctx).ConnectionOf("books")
+	if err != nil || c.Host != want.Host || c.Port != want.Port || c.BasePath != "/backend" {
+		t.Fatalf("unexpected connection %+v %v", c, err)
+	}
+
+	res, err := spec.New(ctx).Load("1")
+	if err != nil || res.(book).Title != "Dune" {
+		t.Fatal(res, err)
+	}
+
+	if got := srv.Requests()[0].Path; got != "/backend/api/books/1" {
+		t.Fatalf("unexpected path %s", got)
+	}
+
+	if _, err := rest.REST[book](ctx, "/api/books").Load("1"); err == nil {
+		t.Fatal("expected the default connection to be unreachable")
+	}
+}
+
+func TestFaults(t *testing.T) {
+	srv := NewServer(rest2.Repository[book]{Path: "/api/books"}, book{ID: "1"}, book{ID: "2"})
+	defer srv.Close()
+
+	repo := rest.REST[book](srv.Context(context.Background(), ""), "/api/books")
+	repo.Resilience = app.Resilience{}
+
+	srv.Inject(Fault{Method: http.MethodGet, ID: "1", Status: http.StatusForbidden, Times: 1})
+	if _, err := repo.Load("1"); !app.Forbidden(err) {
+		t.Fatalf("expected forbidden, got %v", err)
+	}
+
+	if _, err := repo.Load("1"); err != nil {
+		t.Fatalf("expected the fault to be used up, got %v", err)
+	}
+
+	srv.Inject(Fault{Status: http.StatusUnauthorized, Times: 1})
+	if _, err := repo.Load("2"); !app.Unauthenticated(err) {
+		t.Fatalf("expected unauthenticated, got %v", err)
+	}
+
+	srv.Inject(Fault{Malformed: true, Times: 1})
+	var httpErr http2.HttpError
+	if _, err := repo.List(); !errors.As(err, &httpErr) || httpErr.Status != http2.DecoderError {
+		t.Fatalf("expected a decoder error, got %v", err)
+	}
+}
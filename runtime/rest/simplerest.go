@@ -3,66 +3,102 @@ package rest
 import (
 	"bytes"
 	"context"
-	"encoding/json"
 	"fmt"
 	"github.com/gotrino/fusion/spec/app"
 	http2 "github.com/gotrino/fusion/spec/http"
-	"log"
 	"path"
 	"strings"
+	"time"
 
 	"io"
 	"net/http"
 	"net/url"
-	"reflect"
 )
 
 func REST[T any](ctx context.Context, resource string) RESTRepo[T] {
-	a := app.FromContext[app.Application](ctx)
-	if strings.HasPrefix(resource, "/") {
-		resource = resource[1:]
+	return RESTOn[T](ctx, "", resource)
+}
+
+// RESTOn is like REST but uses the named Connection of the application, see app.Application.Connections. If the
+// connection is unknown or its configuration is invalid, each operation fails with that error.
+func RESTOn[T any](ctx context.Context, connection string, resource string) RESTRepo[T] {
+	c, err := app.FromContext[app.Application](ctx).ConnectionOf(connection)
+	if err != nil {
+		return RESTRepo[T]{Context: ctx, err: err}
 	}
-	base, err := url.Parse(fmt.Sprintf("%s://%s:%d/%s", a.Connection.Scheme, a.Connection.Host, a.Connection.Port, resource))
+
+	client, err := http2.ClientOn(ctx, connection)
 	if err != nil {
-		panic(err)
+		return RESTRepo[T]{Context: ctx, err: err}
 	}
-	log.Println("!! rest repo using", base.String())
 
-	return RESTRepo[T]{Base: base, WithRequest: http2.Authorizer(ctx)}
+	return RESTRepo[T]{
+		Context:        ctx,
+		Base:           http2.BaseURL(c, resource),
+		WithRequest:    http2.AuthorizerOn(ctx, connection),
+		Reauthenticate: http2.ReauthenticatorOn(ctx, connection),
+		Client:         client,
+		Resilience:     c.Resilience,
+	}
 }
 
 // RESTRepo is a simple more or less idiomatic REST based CRUD repository adapter. It makes really strong assumptions
 // about the verbs.
 type RESTRepo[T any] struct {
+	// Context is used by the operations without an explicit context. REST uses the composing context, which
+	// is canceled by the runtime when the activity goes away.
 	Context     context.Context
 	Base        *url.URL
 	WithRequest func(*http.Request) *http.Request
-	Client      *http.Client
+	// Reauthenticate renews the credentials after a request has been rejected with 401, so that it is replayed
+	// once. REST uses the registered refresher and the app.LoginFlow of the runtime, see http.ReauthenticatorOn.
+	Reauthenticate func(rejected *http.Request) bool
+	Client         *http.Client
 	// the actual resource like /api/movie
 	Resource string
+	// Resilience declares retries and circuit breaking, see http.Send.
+	Resilience app.Resilience
+	// ETags enables conditional GET requests using If-None-Match, if not nil.
+	ETags *ETags
+	// Timeout is the deadline of each single operation, including retries. Zero means no timeout.
+	Timeout time.Duration
+	// Codecs are offered in the given order using the Accept header. The first one encodes the request bodies
+	// and responses are decoded by the codec matching their Content-Type. Defaults to http.JSON.
+	Codecs []http2.Codec
+	// BulkPath is the path relative to the resource, which accepts a list of entities to save using PUT and a list
+	// of ids to delete using DELETE, like /api/movies/batch. The server reports the outcome of each item, see
+	// BulkOutcome. If empty or unknown to the server, batches are processed by concurrent requests.
+	BulkPath string
+	// Concurrency limits the amount of parallel requests of a batch. Zero means DefaultConcurrency.
+	Concurrency int
+	// PathParams binds the placeholders of the Base path, like /api/authors/{authorID}/books. Operations fail, if
+	// a placeholder is not bound.
+	PathParams Params
+	// Events declares the change stream used by Watch.
+	Events WatchOptions
+	// Content declares the binary content of the entities used by Upload and Download.
+	Content ContentOptions
+
+	err error // err is a configuration error, which fails each operation, see RESTOn
 }
 
 func (r RESTRepo[T]) ToStencil() app.RepositoryImplStencil {
-	return stencilAdapter[T]{r}
+	return Stencil[T](r)
 }
 
 // List performs a get on the root resource, like GET /api/movies and expects a json array.
 func (r RESTRepo[T]) List() ([]T, error) {
-	resp, err := r.client().Do(r.req("GET", "", nil))
-	if err != nil {
-		return nil, err
-	}
-
-	defer resp.Body.Close()
+	return r.ListContext(r.Context)
+}
 
-	if resp.StatusCode != http.StatusOK {
-		return nil, http2.HttpError{Status: resp.StatusCode}
-	}
+// ListContext is like List but bound to the given context.
+func (r RESTRepo[T]) ListContext(ctx context.Context) ([]T, error) {
+	ctx, cancel := r.bind(ctx)
+	defer cancel()
 
 	var res []T
-	dec := json.NewDecoder(resp.Body)
-	if err := dec.Decode(&res); err != nil {
-		return nil, http2.HttpError{Status: http2.DecoderError, Cause: err}
+	if err := r.get(ctx, "", &res); err != nil {
+		return nil, err
 	}
 
 	return res, nil
@@ -70,37 +106,95 @@ func (r RESTRepo[T]) List() ([]T, error) {
 
 // Load performs a get on the root resource attached with the id, like GET /api/movies/{id}.
 func (r RESTRepo[T]) Load(id string) (T, error) {
+	return r.LoadContext(r.Context, id)
+}
+
+// LoadContext is like Load but bound to the given context.
+func (r RESTRepo[T]) LoadContext(ctx context.Context, id string) (T, error) {
+	ctx, cancel := r.bind(ctx)
+	defer cancel()
+
 	var res T
-	resp, err := r.client().Do(r.req("GET", id, nil))
+	err := r.get(ctx, id, &res)
+	return res, err
+}
+
+// get performs a conditional get, if ETags are available and decodes the json response into dst.
+func (r RESTRepo[T]) get(ctx context.Context, id string, dst any) error {
+	req, err := r.req(ctx, "GET", id, nil)
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Accept", http2.Accept(r.codecs()...))
+	key := req.URL.String()
+	if tag, _, _, ok := r.ETags.lookup(key); ok {
+		req.Header.Set("If-None-Match", tag)
+	}
+
+	resp, err := r.do(req)
 	if err != nil {
-		return res, err
+		return err
 	}
 
 	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return res, http2.HttpError{Status: resp.StatusCode}
+	var body io.Reader = resp.Body
+	contentType := resp.Header.Get("Content-Type")
+	switch resp.StatusCode {
+	case http.StatusOK:
+		if tag := resp.Header.Get("ETag"); tag != "" && r.ETags != nil {
+			buf, err := io.ReadAll(resp.Body)
+			if err != nil {
+				return err
+			}
+
+			r.ETags.store(key, tag, contentType, buf)
+			body = bytes.NewReader(buf)
+		}
+	case http.StatusNotModified:
+		_, cached, buf, ok := r.ETags.lookup(key)
+		if !ok {
+			return http2.ResponseError(resp)
+		}
+
+		contentType = cached
+		body = bytes.NewReader(buf)
+	default:
+		return http2.ResponseError(resp)
 	}
 
-	dec := json.NewDecoder(resp.Body)
-	if err := dec.Decode(&res); err != nil {
-		return res, http2.HttpError{Status: http2.DecoderError, Cause: err}
+	if err := r.codec(contentType).Decode(body, dst); err != nil {
+		return http2.HttpError{Status: http2.DecoderError, Cause: err}
 	}
 
-	return res, nil
+	return nil
 }
 
 // Delete performs a delete on the root resource attached with the id, like DELETE /api/movies/{id}.
 func (r RESTRepo[T]) Delete(id string) error {
-	req := r.req("DELETE", id, nil)
-	log.Println(">>", req.URL)
-	resp, err := r.client().Do(req)
+	return r.DeleteContext(r.Context, id)
+}
+
+// DeleteContext is like Delete but bound to the given context.
+func (r RESTRepo[T]) DeleteContext(ctx context.Context, id string) error {
+	ctx, cancel := r.bind(ctx)
+	defer cancel()
+
+	req, err := r.req(ctx, "DELETE", id, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := r.do(req)
 	if err != nil {
 		return err
 	}
 
 	defer resp.Body.Close()
 
+	r.ETags.forget(r.key(""), req.URL.String())
+
 	switch resp.StatusCode {
 	case http.StatusAccepted:
 		fallthrough
@@ -108,7 +202,7 @@ func (r RESTRepo[T]) Delete(id string) error {
 		fallthrough
 	case http.StatusOK:
 	default:
-		return http2.HttpError{Status: resp.StatusCode}
+		return http2.ResponseError(resp)
 	}
 
 	return nil
@@ -116,25 +210,45 @@ func (r RESTRepo[T]) Delete(id string) error {
 
 // Save performs a put on the root resource attached with the id, like PUT /api/movies/{id}.
 func (r RESTRepo[T]) Save(t T) error {
+	return r.SaveContext(r.Context, t)
+}
+
+// SaveContext is like Save but bound to the given context.
+func (r RESTRepo[T]) SaveContext(ctx context.Context, t T) error {
+	ctx, cancel := r.bind(ctx)
+	defer cancel()
+
 	id, err := GetID(t)
 	if err != nil {
 		panic(err)
 	}
 
-	buf, err := json.Marshal(t)
-	if err != nil {
+	return r.put(ctx, id, t)
+}
+
+// put encodes the entity using the preferred codec and performs a put on the root resource attached with the id.
+func (r RESTRepo[T]) put(ctx context.Context, id string, t T) error {
+	codec := r.codecs()[0]
+	var buf bytes.Buffer
+	if err := codec.Encode(&buf, t); err != nil {
 		return http2.HttpError{Status: http2.EncoderError, Cause: err}
 	}
 
-	req := r.req("PUT", id, bytes.NewReader(buf))
-	req.Header.Set("Content-Type", "application/json")
-	resp, err := r.client().Do(req)
+	req, err := r.req(ctx, "PUT", id, bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", codec.ContentType())
+	resp, err := r.do(req)
 	if err != nil {
-		return http2.HttpError{Cause: err}
+		return err
 	}
 
 	defer resp.Body.Close()
 
+	r.ETags.forget(r.key(""), req.URL.String())
+
 	switch resp.StatusCode {
 	case http.StatusAccepted:
 		fallthrough
@@ -145,93 +259,293 @@ func (r RESTRepo[T]) Save(t T) error {
 	case http.StatusOK:
 		return nil
 	default:
-		return http2.HttpError{Status: resp.StatusCode}
+		return http2.ResponseError(resp)
 	}
 }
 
-func (r RESTRepo[T]) client() *http.Client {
-	if r.Client == nil {
-		return http.DefaultClient
+// SaveAll performs a put with all entities on the BulkPath, like PUT /api/movies/batch. Without a BulkPath each
+// entity is saved separately using at most Concurrency requests in parallel. An entity without id fails on its own.
+func (r RESTRepo[T]) SaveAll(ctx context.Context, ts []T) ([]app.BatchResult, error) {
+	res := make([]app.BatchResult, len(ts))
+	valid := make([]int, 0, len(ts))
+	for i, t := range ts {
+		res[i].ID, res[i].Err = GetID(t)
+		if res[i].Err == nil {
+			valid = append(valid, i)
+		}
 	}
 
-	return r.Client
+	save := func(i int) error {
+		return r.SaveContext(ctx, ts[i])
+	}
+
+	if r.BulkPath == "" {
+		return each(res, valid, r.Concurrency, save)
+	}
+
+	items := make([]T, 0, len(valid))
+	for _, i := range valid {
+		items = append(items, ts[i])
+	}
+
+	return r.bulk(ctx, "PUT", items, res, valid, save)
 }
 
-func (r RESTRepo[T]) req(method string, p string, body io.Reader) *http.Request {
-	if r.Base == nil {
-		u, err := url.Parse("http://localhost:8080")
-		if err != nil {
-			panic(err)
+// DeleteAll performs a delete with all ids on the BulkPath, like DELETE /api/movies/batch. Without a BulkPath each
+// entity is deleted separately using at most Concurrency requests in parallel.
+func (r RESTRepo[T]) DeleteAll(ctx context.Context, ids []string) ([]app.BatchResult, error) {
+	res := make([]app.BatchResult, len(ids))
+	valid := make([]int, len(ids))
+	for i, id := range ids {
+		res[i].ID = id
+		valid[i] = i
+	}
+
+	del := func(i int) error {
+		return r.DeleteContext(ctx, ids[i])
+	}
+
+	if r.BulkPath == "" {
+		return each(res, valid, r.Concurrency, del)
+	}
+
+	return r.bulk(ctx, "DELETE", ids, res, valid, del)
+}
+
+// bulk sends the items to the BulkPath and applies the reported outcomes to the results at the valid indices.
+// If the server does not know the BulkPath, each item is processed on its own using single.
+func (r RESTRepo[T]) bulk(ctx context.Context, method string, items any, res []app.BatchResult, valid []int, single func(i int) error) ([]app.BatchResult, error) {
+	// all applies the same outcome to the valid items
+	all := func(err error) ([]app.BatchResult, error) {
+		for _, i := range valid {
+			res[i].Err = err
 		}
 
-		r.Base = u
+		return batchResult(res)
+	}
+
+	if len(valid) == 0 {
+		return batchResult(res)
+	}
+
+	bctx, cancel := r.bind(ctx)
+	defer cancel()
+
+	codec := r.codecs()[0]
+	var buf bytes.Buffer
+	if err := codec.Encode(&buf, items); err != nil {
+		return all(http2.HttpError{Status: http2.EncoderError, Cause: err})
 	}
 
-	u, err := r.Base.Parse(path.Join(r.Base.String(), p))
+	req, err := r.req(bctx, method, r.BulkPath, bytes.NewReader(buf.Bytes()))
 	if err != nil {
-		panic(err)
+		return all(err)
 	}
 
-	ctx := r.Context
-	if ctx == nil {
-		ctx = context.Background()
+	req.Header.Set("Content-Type", codec.ContentType())
+	req.Header.Set("Accept", http2.Accept(r.codecs()...))
+	resp, err := r.do(req)
+	if err != nil {
+		return all(err)
+	}
+
+	defer resp.Body.Close()
+
+	r.ETags.forget(r.key(""))
+
+	switch resp.StatusCode {
+	case http.StatusNotFound, http.StatusMethodNotAllowed, http.StatusNotImplemented:
+		return each(res, valid, r.Concurrency, single)
+	case http.StatusOK, http.StatusCreated, http.StatusAccepted, http.StatusNoContent, http.StatusMultiStatus:
+	default:
+		return all(http2.ResponseError(resp))
 	}
 
-	req, err := http.NewRequestWithContext(ctx, method, u.String(), body)
+	outcomes, err := r.outcomes(resp)
 	if err != nil {
-		panic(err)
+		return all(err)
+	}
+
+	if outcomes == nil {
+		return all(nil) // the batch has been applied as a whole
+	}
+
+	byID := make(map[string]BulkOutcome, len(outcomes))
+	for _, o := range outcomes {
+		if o.ID != "" {
+			byID[o.ID] = o
+		}
 	}
 
-	if r.WithRequest != nil {
-		req = r.WithRequest(req)
+	for k, i := range valid {
+		o, ok := byID[res[i].ID]
+		if !ok && k < len(outcomes) && outcomes[k].ID == "" {
+			o, ok = outcomes[k], true
+		}
+
+		if !ok {
+			res[i].Err = http2.HttpError{Status: resp.StatusCode, Cause: fmt.Errorf("no outcome reported for '%s'", res[i].ID)}
+			continue
+		}
+
+		res[i].Err = o.err()
 	}
 
-	return req
+	return batchResult(res)
 }
 
-// GetID returns the entity either by calling ID()string method or grabbing the ID string field.
-func GetID(a any) (string, error) {
-	if ider, ok := a.(interface{ ID() string }); ok {
-		return ider.ID(), nil
+// outcomes decodes the per item outcomes of a bulk response. A 207 Multi-Status must report them, other
+// responses without outcomes mean that all items succeeded.
+func (r RESTRepo[T]) outcomes(resp *http.Response) ([]BulkOutcome, error) {
+	buf, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, http2.HttpError{Status: resp.StatusCode, Cause: err}
 	}
 
-	t := reflect.TypeOf(a)
-	for i := 0; i < t.NumField(); i++ {
-		f := t.Field(i)
-		if f.Name == "ID" && f.Type.Name() == "string" {
-			return reflect.ValueOf(a).Field(i).String(), nil
-		}
+	var outcomes []BulkOutcome
+	if len(bytes.TrimSpace(buf)) > 0 {
+		err = r.codec(resp.Header.Get("Content-Type")).Decode(bytes.NewReader(buf), &outcomes)
+	}
+
+	reported := err == nil && len(outcomes) > 0
+	for _, o := range outcomes {
+		reported = reported && o.Status != 0 // e.g. a list of the saved entities instead
+	}
+
+	if reported {
+		return outcomes, nil
+	}
+
+	if resp.StatusCode == http.StatusMultiStatus {
+		return nil, http2.HttpError{Status: http2.DecoderError, Cause: fmt.Errorf("multi-status without outcomes: %w", err)}
+	}
+
+	return nil, nil
+}
+
+// do decorates the request using WithRequest and sends it. A request rejected with 401 is replayed once, if
+// Reauthenticate has renewed the credentials.
+func (r RESTRepo[T]) do(req *http.Request) (*http.Response, error) {
+	return http2.SendAuthorized(r.client(), req, r.Resilience, r.WithRequest, r.Reauthenticate)
+}
+
+func (r RESTRepo[T]) codecs() []http2.Codec {
+	if len(r.Codecs) == 0 {
+		return []http2.Codec{http2.JSON{}}
 	}
 
-	return "", fmt.Errorf("type " + t.String() + " must either provider 'ID() string' method oder 'ID string' field")
+	return r.Codecs
 }
 
-type stencilAdapter[T any] struct {
-	impl RESTRepo[T]
+// codec negotiates the codec for the given Content-Type and falls back to the preferred one.
+func (r RESTRepo[T]) codec(contentType string) http2.Codec {
+	if c, ok := http2.Negotiate(contentType, r.codecs()...); ok {
+		return c
+	}
+
+	return r.codecs()[0]
 }
 
-func (s stencilAdapter[T]) List() ([]any, error) {
-	res, err := s.impl.List()
+func (r RESTRepo[T]) client() *http.Client {
+	if r.Client == nil {
+		return http.DefaultClient
+	}
+
+	return r.Client
+}
+
+// URL returns the url of the resource, whose placeholders are bound by the PathParams. It is an error, if a
+// placeholder is not bound or the connection is invalid, see RESTOn.
+func (r RESTRepo[T]) URL() (*url.URL, error) {
+	if r.err != nil {
+		return nil, r.err
+	}
+
+	if r.Base == nil {
+		r.Base = defaultBase()
+	}
+
+	u := *r.Base
+	if strings.Contains(u.Path, "{") {
+		expanded, err := Expand(u.Path, r.PathParams)
+		if err != nil {
+			return nil, err
+		}
+
+		dec, err := url.PathUnescape(expanded)
+		if err != nil {
+			return nil, err
+		}
+
+		u.Path, u.RawPath = dec, expanded
+	}
+
+	return &u, nil
+}
+
+// url returns the URL attached with p, which is a relative path or an id and escaped by EscapeID.
+func (r RESTRepo[T]) url(p string) (*url.URL, error) {
+	u, err := r.URL()
 	if err != nil {
 		return nil, err
 	}
 
-	boxed := make([]any, 0, len(res))
-	for _, t := range res {
-		boxed = append(boxed, t)
+	raw := path.Join(u.EscapedPath(), EscapeID(p))
+	if dec, err := url.PathUnescape(raw); err == nil {
+		u.Path, u.RawPath = dec, raw
+	} else {
+		u.Path, u.RawPath = path.Join(u.Path, p), ""
 	}
 
-	return boxed, nil
+	return u, nil
 }
 
-func (s stencilAdapter[T]) Load(id string) (any, error) {
-	return s.impl.Load(id)
+// key returns the url attached with p as used by the ETags. The key is empty, if the url cannot be built.
+func (r RESTRepo[T]) key(p string) string {
+	u, err := r.url(p)
+	if err != nil {
+		return ""
+	}
+
+	return u.String()
+}
+
+// postPolicy returns the policy of the repositories, which post each operation to a single endpoint, like JSONRPC
+// and GraphQL. Retries are disabled, because the server cannot recognize a repeated POST and would apply a mutation
+// twice. The circuit breaker still applies. Set Resilience.MaxRetries on such a repository only, if all its
+// operations are idempotent.
+func postPolicy(p app.Resilience) app.Resilience {
+	p.MaxRetries = 0
+	return p
 }
 
-func (s stencilAdapter[T]) Delete(id string) error {
-	return s.impl.Delete(id)
+// bind applies the Timeout to the given context, which defaults to context.Background.
+func (r RESTRepo[T]) bind(ctx context.Context) (context.Context, context.CancelFunc) {
+	return withTimeout(ctx, r.Timeout)
 }
 
-func (s stencilAdapter[T]) Save(t any) error {
-	return s.impl.Save(t.(T))
+func withTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	if timeout > 0 {
+		return context.WithTimeout(ctx, timeout)
+	}
+
+	return context.WithCancel(ctx)
+}
+
+// defaultBase is used if a repository has no base url configured.
+func defaultBase() *url.URL {
+	return &url.URL{Scheme: "http", Host: "localhost:8080"}
+}
+
+func (r RESTRepo[T]) req(ctx context.Context, method string, p string, body io.Reader) (*http.Request, error) {
+	u, err := r.url(p)
+	if err != nil {
+		return nil, err
+	}
+
+	return http.NewRequestWithContext(ctx, method, u.String(), body)
 }
@@ -0,0 +1,137 @@
+package rest
+
+import (
+	"context"
+	"fmt"
+	"github.com/gotrino/fusion/spec/app"
+	"github.com/gotrino/fusion/spec/observe"
+)
+
+// Stencil adapts any typed Repository into the untyped app.RepositoryImplStencil. The stencil also implements
+// app.ContextRepositoryImplStencil, app.IterableImplStencil and app.BatchRepositoryImplStencil, which delegate to the according
+// capabilities of the repository if available. All operations are reported to the observe.Observer.
+func Stencil[T any](repo Repository[T]) app.RepositoryImplStencil {
+	return newStencilAdapter[T](repo)
+}
+
+type stencilAdapter[T any] struct {
+	impl Repository[T]
+	name string // name is the type of impl, which is reported as observe.Operation.Repository
+}
+
+func newStencilAdapter[T any](repo Repository[T]) stencilAdapter[T] {
+	return stencilAdapter[T]{impl: repo, name: fmt.Sprintf("%T", repo)}
+}
+
+func (s stencilAdapter[T]) op(name, id string) observe.Operation {
+	return observe.Operation{Repository: s.name, Name: name, ID: id}
+}
+
+func (s stencilAdapter[T]) List() ([]any, error) {
+	_, end := observe.StartOperation(context.Background(), s.op("list", ""))
+	res, err := s.impl.List()
+	end(err)
+	if err != nil {
+		return nil, err
+	}
+
+	return box(res), nil
+}
+
+func (s stencilAdapter[T]) ListContext(ctx context.Context) ([]any, error) {
+	ctx, end := observe.StartOperation(ctx, s.op("list", ""))
+	if it, ok := s.impl.(IterableRepository[T]); ok {
+		res, err := collect(ctx, it)
+		end(err)
+
+		return res, err
+	}
+
+	res, err := listContext(ctx, s.impl)
+	end(err)
+	if err != nil {
+		return nil, err
+	}
+
+	return box(res), nil
+}
+
+func box[T any](res []T) []any {
+	boxed := make([]any, 0, len(res))
+	for _, t := range res {
+		boxed = append(boxed, t)
+	}
+
+	return boxed
+}
+
+func (s stencilAdapter[T]) Load(id string) (any, error) {
+	_, end := observe.StartOperation(context.Background(), s.op("load", id))
+	res, err := s.impl.Load(id)
+	end(err)
+
+	return res, err
+}
+
+func (s stencilAdapter[T]) LoadContext(ctx context.Context, id string) (any, error) {
+	ctx, end := observe.StartOperation(ctx, s.op("load", id))
+	res, err := loadContext(ctx, s.impl, id)
+	end(err)
+
+	return res, err
+}
+
+func (s stencilAdapter[T]) Delete(id string) error {
+	_, end := observe.StartOperation(context.Background(), s.op("delete", id))
+	err := s.impl.Delete(id)
+	end(err)
+
+	return err
+}
+
+func (s stencilAdapter[T]) DeleteContext(ctx context.Context, id string) error {
+	ctx, end := observe.StartOperation(ctx, s.op("delete", id))
+	err := deleteContext(ctx, s.impl, id)
+	end(err)
+
+	return err
+}
+
+func (s stencilAdapter[T]) Save(t any) error {
+	id, _ := GetID(t)
+	_, end := observe.StartOperation(context.Background(), s.op("save", id))
+	err := s.impl.Save(t.(T))
+	end(err)
+
+	return err
+}
+
+func (s stencilAdapter[T]) SaveContext(ctx context.Context, t any) error {
+	id, _ := GetID(t)
+	ctx, end := observe.StartOperation(ctx, s.op("save", id))
+	err := saveContext(ctx, s.impl, t.(T))
+	end(err)
+
+	return err
+}
+
+func (s stencilAdapter[T]) SaveAll(ctx context.Context, ts []any) ([]app.BatchResult, error) {
+	typed := make([]T, 0, len(ts))
+	for _, t := range ts {
+		typed = append(typed, t.(T))
+	}
+
+	ctx, end := observe.StartOperation(ctx, s.op("saveAll", ""))
+	res, err := SaveAll(ctx, s.impl, typed, 0)
+	end(err)
+
+	return res, err
+}
+
+func (s stencilAdapter[T]) DeleteAll(ctx context.Context, ids []string) ([]app.BatchResult, error) {
+	ctx, end := observe.StartOperation(ctx, s.op("deleteAll", ""))
+	res, err := DeleteAll(ctx, s.impl, ids, 0)
+	end(err)
+
+	return res, err
+}
@@ -0,0 +1,445 @@
+package rest
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/gotrino/fusion/spec/app"
+	http2 "github.com/gotrino/fusion/spec/http"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Transport selects the protocol of a change stream.
+type Transport int
+
+const (
+	// SSE uses Server-Sent Events with the event types created, updated and deleted. Events without type, which
+	// EventSource calls message, carry the change as json envelope like those of WebSocket.
+	SSE Transport = iota
+	// WebSocket expects json text messages like {"type":"created","id":"1","entity":{...}}.
+	WebSocket
+)
+
+// WatchOptions declares how a RESTRepo streams the changes of its entities.
+type WatchOptions struct {
+	// Path is relative to the resource, like events. If empty, the resource itself is requested.
+	Path      string
+	Transport Transport
+	// RetryDelay is the delay before reconnecting. Defaults to 3 seconds and may be changed by the server
+	// using the SSE retry field.
+	RetryDelay time.Duration
+}
+
+// Watcher is an optional capability of a Repository, which streams the changes of the entities. A lost connection
+// is reestablished transparently. The channel is closed when the context is canceled or the stream has
+// failed permanently, e.g. because the server responded with 403.
+type Watcher[T any] interface {
+	Watch(ctx context.Context) (<-chan Event[T], error)
+}
+
+// Watch connects to the change stream declared by Events. A reconnect resumes the stream by sending the id of the
+// last received event as Last-Event-ID header. The Timeout of the Client is ignored for the stream.
+func (r RESTRepo[T]) Watch(ctx context.Context) (<-chan Event[T], error) {
+	s := &stream[T]{repo: r, delay: r.Events.RetryDelay}
+	if s.delay <= 0 {
+		s.delay = 3 * time.Second
+	}
+
+	src, err := s.connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	ch := make(chan Event[T])
+	go s.run(ctx, src, ch)
+
+	return ch, nil
+}
+
+// rawEvent is a transport independent change notification.
+type rawEvent struct {
+	typ      string
+	eventID  string
+	entityID string
+	data     []byte
+	retry    time.Duration
+}
+
+type eventSource interface {
+	next() (rawEvent, error)
+	close()
+}
+
+type stream[T any] struct {
+	repo        RESTRepo[T]
+	lastEventID string
+	delay       time.Duration
+}
+
+func (s *stream[T]) run(ctx context.Context, src eventSource, ch chan<- Event[T]) {
+	defer close(ch)
+
+	for {
+		for {
+			raw, err := src.next()
+			if err != nil {
+				break
+			}
+
+			if raw.eventID != "" {
+				s.lastEventID = raw.eventID
+			}
+
+			if raw.retry > 0 {
+				s.delay = raw.retry
+			}
+
+			e, ok := s.decode(raw)
+			if !ok {
+				continue
+			}
+
+			select {
+			case ch <- e:
+			case <-ctx.Done():
+				src.close()
+				return
+			}
+		}
+
+		src.close()
+
+		for {
+			timer := time.NewTimer(s.delay)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			case <-timer.C:
+			}
+
+			var err error
+			src, err = s.connect(ctx)
+			if err == nil {
+				break
+			}
+
+			if permanent(err) {
+				return
+			}
+		}
+	}
+}
+
+// permanent reports client errors, which will not vanish by reconnecting.
+func permanent(err error) bool {
+	var httpErr http2.HttpError
+	if !errors.As(err, &httpErr) {
+		return false
+	}
+
+	return httpErr.Status >= 400 && httpErr.Status < 500 && httpErr.Status != http.StatusRequestTimeout && httpErr.Status != http.StatusTooManyRequests
+}
+
+// connect sends the request like all other requests of the repository, so that it is authorized and replayed
+// after a 401, once the credentials have been renewed.
+func (s *stream[T]) connect(ctx context.Context) (eventSource, error) {
+	client := *s.repo.client()
+	client.Timeout = 0 // the stream is long-lived, but reconnects are bound to the context
+	req, err := s.repo.req(ctx, "GET", s.repo.Events.Path, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if s.lastEventID != "" {
+		req.Header.Set("Last-Event-ID", s.lastEventID)
+	}
+
+	send := func(req *http.Request) (*http.Response, error) {
+		return http2.SendAuthorized(&client, req, s.repo.Resilience, s.repo.WithRequest, s.repo.Reauthenticate)
+	}
+
+	if s.repo.Events.Transport == WebSocket {
+		conn, resp, err := dialWebSocket(req, send)
+		if err != nil {
+			if resp != nil {
+				return nil, http2.HttpError{Status: resp.StatusCode, Cause: err}
+			}
+
+			return nil, err
+		}
+
+		return wsSource{conn}, nil
+	}
+
+	req.Header.Set("Accept", "text/event-stream")
+	req.Header.Set("Cache-Control", "no-cache")
+	resp, err := send(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		return nil, http2.ResponseError(resp)
+	}
+
+	return &sseSource{body: resp.Body, r: bufio.NewReader(resp.Body)}, nil
+}
+
+// decode converts the raw event into a typed Event and ignores unknown event types, like heartbeats.
+func (s *stream[T]) decode(raw rawEvent) (Event[T], bool) {
+	e := Event[T]{Type: EventType(raw.typ), ID: raw.entityID}
+	switch e.Type {
+	case Created, Updated, Deleted:
+	default:
+		return e, false
+	}
+
+	var entity T
+	decoded := len(raw.data) > 0 && json.Unmarshal(raw.data, &entity) == nil
+	if e.ID == "" && decoded {
+		e.ID, _ = GetID(entity)
+	}
+
+	if e.ID == "" && len(raw.data) > 0 {
+		var ref struct {
+			ID json.RawMessage `json:"id"`
+		}
+
+		if json.Unmarshal(raw.data, &ref) == nil && len(ref.ID) > 0 {
+			if err := json.Unmarshal(ref.ID, &e.ID); err != nil {
+				e.ID = string(ref.ID)
+			}
+		}
+	}
+
+	if e.Type != Deleted {
+		if !decoded {
+			return e, false
+		}
+
+		e.Entity = entity
+	}
+
+	return e, true
+}
+
+// sseSource parses a text/event-stream.
+type sseSource struct {
+	body interface{ Close() error }
+	r    *bufio.Reader
+}
+
+func (s *sseSource) next() (rawEvent, error) {
+	var e rawEvent
+	var data []string
+	for {
+		line, err := s.r.ReadString('\n')
+		if err != nil {
+			return e, err
+		}
+
+		line = strings.TrimRight(line, "\r\n")
+		if line == "" {
+			if len(data) == 0 && e.typ == "" {
+				continue
+			}
+
+			e.data = []byte(strings.Join(data, "\n"))
+			if e.typ == "" || e.typ == "message" {
+				// a message without event type carries the change as envelope, like those of websockets
+				env, ok := envelope(e.data)
+				if !ok {
+					e, data = rawEvent{}, nil
+					continue
+				}
+
+				if e.eventID != "" {
+					env.eventID = e.eventID
+				}
+
+				env.retry = e.retry
+				return env, nil
+			}
+
+			return e, nil
+		}
+
+		if strings.HasPrefix(line, ":") {
+			continue
+		}
+
+		field, value, _ := strings.Cut(line, ":")
+		value = strings.TrimPrefix(value, " ")
+		switch field {
+		case "event":
+			e.typ = value
+		case "data":
+			data = append(data, value)
+		case "id":
+			if !strings.Contains(value, "\x00") {
+				e.eventID = value
+			}
+		case "retry":
+			if ms, err := strconv.Atoi(value); err == nil && ms > 0 {
+				e.retry = time.Duration(ms) * time.Millisecond
+			}
+		}
+	}
+}
+
+func (s *sseSource) close() {
+	s.body.Close()
+}
+
+// wsSource reads json messages from a websocket.
+type wsSource struct {
+	conn *wsConn
+}
+
+func (s wsSource) next() (rawEvent, error) {
+	for {
+		buf, err := s.conn.ReadMessage()
+		if err != nil {
+			return rawEvent{}, err
+		}
+
+		if e, ok := envelope(buf); ok {
+			return e, nil
+		}
+	}
+}
+
+// envelope parses a json change message like {"type":"created","id":"1","eventId":"7","entity":{...}}.
+func envelope(buf []byte) (rawEvent, bool) {
+	var msg struct {
+		Type    string          `json:"type"`
+		ID      string          `json:"id"`
+		EventID string          `json:"eventId"`
+		Entity  json.RawMessage `json:"entity"`
+	}
+
+	if err := json.Unmarshal(buf, &msg); err != nil {
+		return rawEvent{}, false
+	}
+
+	return rawEvent{typ: msg.Type, eventID: msg.EventID, entityID: msg.ID, data: msg.Entity}, true
+}
+
+func (s wsSource) close() {
+	s.conn.Close()
+}
+
+// Watch streams the changes of the memory repository until the context is canceled. Changes are never blocked
+// by a watcher: if a watcher falls behind by more than the buffer of 64 events, it is disconnected and its
+// channel is closed, so it has to reload the entities and watch again.
+func (r *MemoryRepo[T]) Watch(ctx context.Context) (<-chan Event[T], error) {
+	ch := make(chan Event[T], 64)
+	disconnected := make(chan struct{})
+	var lock sync.Mutex
+	closed := false
+
+	disconnect := func() { // requires the lock
+		closed = true
+		close(ch)
+		close(disconnected)
+	}
+
+	unsubscribe := r.Subscribe(func(e Event[T]) {
+		lock.Lock()
+		defer lock.Unlock()
+
+		if closed {
+			return
+		}
+
+		select {
+		case ch <- e:
+		default:
+			disconnect()
+		}
+	})
+
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-disconnected:
+		}
+
+		unsubscribe()
+
+		lock.Lock()
+		defer lock.Unlock()
+
+		if !closed {
+			disconnect()
+		}
+	}()
+
+	return ch, nil
+}
+
+// Watch forwards the changes of the decorated repository and invalidates the affected cache entries.
+func (r CachedRepo[T]) Watch(ctx context.Context) (<-chan Event[T], error) {
+	w, ok := r.Repo.(Watcher[T])
+	if !ok {
+		return nil, app.ErrWatchNotSupported
+	}
+
+	src, err := w.Watch(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	ch := make(chan Event[T])
+	go func() {
+		defer close(ch)
+		for e := range src {
+			r.Cache.Invalidate(listKey, entityKey(e.ID))
+			select {
+			case ch <- e:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return ch, nil
+}
+
+func (s stencilAdapter[T]) Watch(ctx context.Context) (<-chan app.Change, error) {
+	w, ok := s.impl.(Watcher[T])
+	if !ok {
+		return nil, app.ErrWatchNotSupported
+	}
+
+	src, err := w.Watch(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	ch := make(chan app.Change)
+	go func() {
+		defer close(ch)
+		for e := range src {
+			c := app.Change{Type: string(e.Type), ID: e.ID}
+			if e.Type != Deleted {
+				c.Entity = e.Entity
+			}
+
+			select {
+			case ch <- c:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return ch, nil
+}
@@ -0,0 +1,269 @@
+package rest
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"github.com/gotrino/fusion/spec/app"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSSEFraming(t *testing.T) {
+	stream := ": heartbeat\r\n\r\n" +
+		"id: 1\r\nevent: created\r\nretry: 500\r\ndata: {\"id\":\"1\",\r\ndata: \"title\":\"Dune\"}\r\n\r\n" +
+		"data: not an envelope\n\n" +
+		"id: 2\ndata: {\"type\":\"deleted\",\"id\":\"1\"}\n\n" +
+		"event: message\ndata: {\"type\":\"updated\",\"eventId\":\"3\",\"entity\":{\"id\":\"2\"}}\n\n" +
+		"event: unterminated\n"
+
+	src := &sseSource{body: io.NopCloser(nil), r: bufio.NewReader(strings.NewReader(stream))}
+	want := []rawEvent{
+		{typ: "created", eventID: "1", data: []byte("{\"id\":\"1\",\n\"title\":\"Dune\"}"), retry: 500 * time.Millisecond},
+		{typ: "deleted", eventID: "2", entityID: "1"},
+		{typ: "updated", eventID: "3", data: []byte(`{"id":"2"}`)},
+	}
+
+	for i, w := range want {
+		e, err := src.next()
+		if err != nil {
+			t.Fatalf("event %d: %v", i, err)
+		}
+
+		if e.typ != w.typ || e.eventID != w.eventID || e.entityID != w.entityID || !bytes.Equal(e.data, w.data) || e.retry != w.retry {
+			t.Errorf("event %d: got %+v, want %+v", i, e, w)
+		}
+	}
+
+	if _, err := src.next(); err != io.EOF {
+		t.Fatalf("expected the unterminated event to be dropped, got %v", err)
+	}
+}
+
+// wsPipe serves the given frames and records the frames written by the client.
+type wsPipe struct {
+	io.Reader
+	written bytes.Buffer
+}
+
+func (p *wsPipe) Write(b []byte) (int, error) {
+	return p.written.Write(b)
+}
+
+func (p *wsPipe) Close() error {
+	return nil
+}
+
+// frame encodes an unmasked server frame, whose header may claim another length than the payload has.
+func frame(fin bool, opcode byte, length uint64, payload string) []byte {
+	b := opcode
+	if fin {
+		b |= 0x80
+	}
+
+	buf := []byte{b}
+	switch {
+	case length < 126:
+		buf = append(buf, byte(length))
+	case length <= 0xFFFF:
+		buf = binary.BigEndian.AppendUint16(append(buf, 126), uint16(length))
+	default:
+		buf = binary.BigEndian.AppendUint64(append(buf, 127), length)
+	}
+
+	return append(buf, payload...)
+}
+
+func wsFrames(frames ...[]byte) (*wsConn, *wsPipe) {
+	p := &wsPipe{Reader: bytes.NewReader(bytes.Join(frames, nil))}
+	return &wsConn{rw: p, r: bufio.NewReader(p)}, p
+}
+
+func TestWebSocketFraming(t *testing.T) {
+	conn, pipe := wsFrames(
+		frame(false, wsText, 3, "hel"),
+		frame(true, wsPing, 1, "x"),
+		frame(true, wsContinuation, 2, "lo"),
+		frame(true, wsClose, 0, ""),
+	)
+
+	msg, err := conn.ReadMessage()
+	if err != nil || string(msg) != "hello" {
+		t.Fatal(string(msg), err)
+	}
+
+	if w := pipe.written.Bytes(); len(w) < 2 || w[0] != 0x80|wsPong {
+		t.Fatalf("expected a pong, got %x", w)
+	}
+
+	if _, err := conn.ReadMessage(); err != io.EOF {
+		t.Fatalf("expected EOF after close, got %v", err)
+	}
+}
+
+func TestWebSocketLimits(t *testing.T) {
+	tests := []struct {
+		name   string
+		frames [][]byte
+	}{
+		{"frame", [][]byte{frame(true, wsText, wsMaxMessage+1, "")}},
+		{"fragments", [][]byte{frame(false, wsText, 10, "0123456789"), frame(true, wsContinuation, wsMaxMessage-9, "")}},
+		{"control frame", [][]byte{frame(true, wsPing, 126, strings.Repeat("x", 126))}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn, _ := wsFrames(tt.frames...)
+			if _, err := conn.ReadMessage(); err == nil || !strings.Contains(err.Error(), "too large") {
+				t.Fatalf("expected the message to be rejected, got %v", err)
+			}
+		})
+	}
+}
+
+func TestWatchSSE(t *testing.T) {
+	connects := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		connects++
+		if connects > 1 {
+			if got := r.Header.Get("Last-Event-ID"); got != "2" {
+				t.Errorf("expected to resume after event 2, got %q", got)
+			}
+
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		_, _ = io.WriteString(w, "id: 1\nevent: created\ndata: {\"id\":\"1\",\"title\":\"Dune\"}\n\n")
+		_, _ = io.WriteString(w, "id: 2\ndata: {\"type\":\"deleted\",\"id\":\"1\"}\n\n")
+	}))
+	defer srv.Close()
+
+	repo := REST[book](serverContext(t, srv, app.Connection{}), "/books")
+	repo.Events.RetryDelay = time.Millisecond
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	ch, err := repo.Watch(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []Event[book]
+	for e := range ch {
+		got = append(got, e)
+	}
+
+	if len(got) != 2 || got[0].Type != Created || got[0].Entity.Title != "Dune" || got[1].Type != Deleted || got[1].ID != "1" {
+		t.Fatalf("unexpected events %+v", got)
+	}
+
+	if ctx.Err() != nil {
+		t.Fatal("expected the stream to end after the permanent failure")
+	}
+}
+
+func TestWatchReauthenticates(t *testing.T) {
+	for _, transport := range []Transport{SSE, WebSocket} {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Authorization") != "Bearer renewed" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+
+			if transport == SSE {
+				w.Header().Set("Content-Type", "text/event-stream")
+				_, _ = io.WriteString(w, "event: deleted\ndata: {\"id\":\"1\"}\n\n")
+				return
+			}
+
+			conn, rw, err := w.(http.Hijacker).Hijack()
+			if err != nil {
+				t.Error(err)
+				return
+			}
+
+			defer conn.Close()
+
+			sum := sha1.Sum([]byte(r.Header.Get("Sec-WebSocket-Key") + "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"))
+			_, _ = io.WriteString(rw, "HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n")
+			_, _ = io.WriteString(rw, "Sec-WebSocket-Accept: "+base64.StdEncoding.EncodeToString(sum[:])+"\r\n\r\n")
+			msg := `{"type":"deleted","id":"1"}`
+			_, _ = rw.Write(frame(true, wsText, uint64(len(msg)), msg))
+			_, _ = rw.Write(frame(true, wsClose, 0, ""))
+			_ = rw.Flush()
+		}))
+
+		var lock sync.Mutex
+		token, renewals := "expired", 0
+		repo := REST[book](serverContext(t, srv, app.Connection{}), "/books")
+		repo.Events.Transport = transport
+		repo.WithRequest = func(req *http.Request) *http.Request {
+			lock.Lock()
+			defer lock.Unlock()
+
+			req.Header.Set("Authorization", "Bearer "+token)
+			return req
+		}
+		repo.Reauthenticate = func(rejected *http.Request) bool {
+			lock.Lock()
+			defer lock.Unlock()
+
+			token = "renewed"
+			renewals++
+			return true
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		ch, err := repo.Watch(ctx)
+		if err != nil {
+			t.Fatalf("transport %d: %v", transport, err)
+		}
+
+		if e := <-ch; e.Type != Deleted || e.ID != "1" || renewals != 1 {
+			t.Fatalf("transport %d: unexpected event %+v after %d renewals", transport, e, renewals)
+		}
+
+		cancel()
+		srv.Close()
+	}
+}
+
+func TestMemoryWatchSlowWatcher(t *testing.T) {
+	repo := NewMemory[book]()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	slow, _ := repo.Watch(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			_ = repo.Save(book{ID: string(rune('a' + i))})
+		}
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("a slow watcher blocks changes")
+	}
+
+	n := 0
+	for range slow {
+		n++
+	}
+
+	if n != 64 {
+		t.Fatalf("expected the buffered events before the disconnect, got %d", n)
+	}
+}
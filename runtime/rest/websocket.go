@@ -0,0 +1,197 @@
+package rest
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+)
+
+const (
+	wsContinuation = 0x0
+	wsText         = 0x1
+	wsBinary       = 0x2
+	wsClose        = 0x8
+	wsPing         = 0x9
+	wsPong         = 0xA
+
+	// wsMaxMessage limits the size of a message across all of its frames.
+	wsMaxMessage = 64 << 20
+	// wsMaxControl is the maximum payload of control frames, see RFC 6455 section 5.5.
+	wsMaxControl = 125
+)
+
+// wsConn is a minimal RFC 6455 client connection, just enough to receive messages.
+type wsConn struct {
+	rw        io.ReadWriteCloser
+	r         *bufio.Reader
+	writeLock sync.Mutex
+}
+
+// dialWebSocket performs the opening handshake using the given request, whose url must use http or https. The
+// request is sent by send, which may authorize and replay it.
+func dialWebSocket(req *http.Request, send func(*http.Request) (*http.Response, error)) (*wsConn, *http.Response, error) {
+	var nonce [16]byte
+	if _, err := rand.Read(nonce[:]); err != nil {
+		return nil, nil, err
+	}
+
+	key := base64.StdEncoding.EncodeToString(nonce[:])
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Sec-WebSocket-Key", key)
+	req.Header.Set("Sec-WebSocket-Version", "13")
+
+	resp, err := send(req)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		resp.Body.Close()
+		return nil, resp, fmt.Errorf("websocket: unexpected status %d", resp.StatusCode)
+	}
+
+	sum := sha1.Sum([]byte(key + "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"))
+	if resp.Header.Get("Sec-WebSocket-Accept") != base64.StdEncoding.EncodeToString(sum[:]) {
+		resp.Body.Close()
+		return nil, resp, fmt.Errorf("websocket: invalid Sec-WebSocket-Accept")
+	}
+
+	rw, ok := resp.Body.(io.ReadWriteCloser)
+	if !ok {
+		resp.Body.Close()
+		return nil, resp, fmt.Errorf("websocket: connection is not writable")
+	}
+
+	return &wsConn{rw: rw, r: bufio.NewReader(rw)}, resp, nil
+}
+
+// ReadMessage returns the payload of the next text or binary message. Pings are answered automatically. Messages
+// larger than 64 MiB are rejected, even if they are fragmented.
+func (c *wsConn) ReadMessage() ([]byte, error) {
+	var msg []byte
+	for {
+		fin, opcode, payload, err := c.readFrame(wsMaxMessage - uint64(len(msg)))
+		if err != nil {
+			return nil, err
+		}
+
+		switch opcode {
+		case wsPing:
+			if err := c.writeFrame(wsPong, payload); err != nil {
+				return nil, err
+			}
+		case wsPong:
+		case wsClose:
+			_ = c.writeFrame(wsClose, payload)
+			return nil, io.EOF
+		case wsText, wsBinary, wsContinuation:
+			msg = append(msg, payload...)
+			if fin {
+				return msg, nil
+			}
+		default:
+			return nil, fmt.Errorf("websocket: unsupported opcode %d", opcode)
+		}
+	}
+}
+
+func (c *wsConn) Close() error {
+	_ = c.writeFrame(wsClose, nil)
+	return c.rw.Close()
+}
+
+// readFrame reads the next frame, whose payload must not exceed the given limit.
+func (c *wsConn) readFrame(limit uint64) (fin bool, opcode byte, payload []byte, err error) {
+	var hdr [2]byte
+	if _, err = io.ReadFull(c.r, hdr[:]); err != nil {
+		return
+	}
+
+	fin = hdr[0]&0x80 != 0
+	opcode = hdr[0] & 0x0F
+	masked := hdr[1]&0x80 != 0
+	n := uint64(hdr[1] & 0x7F)
+	switch n {
+	case 126:
+		var ext [2]byte
+		if _, err = io.ReadFull(c.r, ext[:]); err != nil {
+			return
+		}
+
+		n = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err = io.ReadFull(c.r, ext[:]); err != nil {
+			return
+		}
+
+		n = binary.BigEndian.Uint64(ext[:])
+	}
+
+	var mask [4]byte
+	if masked {
+		if _, err = io.ReadFull(c.r, mask[:]); err != nil {
+			return
+		}
+	}
+
+	if opcode >= wsClose {
+		limit = wsMaxControl
+	}
+
+	if n > limit {
+		err = fmt.Errorf("websocket: message too large: %d bytes exceed the limit", n)
+		return
+	}
+
+	payload = make([]byte, n)
+	if _, err = io.ReadFull(c.r, payload); err != nil {
+		return
+	}
+
+	if masked {
+		for i := range payload {
+			payload[i] ^= mask[i%4]
+		}
+	}
+
+	return
+}
+
+// writeFrame sends a single masked frame, as required for clients.
+func (c *wsConn) writeFrame(opcode byte, payload []byte) error {
+	c.writeLock.Lock()
+	defer c.writeLock.Unlock()
+
+	buf := []byte{0x80 | opcode}
+	switch n := len(payload); {
+	case n < 126:
+		buf = append(buf, 0x80|byte(n))
+	case n <= 0xFFFF:
+		buf = append(buf, 0x80|126, byte(n>>8), byte(n))
+	default:
+		var ext [8]byte
+		binary.BigEndian.PutUint64(ext[:], uint64(n))
+		buf = append(append(buf, 0x80|127), ext[:]...)
+	}
+
+	var mask [4]byte
+	if _, err := rand.Read(mask[:]); err != nil {
+		return err
+	}
+
+	buf = append(buf, mask[:]...)
+	for i, b := range payload {
+		buf = append(buf, b^mask[i%4])
+	}
+
+	_, err := c.rw.Write(buf)
+	return err
+}
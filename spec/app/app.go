@@ -2,8 +2,13 @@ package app
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"log"
+	"github.com/gotrino/fusion/spec/observe"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
 )
 
 type RT struct {
@@ -32,8 +37,13 @@ type Launcher interface {
 // A Route provides some marshall and unmarshal logic.
 type Route string
 
+// RouteParams are the named parameters of the current route, like the id of the parent entity in a master-detail
+// screen. A runtime puts them into the context of an activity using WithContext.
+type RouteParams map[string]string
+
 // Navigate assembles a query link based on the given composer params, to ease things.
 func Navigate(ctx context.Context, params ActivityComposer) {
+	observe.Get().Navigate(ctx, params)
 	FromContext[RT](ctx).Navigate(params)
 }
 
@@ -46,13 +56,49 @@ type Activity struct {
 }
 
 type Connection struct {
-	Scheme string
-	Host   string
-	Port   int
+	Scheme     string
+	Host       string
+	Port       int
+	Resilience Resilience // Resilience is the default retry and circuit breaker policy for this Connection.
+	// Authentication overrides the Authentication of the Application for this Connection, if not nil.
+	Authentication Authentication
+	BasePath       string            // BasePath prefixes all resource paths, like /backend/api.
+	TLS            TLS               // TLS configures additional root CAs and client certificates.
+	Proxy          string            // Proxy is the url of a http proxy. Empty uses HTTP_PROXY and friends.
+	Timeout        time.Duration     // Timeout limits each request including reading the body. Zero means none.
+	Headers        map[string]string // Headers are sent with each request, unless already set.
+}
+
+// ParseConnection returns the Connection for an absolute url like https://api.example.com/backend, whose path
+// becomes the BasePath. A missing port defaults to the one of the scheme.
+func ParseConnection(rawURL string) (Connection, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return Connection{}, err
+	}
+
+	if u.Scheme == "" || u.Hostname() == "" {
+		return Connection{}, fmt.Errorf("invalid connection url: %s", rawURL)
+	}
+
+	c := Connection{Scheme: u.Scheme, Host: u.Hostname(), BasePath: strings.TrimSuffix(u.Path, "/")}
+	switch {
+	case u.Port() != "":
+		if c.Port, err = strconv.Atoi(u.Port()); err != nil {
+			return Connection{}, fmt.Errorf("invalid connection url: %s", rawURL)
+		}
+	case u.Scheme == "https":
+		c.Port = 443
+	default:
+		c.Port = 80
+	}
+
+	return c, nil
 }
 
 // ActivityComposer creates and describes a concrete Activity instance.
 type ActivityComposer interface {
+	// Compose is called with a context which is canceled by the runtime as soon as the activity goes away.
 	Compose(ctx context.Context) Activity
 }
 
@@ -61,7 +107,38 @@ type Application struct {
 	Title          string
 	Activities     []ActivityComposer
 	Authentication Authentication
-	Connection     Connection
+	Connection     Connection // Connection is the default backend, which is used if no connection name is given.
+	// Connections are additional backends by name, like billing or auth, so that an application can compose data
+	// from several services.
+	Connections map[string]Connection
+}
+
+// ErrUnknownConnection is returned for a connection name, which is not declared by the Application.
+var ErrUnknownConnection = errors.New("unknown connection")
+
+// ConnectionOf returns the named Connection or the default Connection for the empty name. An unknown name, like a
+// typo in a repository declaration, returns an error wrapping ErrUnknownConnection.
+func (a Application) ConnectionOf(name string) (Connection, error) {
+	if name == "" {
+		return a.Connection, nil
+	}
+
+	c, ok := a.Connections[name]
+	if !ok {
+		return Connection{}, fmt.Errorf("%w: %s", ErrUnknownConnection, name)
+	}
+
+	return c, nil
+}
+
+// AuthenticationOf returns the Authentication of the named Connection, which defaults to the Authentication
+// of the Application, also for an unknown name.
+func (a Application) AuthenticationOf(name string) Authentication {
+	if c, err := a.ConnectionOf(name); err == nil && c.Authentication != nil {
+		return c.Authentication
+	}
+
+	return a.Authentication
 }
 
 // An ApplicationComposer creates and describes a concrete Application instance.
@@ -83,29 +160,78 @@ type RepositoryImplStencil interface {
 	Save(t any) error // any is of type T
 }
 
+// ContextRepositoryImplStencil is an optional extension of a RepositoryImplStencil, whose operations are bound
+// to the given context. Runtimes should prefer it and cancel the context when the activity goes away.
+type ContextRepositoryImplStencil interface {
+	ListContext(ctx context.Context) ([]any, error)
+	LoadContext(ctx context.Context, id string) (any, error)
+	DeleteContext(ctx context.Context, id string) error
+	SaveContext(ctx context.Context, t any) error
+}
+
 // Repository is a marker interface for a repository specification which represents a collection of resources.
 type Repository interface {
 	IsRepository() bool
 	GetDefault() any
+	// New creates the implementation. The context is canceled by the runtime when the activity goes away.
 	New(ctx context.Context) RepositoryImplStencil
 }
 
+// FieldSelector is an optional extension of a RepositoryImplStencil, which returns an implementation that only
+// fetches the given fields of the entities, e.g. the displayed columns of a table.
+type FieldSelector interface {
+	Select(fields ...string) RepositoryImplStencil
+}
+
+// ResourceImplStencil is the untyped implementation of a singleton resource.
+type ResourceImplStencil interface {
+	Load() (any, error) // any is of type T
+	Save(t any) error   // any is of type T
+	Delete() error
+}
+
+// ContextResourceImplStencil is an optional extension of a ResourceImplStencil, whose operations are bound
+// to the given context.
+type ContextResourceImplStencil interface {
+	LoadContext(ctx context.Context) (any, error)
+	SaveContext(ctx context.Context, t any) error
+	DeleteContext(ctx context.Context) error
+}
+
+// Resource is a marker interface for a resource specification which represents a single resource without an id,
+// like the settings or the profile of the current user.
+type Resource interface {
+	IsResource() bool
+	GetDefault() any
+	// New creates the implementation. The context is canceled by the runtime when the activity goes away.
+	New(ctx context.Context) ResourceImplStencil
+}
+
 type myCtxKey string
 
 // FromContext cannot be used with interfaces because they boil down to any without type information.
 func FromContext[T any](ctx context.Context) T {
 	var t T
 	k := fmt.Sprintf("%T", t)
-	log.Printf("context: grabbing %s\n", k)
-
 	a := ctx.Value(myCtxKey(k))
+	observe.Get().ContextLookup(ctx, k, a != nil)
+
 	return a.(T)
 }
 
+// Lookup is like FromContext but reports whether the value is available instead of panicking.
+func Lookup[T any](ctx context.Context) (T, bool) {
+	var t T
+	k := fmt.Sprintf("%T", t)
+
+	a, ok := ctx.Value(myCtxKey(k)).(T)
+	observe.Get().ContextLookup(ctx, k, ok)
+
+	return a, ok
+}
+
 // WithContext cannot be used interfaces because they loose (any) type information.
 func WithContext[T any](ctx context.Context, t T) context.Context {
 	k := fmt.Sprintf("%T", t)
-	log.Printf("context: setting %s\n", k)
-
 	return context.WithValue(ctx, myCtxKey(k), t)
 }
@@ -0,0 +1,56 @@
+package app
+
+import (
+	"context"
+	"fmt"
+)
+
+// BatchResult is the outcome of a single item of a batch operation.
+type BatchResult struct {
+	ID  string
+	Err error // Err is nil, if the operation for this item succeeded.
+}
+
+// BatchError is returned by a batch operation if at least one item failed. Results contains the outcome of
+// all items in the order of the request, so that the succeeded items can be distinguished from the failed ones.
+type BatchError struct {
+	Results []BatchResult
+}
+
+func (e BatchError) Error() string {
+	failed := e.Failed()
+	if len(failed) == 0 {
+		return "batch: no failures"
+	}
+
+	return fmt.Sprintf("batch: %d of %d operations failed: %s: %v", len(failed), len(e.Results), failed[0].ID, failed[0].Err)
+}
+
+// Failed returns only the failed results.
+func (e BatchError) Failed() []BatchResult {
+	var res []BatchResult
+	for _, r := range e.Results {
+		if r.Err != nil {
+			res = append(res, r)
+		}
+	}
+
+	return res
+}
+
+// Unwrap returns the first failure, so that e.g. Forbidden can be checked.
+func (e BatchError) Unwrap() error {
+	if failed := e.Failed(); len(failed) > 0 {
+		return failed[0].Err
+	}
+
+	return nil
+}
+
+// BatchRepositoryImplStencil is an optional extension of a RepositoryImplStencil, which saves or deletes many
+// entities at once. The returned results have the same order as the given items and the error is
+// a BatchError, if at least one item failed.
+type BatchRepositoryImplStencil interface {
+	SaveAll(ctx context.Context, ts []any) ([]BatchResult, error) // any is of type T
+	DeleteAll(ctx context.Context, ids []string) ([]BatchResult, error)
+}
@@ -44,9 +44,16 @@ func ProtocolError(err error) {
 
 }
 
+// FieldError describes why the value of a single field has been rejected.
+type FieldError struct {
+	Field   string // Field is the name of the offending field, like title or author.name.
+	Message string
+}
+
 // ValidationError describes a condition where a validation has failed.
 type ValidationError struct {
 	Message string
+	Fields  []FieldError // Fields contains the errors which can be shown next to the offending fields.
 	Cause   error
 }
 
@@ -68,8 +75,28 @@ func ValidationFailed(err error) (bool, string) {
 	}
 
 	if errors.As(err, &e) && e.FailedValidation() {
+		if msg, ok := e.(error); ok {
+			return true, msg.Error()
+		}
+
 		return true, err.Error()
 	}
 
 	return false, ""
 }
+
+// FieldErrors returns the field errors of a failed validation. The ValidationError may be wrapped and may be
+// passed as value or pointer.
+func FieldErrors(err error) []FieldError {
+	var e ValidationError
+	if errors.As(err, &e) {
+		return e.Fields
+	}
+
+	var p *ValidationError
+	if errors.As(err, &p) && p != nil {
+		return p.Fields
+	}
+
+	return nil
+}
@@ -0,0 +1,29 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"io"
+)
+
+// ErrFilesNotSupported is returned by a FileImplStencil, if the underlying repository has no binary content.
+var ErrFilesNotSupported = errors.New("files are not supported by this repository")
+
+// Progress is called while a file is transferred. The total is -1 if unknown.
+type Progress func(transferred, total int64)
+
+// File is binary content, which is streamed instead of being held in memory.
+type File struct {
+	Name        string // Name is the file name, like report.pdf.
+	ContentType string
+	Size        int64 // Size is -1 if unknown.
+	Content     io.ReadCloser
+}
+
+// FileImplStencil is an optional extension of a RepositoryImplStencil, which transfers the binary content
+// attached to an entity, like /api/documents/{id}/content. Upload consumes and closes the Content. The Content of
+// a downloaded File must be closed by the caller. The progress may be nil.
+type FileImplStencil interface {
+	Upload(ctx context.Context, id string, file File, progress Progress) error
+	Download(ctx context.Context, id string, progress Progress) (File, error)
+}
@@ -0,0 +1,58 @@
+package app
+
+import "context"
+
+// Iterator streams the entities of a list. Close must be called, even if Next has returned false.
+type Iterator interface {
+	Next() bool
+	Value() any // any is of type T
+	Err() error
+	Close() error
+}
+
+// IterableImplStencil is an optional extension of a RepositoryImplStencil, which streams the list instead of
+// holding it completely in memory. Runtimes should prefer it for large lists, e.g. by using Each.
+type IterableImplStencil interface {
+	Iterate(ctx context.Context) (Iterator, error)
+}
+
+// Each calls f for each entity of the list, which is streamed if the repository implements IterableImplStencil.
+// The iteration stops at the first error returned by f.
+func Each(ctx context.Context, repo RepositoryImplStencil, f func(t any) error) error {
+	if iterable, ok := repo.(IterableImplStencil); ok {
+		it, err := iterable.Iterate(ctx)
+		if err != nil {
+			return err
+		}
+
+		defer it.Close()
+
+		for it.Next() {
+			if err := f(it.Value()); err != nil {
+				return err
+			}
+		}
+
+		return it.Err()
+	}
+
+	var list []any
+	var err error
+	if c, ok := repo.(ContextRepositoryImplStencil); ok {
+		list, err = c.ListContext(ctx)
+	} else {
+		list, err = repo.List()
+	}
+
+	if err != nil {
+		return err
+	}
+
+	for _, t := range list {
+		if err := f(t); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
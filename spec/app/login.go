@@ -1,8 +1,14 @@
 package app
 
+import (
+	"context"
+	"encoding/base64"
+)
+
 // Authentication is a marker interface to declare which kind of authentication is used.
 // If any endpoint returns http.StatusUnauthenticated (401) the frontend will present the according
-// login possibility. However, http.StatusForbidden (403) will only display a notification.
+// login possibility using the LoginFlow and the rejected request is replayed once. However,
+// http.StatusForbidden (403) will only display a notification.
 type Authentication interface {
 	IsAuthentication() bool
 }
@@ -20,6 +26,12 @@ func (None) IsAuthentication() bool {
 // This means, that the application presents a single input field to enter the bearer token.
 // The user must get his token over a secure and independent channel.
 type Bearer struct {
+	Store TokenStore // Store keeps the entered token. Defaults to DefaultTokenStore.
+}
+
+// Login keeps the entered token for the named connection.
+func (b Bearer) Login(connection, token string) {
+	StoreOf(b.Store).Store(connection, token)
 }
 
 func (Bearer) IsAuthentication() bool {
@@ -35,4 +47,41 @@ func (HardcodedBearer) IsAuthentication() bool {
 	return true
 }
 
+// Basic authenticates each request with a username and password according to RFC 7617. The application
+// presents a login prompt to enter them.
+type Basic struct {
+	Realm string     // Realm is shown by the login prompt.
+	Store TokenStore // Store keeps the encoded credentials. Defaults to DefaultTokenStore.
+}
+
+func (Basic) IsAuthentication() bool {
+	return true
+}
+
+// Login keeps the credentials for the named connection.
+func (b Basic) Login(connection, username, password string) {
+	StoreOf(b.Store).Store(connection, base64.StdEncoding.EncodeToString([]byte(username+":"+password)))
+}
+
+// OIDC authenticates the user with OpenID Connect using the authorization code flow with PKCE. This is the
+// mechanism for end users. The runtime redirects to the identity provider and completes the login with the
+// callback, see package runtime/oidc. Access tokens are refreshed transparently.
+type OIDC struct {
+	Issuer       string // Issuer like https://id.example.com/realms/main, whose configuration is discovered.
+	ClientID     string
+	ClientSecret string // ClientSecret is only required for confidential clients.
+	RedirectURL  string // RedirectURL receives the callback of the identity provider.
+	// PostLogoutRedirectURL is where the identity provider redirects to after the logout, if not empty.
+	PostLogoutRedirectURL string
+	Scopes                []string   // Scopes default to openid, profile, email and offline_access.
+	Store                 TokenStore // Store keeps the session. Defaults to DefaultTokenStore.
+}
+
+func (OIDC) IsAuthentication() bool {
+	return true
+}
 
+// LoginFlow is provided by the runtime using WithContext. It presents the login of the Authentication for the
+// named connection, like the token prompt or the redirect to the identity provider, and returns when the user has
+// logged in. An error means that the login has been canceled or has failed.
+type LoginFlow func(ctx context.Context, connection string, auth Authentication) error
@@ -0,0 +1,21 @@
+package app
+
+import "time"
+
+// Resilience declares how failed requests against a Connection are retried and when a Connection is considered
+// broken. The zero value performs a single attempt without any circuit breaking, which is the historic behavior.
+type Resilience struct {
+	// MaxRetries is the amount of additional attempts after the first one. Only idempotent verbs are retried, however
+	// PUT and POST are made idempotent using an Idempotency-Key header.
+	MaxRetries int
+	// BaseDelay is the initial backoff, which is doubled on each attempt and randomized using full jitter.
+	BaseDelay time.Duration
+	// MaxDelay caps the backoff and any Retry-After delay announced by the server. Zero means 30 seconds.
+	MaxDelay time.Duration
+	// BreakerThreshold is the amount of consecutive failures after which the circuit of the Connection opens.
+	// Zero disables the circuit breaker.
+	BreakerThreshold int
+	// BreakerCooldown is the duration an open circuit rejects requests before a single trial request is let through.
+	// Zero means 30 seconds.
+	BreakerCooldown time.Duration
+}
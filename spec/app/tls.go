@@ -0,0 +1,21 @@
+package app
+
+// TLS declares the transport security of a Connection. Certificates and keys are PEM encoded and either given
+// inline or as file names.
+type TLS struct {
+	RootCAs     []byte // RootCAs are trusted in addition to the system pool, e.g. for internally signed servers.
+	RootCAFile  string
+	Certificate []byte // Certificate and Key authenticate the client, if given.
+	Key         []byte
+	CertFile    string
+	KeyFile     string
+	ServerName  string // ServerName overrides the name which is verified against the server certificate.
+	// InsecureSkipVerify disables the verification of the server certificate. Only use it for development.
+	InsecureSkipVerify bool
+}
+
+// IsZero reports whether the defaults of the platform are used.
+func (t TLS) IsZero() bool {
+	return len(t.RootCAs) == 0 && t.RootCAFile == "" && len(t.Certificate) == 0 && len(t.Key) == 0 &&
+		t.CertFile == "" && t.KeyFile == "" && t.ServerName == "" && !t.InsecureSkipVerify
+}
@@ -0,0 +1,55 @@
+package app
+
+import "sync"
+
+// DefaultTokenStore keeps the secrets in memory, so that they are gone when the application is closed.
+var DefaultTokenStore TokenStore = &MemoryTokenStore{}
+
+// TokenStore keeps the secrets, which have been entered by the user at runtime, per connection name.
+// Implementations may persist them, e.g. in the local storage of a browser or the keychain of the os.
+type TokenStore interface {
+	Load(connection string) (string, bool)
+	Store(connection, token string)
+	Delete(connection string)
+}
+
+// StoreOf returns the given store or the DefaultTokenStore, if nil.
+func StoreOf(store TokenStore) TokenStore {
+	if store == nil {
+		return DefaultTokenStore
+	}
+
+	return store
+}
+
+// MemoryTokenStore is a thread-safe TokenStore in memory.
+type MemoryTokenStore struct {
+	lock   sync.RWMutex
+	tokens map[string]string
+}
+
+func (s *MemoryTokenStore) Load(connection string) (string, bool) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	token, ok := s.tokens[connection]
+	return token, ok
+}
+
+func (s *MemoryTokenStore) Store(connection, token string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.tokens == nil {
+		s.tokens = map[string]string{}
+	}
+
+	s.tokens[connection] = token
+}
+
+func (s *MemoryTokenStore) Delete(connection string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	delete(s.tokens, connection)
+}
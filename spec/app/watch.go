@@ -0,0 +1,22 @@
+package app
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrWatchNotSupported is returned by a WatchableImplStencil, if the underlying repository cannot stream changes.
+var ErrWatchNotSupported = errors.New("watch is not supported by this repository")
+
+// Change describes that an entity has been created, updated or deleted.
+type Change struct {
+	Type   string // Type is one of created, updated or deleted.
+	ID     string
+	Entity any // Entity is of type T and nil for deleted entities.
+}
+
+// WatchableImplStencil is an optional extension of a RepositoryImplStencil, which streams the changes of the
+// entities. The channel is closed when the context is canceled or the stream has failed permanently.
+type WatchableImplStencil interface {
+	Watch(ctx context.Context) (<-chan Change, error)
+}
@@ -11,7 +11,9 @@ type Form struct {
 	CanDelete   bool
 	CanCancel   bool
 	Repository  app.Repository
-	ResourceID  string // ID of the resource to lookup in the repository
+	ResourceID  string       // ID of the resource to lookup in the repository
+	Resource    app.Resource // Resource is used instead of Repository and ResourceID for singletons like /api/settings
+	Live        bool         // Live reloads the entity whenever the repository reports a change of it, see app.WatchableImplStencil.
 	Fields      []Field
 }
 
@@ -20,6 +22,8 @@ func (f Form) IsFragment() bool {
 }
 
 type StencilText struct {
+	// Field is the name of the entity field, see Text.
+	Field       string
 	Label       string
 	Description string
 	Disabled    bool
@@ -36,6 +40,9 @@ type Field interface {
 
 // A Text is something like an edit text field.
 type Text[T any] struct {
+	// Field is the name of the entity field, which is matched against app.FieldError to show server-side
+	// validation messages next to this field, like title or author.name.
+	Field       string
 	Label       string
 	Description string
 	Disabled    bool
@@ -47,6 +54,7 @@ type Text[T any] struct {
 
 func (t Text[T]) ToStencil() StencilText {
 	return StencilText{
+		Field:       t.Field,
 		Label:       t.Label,
 		Description: t.Description,
 		Disabled:    t.Disabled,
@@ -67,6 +75,8 @@ func (Text[T]) IsField() bool {
 
 // An Integer field just allows per-se only integer numbers.
 type Integer[T any] struct {
+	// Field names the entity field for app.FieldError, see Text.
+	Field     string
 	Text      string
 	Hint      string
 	Disabled  bool
@@ -79,6 +89,8 @@ func (Integer[T]) IsField() bool {
 }
 
 type Select[T any] struct {
+	// Field names the entity field for app.FieldError, see Text.
+	Field       string
 	Text        string
 	Hint        string
 	Disabled    bool
@@ -98,3 +110,17 @@ type Item struct {
 	Hint     string // eventually shows the hint
 	Selected bool
 }
+
+// A File field uploads and downloads the binary content of the entity using the app.FileImplStencil of the form
+// repository. It is only usable after the entity has been saved, because the content is bound to its id.
+type File struct {
+	Label    string
+	Hint     string
+	Disabled bool
+	Accept   string // Accept restricts the selectable files like image/* or .pdf, as the html accept attribute.
+	MaxSize  int64  // MaxSize in bytes is checked before uploading. Zero means no limit.
+}
+
+func (File) IsField() bool {
+	return true
+}
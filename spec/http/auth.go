@@ -0,0 +1,278 @@
+package http
+
+import (
+	"context"
+	"fmt"
+	"github.com/gotrino/fusion/spec/app"
+	"net/http"
+	"reflect"
+	"sync"
+)
+
+var authorizers = map[reflect.Type]func(ctx context.Context, connection string, auth app.Authentication, req *http.Request) *http.Request{}
+var authorizersLock sync.RWMutex
+
+var refreshers = map[reflect.Type]func(ctx context.Context, connection string, auth app.Authentication) error{}
+var refreshersLock sync.RWMutex
+
+var renewals = map[string]*sync.Mutex{}
+var renewalsLock sync.Mutex
+
+var logins = map[string]*login{}
+var loginsLock sync.Mutex
+
+func init() {
+	RegisterAuthorizer(func(ctx context.Context, connection string, auth app.None, req *http.Request) *http.Request {
+		return req
+	})
+
+	RegisterAuthorizer(func(ctx context.Context, connection string, auth app.HardcodedBearer, req *http.Request) *http.Request {
+		req.Header.Set("Authorization", "Bearer "+auth.Token)
+		return req
+	})
+
+	RegisterAuthorizer(func(ctx context.Context, connection string, auth app.Bearer, req *http.Request) *http.Request {
+		if token, ok := app.StoreOf(auth.Store).Load(connection); ok {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+
+		return req
+	})
+
+	RegisterAuthorizer(func(ctx context.Context, connection string, auth app.Basic, req *http.Request) *http.Request {
+		if credentials, ok := app.StoreOf(auth.Store).Load(connection); ok {
+			req.Header.Set("Authorization", "Basic "+credentials)
+		}
+
+		return req
+	})
+}
+
+// RegisterAuthorizer declares how requests are decorated for the Authentication type A, so that custom
+// Authentication types can be used. Registering a type again replaces the former decorator. Without stored
+// credentials, a decorator should leave the request untouched, so that the server responds with 401.
+func RegisterAuthorizer[A app.Authentication](decorate func(ctx context.Context, connection string, auth A, req *http.Request) *http.Request) {
+	authorizersLock.Lock()
+	defer authorizersLock.Unlock()
+
+	authorizers[reflect.TypeOf((*A)(nil)).Elem()] = func(ctx context.Context, connection string, auth app.Authentication, req *http.Request) *http.Request {
+		return decorate(ctx, connection, auth.(A), req)
+	}
+}
+
+// authorize decorates the request using the registered decorator of the Authentication. A nil Authentication,
+// including a nil pointer, is treated like app.None. A pointer like &app.Bearer{} uses the decorator of the value.
+func authorize(ctx context.Context, connection string, auth app.Authentication, req *http.Request) *http.Request {
+	if isNil(auth) {
+		return req
+	}
+
+	decorate, auth, ok := lookup(authorizers, &authorizersLock, auth)
+	if !ok {
+		panic(fmt.Errorf("unsupported authorization: %T", auth))
+	}
+
+	return decorate(ctx, connection, auth, req)
+}
+
+// lookup returns the entry registered for the type of the Authentication. If a pointer type is not registered,
+// the type it points to is looked up instead and the returned Authentication is dereferenced accordingly.
+func lookup[F any](registry map[reflect.Type]F, lock *sync.RWMutex, auth app.Authentication) (F, app.Authentication, bool) {
+	lock.RLock()
+	defer lock.RUnlock()
+
+	for {
+		if f, ok := registry[reflect.TypeOf(auth)]; ok {
+			return f, auth, true
+		}
+
+		v := reflect.ValueOf(auth)
+		if v.Kind() != reflect.Pointer || v.IsNil() {
+			var zero F
+			return zero, auth, false
+		}
+
+		elem, ok := v.Elem().Interface().(app.Authentication)
+		if !ok {
+			var zero F
+			return zero, auth, false
+		}
+
+		auth = elem
+	}
+}
+
+func isNil(auth app.Authentication) bool {
+	if auth == nil {
+		return true
+	}
+
+	v := reflect.ValueOf(auth)
+	return v.Kind() == reflect.Pointer && v.IsNil()
+}
+
+// RegisterRefresher declares how the credentials of the Authentication type A are renewed without the user, like
+// exchanging a refresh token, after a request has been rejected with 401. If renew fails, the LoginFlow of the
+// runtime is used.
+func RegisterRefresher[A app.Authentication](renew func(ctx context.Context, connection string, auth A) error) {
+	refreshersLock.Lock()
+	defer refreshersLock.Unlock()
+
+	refreshers[reflect.TypeOf((*A)(nil)).Elem()] = func(ctx context.Context, connection string, auth app.Authentication) error {
+		return renew(ctx, connection, auth.(A))
+	}
+}
+
+// ReauthenticatorOn returns the function, which renews the credentials of the named Connection after the request
+// has been rejected with 401 and reports whether it should be replayed, see SendAuthorized. The registered
+// refresher is tried first and then the LoginFlow of the runtime, if any. app.None never reauthenticates.
+// Concurrently rejected requests share a single renewal: if the Authorization header has changed meanwhile,
+// the request is just replayed. The LoginFlow is shared as well, but it runs without holding the lock of the
+// connection, so that it may send requests itself. Its requests are never reauthenticated by the flow again.
+func ReauthenticatorOn(ctx context.Context, connection string) func(rejected *http.Request) bool {
+	auth := app.FromContext[app.Application](ctx).AuthenticationOf(connection)
+	flow, _ := app.Lookup[app.LoginFlow](ctx)
+
+	return func(rejected *http.Request) bool {
+		if isNil(auth) {
+			return false
+		}
+
+		_, value, _ := lookup(authorizers, &authorizersLock, auth)
+		if _, none := value.(app.None); none {
+			return false
+		}
+
+		// the operation may be called without the application, which is then taken from the composing context
+		reqCtx := fallbackContext{Context: rejected.Context(), values: ctx}
+		if renew(reqCtx, connection, auth, rejected) {
+			return true
+		}
+
+		if flow == nil || reqCtx.Value(loginKey(connection)) != nil {
+			return false
+		}
+
+		return shareLogin(reqCtx, connection, func(ctx context.Context) error {
+			return flow(context.WithValue(ctx, loginKey(connection), true), connection, auth)
+		})
+	}
+}
+
+// renew reports whether the credentials have changed since the request has been rejected or have been renewed by
+// the registered refresher. Otherwise the user must login.
+func renew(ctx context.Context, connection string, auth app.Authentication, rejected *http.Request) bool {
+	lock := renewalLock(connection)
+	lock.Lock()
+	defer lock.Unlock()
+
+	probe := rejected.Clone(rejected.Context())
+	probe.Header.Del("Authorization")
+	probe = authorize(ctx, connection, auth, probe)
+	if current := probe.Header.Get("Authorization"); current != "" && current != rejected.Header.Get("Authorization") {
+		return true
+	}
+
+	refresh, renewed, ok := lookup(refreshers, &refreshersLock, auth)
+	return ok && refresh(ctx, connection, renewed) == nil
+}
+
+// login is a running LoginFlow, whose outcome is shared by all requests rejected meanwhile.
+type login struct {
+	done chan struct{}
+	ok   bool
+}
+
+// loginKey marks the context of a running LoginFlow of the connection.
+type loginKey string
+
+// shareLogin runs the flow, unless it is already running for the connection, in which case its outcome is awaited.
+func shareLogin(ctx context.Context, connection string, flow func(ctx context.Context) error) bool {
+	loginsLock.Lock()
+	l, running := logins[connection]
+	if !running {
+		l = &login{done: make(chan struct{})}
+		logins[connection] = l
+	}
+	loginsLock.Unlock()
+
+	if running {
+		select {
+		case <-l.done:
+			return l.ok
+		case <-ctx.Done():
+			return false
+		}
+	}
+
+	l.ok = flow(ctx) == nil
+
+	loginsLock.Lock()
+	delete(logins, connection)
+	loginsLock.Unlock()
+	close(l.done)
+
+	return l.ok
+}
+
+// fallbackContext keeps the cancellation of its Context, but looks up missing values in another context.
+type fallbackContext struct {
+	context.Context
+	values context.Context
+}
+
+func (c fallbackContext) Value(key any) any {
+	if v := c.Context.Value(key); v != nil {
+		return v
+	}
+
+	return c.values.Value(key)
+}
+
+// SendAuthorized decorates the request using authorize and sends it like Send. If the server responds with 401,
+// the request is replayed once, decorated again, if reauthenticate has renewed the credentials. Requests whose
+// body cannot be read again are not replayed.
+func SendAuthorized(client *http.Client, req *http.Request, policy app.Resilience, authorize func(*http.Request) *http.Request, reauthenticate func(rejected *http.Request) bool) (*http.Response, error) {
+	if authorize == nil {
+		authorize = func(req *http.Request) *http.Request { return req }
+	}
+
+	replayable := req.GetBody != nil || req.Body == nil || req.Body == http.NoBody
+	replay := req.Clone(req.Context()) // authorize may modify the request in place
+
+	sent := authorize(req)
+	res, err := Send(client, sent, policy)
+	if err != nil || res.StatusCode != http.StatusUnauthorized || reauthenticate == nil || !replayable {
+		return res, err
+	}
+
+	if !reauthenticate(sent) {
+		return res, err
+	}
+
+	res.Body.Close()
+
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+
+		replay.Body = body
+	}
+
+	return Send(client, authorize(replay), policy)
+}
+
+func renewalLock(connection string) *sync.Mutex {
+	renewalsLock.Lock()
+	defer renewalsLock.Unlock()
+
+	lock, ok := renewals[connection]
+	if !ok {
+		lock = &sync.Mutex{}
+		renewals[connection] = lock
+	}
+
+	return lock
+}
@@ -0,0 +1,266 @@
+package http
+
+import (
+	"context"
+	"github.com/gotrino/fusion/spec/app"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// apiKey is registered with a pointer receiver, unlike the builtin Authentications.
+type apiKey struct {
+	key string
+}
+
+func (*apiKey) IsAuthentication() bool {
+	return true
+}
+
+func init() {
+	RegisterAuthorizer(func(ctx context.Context, connection string, auth *apiKey, req *http.Request) *http.Request {
+		req.Header.Set("X-API-Key", auth.key)
+		return req
+	})
+}
+
+// rotating is renewed by a refresher, which is registered for the value type.
+type rotating struct {
+	store    *app.MemoryTokenStore
+	renewals *atomic.Int32
+}
+
+func (rotating) IsAuthentication() bool {
+	return true
+}
+
+func init() {
+	RegisterAuthorizer(func(ctx context.Context, connection string, auth rotating, req *http.Request) *http.Request {
+		if token, ok := auth.store.Load(connection); ok {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+
+		return req
+	})
+
+	RegisterRefresher(func(ctx context.Context, connection string, auth rotating) error {
+		auth.renewals.Add(1)
+		auth.store.Store(connection, "renewed")
+		return nil
+	})
+}
+
+type unregistered struct{}
+
+func (unregistered) IsAuthentication() bool {
+	return true
+}
+
+func TestAuthorize(t *testing.T) {
+	tests := []struct {
+		name   string
+		auth   app.Authentication
+		header string
+		want   string
+	}{
+		{"nil", nil, "Authorization", ""},
+		{"none", app.None{}, "Authorization", ""},
+		{"pointer to none", &app.None{}, "Authorization", ""},
+		{"value", app.HardcodedBearer{Token: "t"}, "Authorization", "Bearer t"},
+		{"pointer", &app.HardcodedBearer{Token: "t"}, "Authorization", "Bearer t"},
+		{"nil pointer", (*app.HardcodedBearer)(nil), "Authorization", ""},
+		{"registered pointer", &apiKey{key: "k"}, "X-API-Key", "k"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest("GET", "http://localhost/", nil)
+			req = authorize(context.Background(), "", tt.auth, req)
+			if got := req.Header.Get(tt.header); got != tt.want {
+				t.Fatalf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAuthorizeUnregistered(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Fatal("expected an unsupported Authentication to panic")
+		}
+	}()
+
+	req, _ := http.NewRequest("GET", "http://localhost/", nil)
+	authorize(context.Background(), "", &unregistered{}, req)
+}
+
+// bearerServer accepts only the renewed token. If rejections is positive, that many rejected requests are held
+// back until all of them have arrived, so that they are rejected concurrently.
+func bearerServer(t *testing.T, rejections int32) (*httptest.Server, *atomic.Int32) {
+	var requests, rejected atomic.Int32
+	var wg sync.WaitGroup
+	wg.Add(int(rejections))
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		if r.Header.Get("Authorization") != "Bearer renewed" {
+			if rejected.Add(1) <= rejections {
+				wg.Done()
+				wg.Wait()
+			}
+
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	t.Cleanup(srv.Close)
+
+	return srv, &requests
+}
+
+func appContext(t *testing.T, srv *httptest.Server, auth app.Authentication, flow app.LoginFlow) context.Context {
+	ctx := app.WithContext(context.Background(), app.Application{
+		Authentication: auth,
+		Connection:     connectionOf(t, srv),
+	})
+
+	if flow != nil {
+		ctx = app.WithContext(ctx, flow)
+	}
+
+	return ctx
+}
+
+// connectionOf returns the Connection to the server.
+func connectionOf(t *testing.T, srv *httptest.Server) app.Connection {
+	c, err := app.ParseConnection(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return c
+}
+
+func sendAuthorized(ctx context.Context, t *testing.T, srv *httptest.Server, reqCtx context.Context) int {
+	req, _ := http.NewRequestWithContext(reqCtx, "PUT", srv.URL+"/books/1", nil)
+	req.GetBody = func() (io.ReadCloser, error) { return http.NoBody, nil }
+	res, err := SendAuthorized(srv.Client(), req, app.Resilience{}, AuthorizerOn(ctx, ""), ReauthenticatorOn(ctx, ""))
+	if err != nil {
+		t.Error(err)
+		return 0
+	}
+
+	res.Body.Close()
+	return res.StatusCode
+}
+
+func TestSendAuthorizedReplays(t *testing.T) {
+	srv, requests := bearerServer(t, 0)
+	store := &app.MemoryTokenStore{}
+	store.Store("", "expired")
+	auth := &rotating{store: store, renewals: &atomic.Int32{}} // the refresher is registered for the value
+
+	ctx := appContext(t, srv, auth, nil)
+	if status := sendAuthorized(ctx, t, srv, context.Background()); status != http.StatusNoContent {
+		t.Fatalf("expected the replay to succeed, got %d", status)
+	}
+
+	if requests.Load() != 2 || auth.renewals.Load() != 1 {
+		t.Fatalf("expected a single replay, got %d requests and %d renewals", requests.Load(), auth.renewals.Load())
+	}
+}
+
+func TestSendAuthorizedSharesRenewal(t *testing.T) {
+	const concurrent = 8
+	srv, _ := bearerServer(t, concurrent)
+	store := &app.MemoryTokenStore{}
+	store.Store("", "expired")
+	auth := rotating{store: store, renewals: &atomic.Int32{}}
+
+	ctx := appContext(t, srv, auth, nil)
+	var wg sync.WaitGroup
+	for i := 0; i < concurrent; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if status := sendAuthorized(ctx, t, srv, context.Background()); status != http.StatusNoContent {
+				t.Errorf("expected the replay to succeed, got %d", status)
+			}
+		}()
+	}
+
+	wg.Wait()
+	if n := auth.renewals.Load(); n != 1 {
+		t.Fatalf("expected a single renewal, got %d", n)
+	}
+}
+
+func TestSendAuthorizedLoginFlow(t *testing.T) {
+	const concurrent = 4
+	srv, _ := bearerServer(t, concurrent)
+	store := &app.MemoryTokenStore{}
+	auth := app.Bearer{Store: store}
+
+	var logins atomic.Int32
+	var ctx context.Context
+	flow := app.LoginFlow(func(flowCtx context.Context, connection string, auth app.Authentication) error {
+		logins.Add(1)
+
+		// the flow may verify the credentials using the connection, which must neither deadlock nor recurse
+		if status := sendAuthorized(ctx, t, srv, flowCtx); status != http.StatusUnauthorized {
+			t.Errorf("expected the probe of the flow to be rejected, got %d", status)
+		}
+
+		store.Store(connection, "renewed")
+		return nil
+	})
+
+	ctx = appContext(t, srv, auth, flow)
+	var wg sync.WaitGroup
+	for i := 0; i < concurrent; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if status := sendAuthorized(ctx, t, srv, context.Background()); status != http.StatusNoContent {
+				t.Errorf("expected the replay to succeed, got %d", status)
+			}
+		}()
+	}
+
+	wg.Wait()
+	if n := logins.Load(); n != 1 {
+		t.Fatalf("expected a single login, got %d", n)
+	}
+}
+
+func TestReauthenticateKeepsCancellation(t *testing.T) {
+	srv, _ := bearerServer(t, 0)
+	done := make(chan struct{})
+	flow := app.LoginFlow(func(ctx context.Context, connection string, auth app.Authentication) error {
+		defer close(done)
+		if _, ok := app.Lookup[app.Application](ctx); !ok {
+			t.Error("expected the application of the composing context")
+		}
+
+		if ctx.Err() == nil {
+			t.Error("expected the cancellation of the rejected request")
+		}
+
+		return ctx.Err()
+	})
+
+	ctx := appContext(t, srv, app.Bearer{Store: &app.MemoryTokenStore{}}, flow)
+	reqCtx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	rejected, _ := http.NewRequestWithContext(reqCtx, "GET", srv.URL, nil)
+	if ReauthenticatorOn(ctx, "")(rejected) {
+		t.Fatal("expected a canceled login not to replay")
+	}
+
+	<-done
+}
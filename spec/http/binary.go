@@ -0,0 +1,621 @@
+package http
+
+import (
+	"bytes"
+	"encoding"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxDepth limits the nesting of decoded binary values, so that a hostile body cannot exhaust the stack.
+const maxDepth = 512
+
+// maxPrealloc limits the capacity, which is allocated in advance for a declared length. Longer values grow while
+// they are read, so that a hostile length prefix cannot exhaust the memory.
+const maxPrealloc = 4096
+
+var textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+var textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+var timeType = reflect.TypeOf(time.Time{})
+
+// binaryWriter is implemented by the binary formats, which share the reflection based mapping of values.
+type binaryWriter interface {
+	writeNil()
+	writeBool(b bool)
+	writeInt(i int64)
+	writeUint(u uint64)
+	writeFloat(f float64, bits int)
+	writeString(s string)
+	writeBytes(b []byte)
+	writeTime(t time.Time)
+	writeArrayHeader(n int)
+	writeMapHeader(n int)
+}
+
+// pair is a key value pair of a decoded map, which keeps keys of any type and the order.
+type pair struct {
+	key, value any
+}
+
+// encodeValue writes the value. Structs are written as maps, whose keys are the field names as declared by the
+// given tag or the json tag.
+func encodeValue(w binaryWriter, v reflect.Value, tag string) error {
+	if !v.IsValid() {
+		w.writeNil()
+		return nil
+	}
+
+	if v.Type() == timeType {
+		w.writeTime(v.Interface().(time.Time))
+		return nil
+	}
+
+	if v.Kind() != reflect.Pointer && v.Kind() != reflect.Interface && v.Type().Implements(textMarshalerType) {
+		text, err := v.Interface().(encoding.TextMarshaler).MarshalText()
+		if err != nil {
+			return err
+		}
+
+		w.writeString(string(text))
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		if v.IsNil() {
+			w.writeNil()
+			return nil
+		}
+
+		return encodeValue(w, v.Elem(), tag)
+	case reflect.Bool:
+		w.writeBool(v.Bool())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		w.writeInt(v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		w.writeUint(v.Uint())
+	case reflect.Float32:
+		w.writeFloat(v.Float(), 32)
+	case reflect.Float64:
+		w.writeFloat(v.Float(), 64)
+	case reflect.String:
+		w.writeString(v.String())
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			w.writeNil()
+			return nil
+		}
+
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			buf := make([]byte, v.Len())
+			reflect.Copy(reflect.ValueOf(buf), v)
+			w.writeBytes(buf)
+			return nil
+		}
+
+		w.writeArrayHeader(v.Len())
+		for i := 0; i < v.Len(); i++ {
+			if err := encodeValue(w, v.Index(i), tag); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		if v.IsNil() {
+			w.writeNil()
+			return nil
+		}
+
+		w.writeMapHeader(v.Len())
+		it := v.MapRange()
+		for it.Next() {
+			if err := encodeValue(w, it.Key(), tag); err != nil {
+				return err
+			}
+
+			if err := encodeValue(w, it.Value(), tag); err != nil {
+				return err
+			}
+		}
+	case reflect.Struct:
+		fields := fieldsOf(v.Type(), tag)
+		values := make([]reflect.Value, len(fields))
+		n := 0
+		for i, f := range fields {
+			fv, err := v.FieldByIndexErr(f.index)
+			if err != nil || (f.omitEmpty && fv.IsZero()) {
+				continue // a nil embedded pointer hides its fields
+			}
+
+			values[i] = fv
+			n++
+		}
+
+		w.writeMapHeader(n)
+		for i, f := range fields {
+			if !values[i].IsValid() {
+				continue
+			}
+
+			w.writeString(f.name)
+			if err := encodeValue(w, values[i], tag); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("unsupported type %s", v.Type())
+	}
+
+	return nil
+}
+
+// assign stores the decoded value into dst, converting numbers and mapping maps onto structs.
+func assign(dst reflect.Value, v any, tag string) error {
+	if v == nil {
+		dst.Set(reflect.Zero(dst.Type()))
+		return nil
+	}
+
+	if dst.Kind() == reflect.Pointer {
+		if dst.IsNil() {
+			dst.Set(reflect.New(dst.Type().Elem()))
+		}
+
+		return assign(dst.Elem(), v, tag)
+	}
+
+	if dst.Type() == timeType {
+		t, err := toTime(v)
+		if err != nil {
+			return err
+		}
+
+		dst.Set(reflect.ValueOf(t))
+		return nil
+	}
+
+	if s, ok := v.(string); ok && dst.CanAddr() && dst.Kind() != reflect.String && dst.Addr().Type().Implements(textUnmarshalerType) {
+		return dst.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(s))
+	}
+
+	mismatch := func() error {
+		return fmt.Errorf("cannot decode %T into %s", v, dst.Type())
+	}
+
+	switch dst.Kind() {
+	case reflect.Interface:
+		if dst.NumMethod() != 0 {
+			return mismatch()
+		}
+
+		dst.Set(reflect.ValueOf(generic(v)))
+	case reflect.Bool:
+		b, ok := v.(bool)
+		if !ok {
+			return mismatch()
+		}
+
+		dst.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		var i int64
+		switch n := v.(type) {
+		case int64:
+			i = n
+		case uint64:
+			if n > math.MaxInt64 {
+				return fmt.Errorf("%d overflows %s", n, dst.Type())
+			}
+
+			i = int64(n)
+		case float64:
+			if n != math.Trunc(n) {
+				return mismatch()
+			}
+
+			i = int64(n)
+		default:
+			return mismatch()
+		}
+
+		if dst.OverflowInt(i) {
+			return fmt.Errorf("%d overflows %s", i, dst.Type())
+		}
+
+		dst.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		var u uint64
+		switch n := v.(type) {
+		case uint64:
+			u = n
+		case int64:
+			if n < 0 {
+				return fmt.Errorf("%d overflows %s", n, dst.Type())
+			}
+
+			u = uint64(n)
+		case float64:
+			if n < 0 || n != math.Trunc(n) {
+				return mismatch()
+			}
+
+			u = uint64(n)
+		default:
+			return mismatch()
+		}
+
+		if dst.OverflowUint(u) {
+			return fmt.Errorf("%d overflows %s", u, dst.Type())
+		}
+
+		dst.SetUint(u)
+	case reflect.Float32, reflect.Float64:
+		switch n := v.(type) {
+		case float64:
+			dst.SetFloat(n)
+		case int64:
+			dst.SetFloat(float64(n))
+		case uint64:
+			dst.SetFloat(float64(n))
+		default:
+			return mismatch()
+		}
+	case reflect.String:
+		switch s := v.(type) {
+		case string:
+			dst.SetString(s)
+		case []byte:
+			dst.SetString(string(s))
+		default:
+			return mismatch()
+		}
+	case reflect.Slice:
+		if dst.Type().Elem().Kind() == reflect.Uint8 {
+			switch b := v.(type) {
+			case []byte:
+				dst.SetBytes(append([]byte{}, b...))
+				return nil
+			case string:
+				dst.SetBytes([]byte(b))
+				return nil
+			}
+		}
+
+		arr, ok := v.([]any)
+		if !ok {
+			return mismatch()
+		}
+
+		slice := reflect.MakeSlice(dst.Type(), len(arr), len(arr))
+		for i, e := range arr {
+			if err := assign(slice.Index(i), e, tag); err != nil {
+				return err
+			}
+		}
+
+		dst.Set(slice)
+	case reflect.Array:
+		if b, ok := v.([]byte); ok && dst.Type().Elem().Kind() == reflect.Uint8 {
+			reflect.Copy(dst, reflect.ValueOf(b))
+			return nil
+		}
+
+		arr, ok := v.([]any)
+		if !ok {
+			return mismatch()
+		}
+
+		for i := 0; i < dst.Len(); i++ {
+			var e any
+			if i < len(arr) {
+				e = arr[i]
+			}
+
+			if err := assign(dst.Index(i), e, tag); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		pairs, ok := v.([]pair)
+		if !ok {
+			return mismatch()
+		}
+
+		if dst.IsNil() {
+			dst.Set(reflect.MakeMapWithSize(dst.Type(), len(pairs)))
+		}
+
+		for _, p := range pairs {
+			key := reflect.New(dst.Type().Key()).Elem()
+			if err := assignKey(key, p.key, tag); err != nil {
+				return err
+			}
+
+			elem := reflect.New(dst.Type().Elem()).Elem()
+			if err := assign(elem, p.value, tag); err != nil {
+				return err
+			}
+
+			dst.SetMapIndex(key, elem)
+		}
+	case reflect.Struct:
+		pairs, ok := v.([]pair)
+		if !ok {
+			return mismatch()
+		}
+
+		fields := fieldsOf(dst.Type(), tag)
+		for _, p := range pairs {
+			name, ok := p.key.(string)
+			if !ok {
+				continue
+			}
+
+			f, ok := fieldByName(fields, name)
+			if !ok {
+				continue // like json, unknown fields are ignored
+			}
+
+			if err := assign(allocField(dst, f.index), p.value, tag); err != nil {
+				return fmt.Errorf("%s: %w", name, err)
+			}
+		}
+	default:
+		return mismatch()
+	}
+
+	return nil
+}
+
+// assignKey converts map keys, so that e.g. integer keys can be decoded into a map with string keys.
+func assignKey(key reflect.Value, v any, tag string) error {
+	if key.Kind() == reflect.String {
+		switch k := v.(type) {
+		case int64:
+			v = strconv.FormatInt(k, 10)
+		case uint64:
+			v = strconv.FormatUint(k, 10)
+		}
+	}
+
+	if s, ok := v.(string); ok {
+		switch key.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+				v = i
+			}
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			if u, err := strconv.ParseUint(s, 10, 64); err == nil {
+				v = u
+			}
+		}
+	}
+
+	return assign(key, v, tag)
+}
+
+// generic converts a decoded value for an interface: maps with string keys become map[string]any, other maps
+// become map[any]any and integers become int64, unless they only fit into an uint64.
+func generic(v any) any {
+	switch t := v.(type) {
+	case uint64:
+		if t <= math.MaxInt64 {
+			return int64(t)
+		}
+
+		return t
+	case []any:
+		res := make([]any, len(t))
+		for i, e := range t {
+			res[i] = generic(e)
+		}
+
+		return res
+	case []pair:
+		strs := make(map[string]any, len(t))
+		for _, p := range t {
+			k, ok := p.key.(string)
+			if !ok {
+				anys := make(map[any]any, len(t))
+				for _, p := range t {
+					key := generic(p.key)
+					if !reflect.TypeOf(key).Comparable() {
+						key = fmt.Sprint(key)
+					}
+
+					anys[key] = generic(p.value)
+				}
+
+				return anys
+			}
+
+			strs[k] = generic(p.value)
+		}
+
+		return strs
+	default:
+		return v
+	}
+}
+
+func toTime(v any) (time.Time, error) {
+	switch t := v.(type) {
+	case time.Time:
+		return t, nil
+	case string:
+		return time.Parse(time.RFC3339Nano, t)
+	case int64:
+		return time.Unix(t, 0), nil
+	case uint64:
+		return time.Unix(int64(t), 0), nil
+	case float64:
+		sec, frac := math.Modf(t)
+		return time.Unix(int64(sec), int64(frac*1e9)), nil
+	default:
+		return time.Time{}, fmt.Errorf("cannot decode %T into time.Time", v)
+	}
+}
+
+type field struct {
+	name      string
+	index     []int
+	omitEmpty bool
+}
+
+var fieldCache sync.Map // map[fieldKey][]field
+
+type fieldKey struct {
+	typ reflect.Type
+	tag string
+}
+
+// fieldsOf returns the exported fields including the promoted ones of embedded structs. The name is taken from
+// the given tag, then from the json tag and defaults to the field name.
+func fieldsOf(t reflect.Type, tag string) []field {
+	if cached, ok := fieldCache.Load(fieldKey{t, tag}); ok {
+		return cached.([]field)
+	}
+
+	var fields []field
+	for _, f := range reflect.VisibleFields(t) {
+		name, opts, tagged := lookupTag(f.Tag, tag)
+		if name == "-" && opts == "" {
+			continue
+		}
+
+		if f.Anonymous && !tagged {
+			ft := f.Type
+			if ft.Kind() == reflect.Pointer {
+				ft = ft.Elem()
+			}
+
+			if ft.Kind() == reflect.Struct {
+				continue // the promoted fields are visible on their own
+			}
+		}
+
+		if !f.IsExported() {
+			continue
+		}
+
+		if promotedFromTagged(t, f.Index, tag) {
+			continue
+		}
+
+		if name == "" {
+			name = f.Name
+		}
+
+		fields = append(fields, field{name: name, index: f.Index, omitEmpty: strings.Contains(","+opts+",", ",omitempty,")})
+	}
+
+	fieldCache.Store(fieldKey{t, tag}, fields)
+	return fields
+}
+
+// promotedFromTagged reports whether the field is promoted from an embedded struct, which has a name of its own.
+func promotedFromTagged(t reflect.Type, index []int, tag string) bool {
+	for i := 1; i < len(index); i++ {
+		outer := t.FieldByIndex(index[:i])
+		if _, _, tagged := lookupTag(outer.Tag, tag); tagged {
+			return true
+		}
+	}
+
+	return false
+}
+
+func lookupTag(st reflect.StructTag, tag string) (name, opts string, ok bool) {
+	v, ok := st.Lookup(tag)
+	if !ok {
+		v, ok = st.Lookup("json")
+	}
+
+	name, opts, _ = strings.Cut(v, ",")
+	return name, opts, ok && name != ""
+}
+
+// fieldByName prefers the exact name and falls back to a case-insensitive match, like json.
+func fieldByName(fields []field, name string) (field, bool) {
+	for _, f := range fields {
+		if f.name == name {
+			return f, true
+		}
+	}
+
+	for _, f := range fields {
+		if strings.EqualFold(f.name, name) {
+			return f, true
+		}
+	}
+
+	return field{}, false
+}
+
+// allocField returns the field, allocating nil embedded pointers on the way.
+func allocField(v reflect.Value, index []int) reflect.Value {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Pointer {
+			if v.IsNil() {
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+
+			v = v.Elem()
+		}
+
+		v = v.Field(x)
+	}
+
+	return v
+}
+
+// decodeInto assigns the decoded value to the pointer v.
+func decodeInto(v any, decoded any, tag string) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() {
+		return fmt.Errorf("cannot decode into %T, a non-nil pointer is required", v)
+	}
+
+	return assign(rv.Elem(), decoded, tag)
+}
+
+// readBytes reads n bytes. Long values are read in chunks, so that memory is only spent on data actually present.
+func readBytes(r io.Reader, n uint64) ([]byte, error) {
+	if n <= maxPrealloc {
+		buf := make([]byte, n)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, unexpectedEOF(err)
+		}
+
+		return buf, nil
+	}
+
+	if n > math.MaxInt64 {
+		return nil, fmt.Errorf("length %d exceeds the limit", n)
+	}
+
+	var buf bytes.Buffer
+	if _, err := io.CopyN(&buf, r, int64(n)); err != nil {
+		return nil, unexpectedEOF(err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// capacity returns the capacity to allocate in advance for a declared number of elements.
+func capacity(n uint64) int {
+	return int(min(n, maxPrealloc))
+}
+
+func unexpectedEOF(err error) error {
+	if errors.Is(err, io.EOF) {
+		return io.ErrUnexpectedEOF
+	}
+
+	return err
+}
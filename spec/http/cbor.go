@@ -0,0 +1,420 @@
+package http
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+	"time"
+)
+
+// CBOR is a Codec for application/cbor (RFC 8949). Values are mapped like JSON does: structs become maps keyed by
+// the field name of the cbor or the json tag, time.Time is written as a tagged RFC 3339 string and byte slices
+// become byte strings.
+type CBOR struct{}
+
+func (CBOR) ContentType() string {
+	return "application/cbor"
+}
+
+func (CBOR) Encode(w io.Writer, v any) error {
+	enc := &cborWriter{}
+	if err := encodeValue(enc, reflect.ValueOf(v), "cbor"); err != nil {
+		return err
+	}
+
+	_, err := w.Write(enc.buf)
+	return err
+}
+
+func (CBOR) Decode(r io.Reader, v any) error {
+	dec := cborReader{r: bufio.NewReader(r)}
+	decoded, err := dec.value()
+	if err != nil {
+		return err
+	}
+
+	if decoded == cborBreak {
+		return errors.New("cbor: unexpected break")
+	}
+
+	return decodeInto(v, decoded, "cbor")
+}
+
+const (
+	cborUint = iota
+	cborNegInt
+	cborBytes
+	cborText
+	cborArray
+	cborMap
+	cborTag
+	cborSimple
+)
+
+type cborWriter struct {
+	buf []byte
+}
+
+func (w *cborWriter) head(major byte, n uint64) {
+	switch {
+	case n < 24:
+		w.buf = append(w.buf, major<<5|byte(n))
+	case n <= math.MaxUint8:
+		w.buf = append(w.buf, major<<5|24, byte(n))
+	case n <= math.MaxUint16:
+		w.buf = binary.BigEndian.AppendUint16(append(w.buf, major<<5|25), uint16(n))
+	case n <= math.MaxUint32:
+		w.buf = binary.BigEndian.AppendUint32(append(w.buf, major<<5|26), uint32(n))
+	default:
+		w.buf = binary.BigEndian.AppendUint64(append(w.buf, major<<5|27), n)
+	}
+}
+
+func (w *cborWriter) writeNil() {
+	w.buf = append(w.buf, 0xf6)
+}
+
+func (w *cborWriter) writeBool(b bool) {
+	if b {
+		w.buf = append(w.buf, 0xf5)
+	} else {
+		w.buf = append(w.buf, 0xf4)
+	}
+}
+
+func (w *cborWriter) writeInt(i int64) {
+	if i >= 0 {
+		w.head(cborUint, uint64(i))
+	} else {
+		w.head(cborNegInt, uint64(-1-i))
+	}
+}
+
+func (w *cborWriter) writeUint(u uint64) {
+	w.head(cborUint, u)
+}
+
+func (w *cborWriter) writeFloat(f float64, bits int) {
+	if bits == 32 {
+		w.buf = binary.BigEndian.AppendUint32(append(w.buf, 0xfa), math.Float32bits(float32(f)))
+	} else {
+		w.buf = binary.BigEndian.AppendUint64(append(w.buf, 0xfb), math.Float64bits(f))
+	}
+}
+
+func (w *cborWriter) writeString(s string) {
+	w.head(cborText, uint64(len(s)))
+	w.buf = append(w.buf, s...)
+}
+
+func (w *cborWriter) writeBytes(b []byte) {
+	w.head(cborBytes, uint64(len(b)))
+	w.buf = append(w.buf, b...)
+}
+
+func (w *cborWriter) writeTime(t time.Time) {
+	w.head(cborTag, 0)
+	w.writeString(t.Format(time.RFC3339Nano))
+}
+
+func (w *cborWriter) writeArrayHeader(n int) {
+	w.head(cborArray, uint64(n))
+}
+
+func (w *cborWriter) writeMapHeader(n int) {
+	w.head(cborMap, uint64(n))
+}
+
+// cborBreak is returned for the stop code of an indefinite length item.
+var cborBreak = &struct{}{}
+
+type cborReader struct {
+	r     *bufio.Reader
+	depth int
+}
+
+// argument reads the argument of the initial byte. Indefinite reports the additional information 31.
+func (d *cborReader) argument(info byte) (n uint64, indefinite bool, err error) {
+	var size int
+	switch {
+	case info < 24:
+		return uint64(info), false, nil
+	case info == 24:
+		size = 1
+	case info == 25:
+		size = 2
+	case info == 26:
+		size = 4
+	case info == 27:
+		size = 8
+	case info == 31:
+		return 0, true, nil
+	default:
+		return 0, false, fmt.Errorf("cbor: invalid additional information %d", info)
+	}
+
+	var buf [8]byte
+	if _, err := io.ReadFull(d.r, buf[8-size:]); err != nil {
+		return 0, false, unexpectedEOF(err)
+	}
+
+	return binary.BigEndian.Uint64(buf[:]), false, nil
+}
+
+func (d *cborReader) value() (any, error) {
+	d.depth++
+	defer func() { d.depth-- }()
+	if d.depth > maxDepth {
+		return nil, errors.New("cbor: nesting exceeds the limit")
+	}
+
+	b, err := d.r.ReadByte()
+	if err != nil {
+		return nil, unexpectedEOF(err)
+	}
+
+	major, info := b>>5, b&0x1f
+	if major == cborSimple {
+		return d.simple(info)
+	}
+
+	n, indefinite, err := d.argument(info)
+	if err != nil {
+		return nil, err
+	}
+
+	if indefinite && (major == cborUint || major == cborNegInt || major == cborTag) {
+		return nil, fmt.Errorf("cbor: major type %d cannot have an indefinite length", major)
+	}
+
+	switch major {
+	case cborUint:
+		return n, nil
+	case cborNegInt:
+		if n > math.MaxInt64 {
+			return nil, errors.New("cbor: negative integer overflows int64")
+		}
+
+		return -1 - int64(n), nil
+	case cborBytes, cborText:
+		buf, err := d.chunks(major, n, indefinite)
+		if err != nil {
+			return nil, err
+		}
+
+		if major == cborText {
+			return string(buf), nil
+		}
+
+		return buf, nil
+	case cborArray:
+		arr := make([]any, 0, capacity(n))
+		for i := uint64(0); indefinite || i < n; i++ {
+			e, err := d.value()
+			if err != nil {
+				return nil, err
+			}
+
+			if e == cborBreak {
+				if !indefinite {
+					return nil, errors.New("cbor: unexpected break")
+				}
+
+				break
+			}
+
+			arr = append(arr, e)
+		}
+
+		return arr, nil
+	case cborMap:
+		pairs := make([]pair, 0, capacity(n))
+		for i := uint64(0); indefinite || i < n; i++ {
+			k, err := d.value()
+			if err != nil {
+				return nil, err
+			}
+
+			if k == cborBreak {
+				if !indefinite {
+					return nil, errors.New("cbor: unexpected break")
+				}
+
+				break
+			}
+
+			v, err := d.value()
+			if err != nil {
+				return nil, err
+			}
+
+			if v == cborBreak {
+				return nil, errors.New("cbor: map without value")
+			}
+
+			pairs = append(pairs, pair{key: k, value: v})
+		}
+
+		return pairs, nil
+	default: // cborTag
+		return d.tagged(n)
+	}
+}
+
+// chunks reads a byte or text string, which may be split into definite length chunks of the same major type.
+func (d *cborReader) chunks(major byte, n uint64, indefinite bool) ([]byte, error) {
+	if !indefinite {
+		return readBytes(d.r, n)
+	}
+
+	var res []byte
+	for {
+		b, err := d.r.ReadByte()
+		if err != nil {
+			return nil, unexpectedEOF(err)
+		}
+
+		if b == 0xff {
+			return res, nil
+		}
+
+		if b>>5 != major {
+			return nil, errors.New("cbor: invalid chunk in indefinite length string")
+		}
+
+		n, indefinite, err := d.argument(b & 0x1f)
+		if err != nil {
+			return nil, err
+		}
+
+		if indefinite {
+			return nil, errors.New("cbor: nested indefinite length string")
+		}
+
+		chunk, err := readBytes(d.r, n)
+		if err != nil {
+			return nil, err
+		}
+
+		res = append(res, chunk...)
+	}
+}
+
+// tagged interprets the date/time and bignum tags. Other tags are ignored and yield their content.
+func (d *cborReader) tagged(tag uint64) (any, error) {
+	v, err := d.value()
+	if err != nil {
+		return nil, err
+	}
+
+	if v == cborBreak {
+		return nil, errors.New("cbor: unexpected break")
+	}
+
+	switch tag {
+	case 0:
+		s, ok := v.(string)
+		if !ok {
+			return nil, errors.New("cbor: date/time must be a text string")
+		}
+
+		return time.Parse(time.RFC3339Nano, s)
+	case 1:
+		t, err := toTime(v)
+		if err != nil {
+			return nil, fmt.Errorf("cbor: %w", err)
+		}
+
+		return t, nil
+	case 2, 3:
+		b, ok := v.([]byte)
+		if !ok {
+			return nil, errors.New("cbor: bignum must be a byte string")
+		}
+
+		var n uint64
+		for i, c := range b {
+			if c != 0 && len(b)-i > 8 {
+				return nil, errors.New("cbor: bignum overflows uint64")
+			}
+
+			n = n<<8 | uint64(c)
+		}
+
+		if tag == 2 {
+			return n, nil
+		}
+
+		if n > math.MaxInt64 {
+			return nil, errors.New("cbor: negative bignum overflows int64")
+		}
+
+		return -1 - int64(n), nil
+	default:
+		return v, nil
+	}
+}
+
+func (d *cborReader) simple(info byte) (any, error) {
+	switch info {
+	case 20:
+		return false, nil
+	case 21:
+		return true, nil
+	case 22, 23:
+		return nil, nil
+	case 25:
+		var buf [2]byte
+		if _, err := io.ReadFull(d.r, buf[:]); err != nil {
+			return nil, unexpectedEOF(err)
+		}
+
+		return halfFloat(binary.BigEndian.Uint16(buf[:])), nil
+	case 26:
+		var buf [4]byte
+		if _, err := io.ReadFull(d.r, buf[:]); err != nil {
+			return nil, unexpectedEOF(err)
+		}
+
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(buf[:]))), nil
+	case 27:
+		var buf [8]byte
+		if _, err := io.ReadFull(d.r, buf[:]); err != nil {
+			return nil, unexpectedEOF(err)
+		}
+
+		return math.Float64frombits(binary.BigEndian.Uint64(buf[:])), nil
+	case 31:
+		return cborBreak, nil
+	default:
+		return nil, fmt.Errorf("cbor: unsupported simple value %d", info)
+	}
+}
+
+// halfFloat converts an IEEE 754 half precision float.
+func halfFloat(h uint16) float64 {
+	exp, mant := int(h>>10&0x1f), float64(h&0x3ff)
+	var f float64
+	switch exp {
+	case 0:
+		f = math.Ldexp(mant, -24)
+	case 31:
+		if mant == 0 {
+			f = math.Inf(1)
+		} else {
+			f = math.NaN()
+		}
+	default:
+		f = math.Ldexp(mant+1024, exp-25)
+	}
+
+	if h&0x8000 != 0 {
+		return -f
+	}
+
+	return f
+}
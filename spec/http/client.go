@@ -0,0 +1,174 @@
+package http
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"github.com/gotrino/fusion/spec/app"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"sync"
+)
+
+var clients = map[[sha256.Size]byte]*http.Client{}
+var clientsLock sync.Mutex
+
+// BaseURL returns the absolute url of the path on the Connection, including its BasePath.
+func BaseURL(c app.Connection, p string) *url.URL {
+	p = strings.TrimPrefix(path.Join(c.BasePath, p), "/")
+	base, err := url.Parse(fmt.Sprintf("%s://%s:%d/%s", c.Scheme, c.Host, c.Port, p))
+	if err != nil {
+		panic(fmt.Errorf("invalid url: %w", err))
+	}
+
+	return base
+}
+
+// ClientOn returns the client of the named Connection, which is built once from its TLS, Proxy, Timeout and
+// Headers. A Connection without any of them uses http.DefaultClient. An unknown connection or an invalid
+// configuration, like an unreadable certificate file, is returned as error.
+func ClientOn(ctx context.Context, connection string) (*http.Client, error) {
+	c, err := app.FromContext[app.Application](ctx).ConnectionOf(connection)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := SharedClient(c)
+	if err != nil {
+		return nil, fmt.Errorf("invalid connection %s: %w", connection, err)
+	}
+
+	return client, nil
+}
+
+// SharedClient returns the client for the configuration of the Connection, which is shared by all Connections
+// with the same configuration, so that connections to the server are pooled.
+func SharedClient(c app.Connection) (*http.Client, error) {
+	if c.TLS.IsZero() && c.Proxy == "" && c.Timeout == 0 && len(c.Headers) == 0 {
+		return http.DefaultClient, nil
+	}
+
+	buf, err := json.Marshal([]any{c.TLS, c.Proxy, c.Timeout, c.Headers})
+	if err != nil {
+		return nil, err
+	}
+
+	key := sha256.Sum256(buf)
+
+	clientsLock.Lock()
+	defer clientsLock.Unlock()
+
+	if client, ok := clients[key]; ok {
+		return client, nil
+	}
+
+	client, err := NewClient(c)
+	if err != nil {
+		return nil, err
+	}
+
+	clients[key] = client
+	return client, nil
+}
+
+// NewClient builds a new client for the TLS, Proxy, Timeout and Headers of the Connection.
+func NewClient(c app.Connection) (*http.Client, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if !c.TLS.IsZero() {
+		cfg, err := tlsConfig(c.TLS)
+		if err != nil {
+			return nil, err
+		}
+
+		transport.TLSClientConfig = cfg
+	}
+
+	if c.Proxy != "" {
+		proxy, err := url.Parse(c.Proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy: %w", err)
+		}
+
+		if proxy.Host == "" {
+			return nil, fmt.Errorf("invalid proxy: %s has no host", c.Proxy)
+		}
+
+		transport.Proxy = http.ProxyURL(proxy)
+	}
+
+	var rt http.RoundTripper = transport
+	if len(c.Headers) > 0 {
+		rt = headerTransport{next: transport, headers: c.Headers}
+	}
+
+	return &http.Client{Transport: rt, Timeout: c.Timeout}, nil
+}
+
+func tlsConfig(t app.TLS) (*tls.Config, error) {
+	cfg := &tls.Config{ServerName: t.ServerName, InsecureSkipVerify: t.InsecureSkipVerify}
+
+	rootCAs := t.RootCAs
+	if t.RootCAFile != "" {
+		buf, err := os.ReadFile(t.RootCAFile)
+		if err != nil {
+			return nil, err
+		}
+
+		rootCAs = append(append([]byte{}, rootCAs...), buf...)
+	}
+
+	if len(rootCAs) > 0 {
+		pool, err := x509.SystemCertPool()
+		if err != nil || pool == nil {
+			pool = x509.NewCertPool()
+		}
+
+		if !pool.AppendCertsFromPEM(rootCAs) {
+			return nil, fmt.Errorf("no valid root CA certificate found")
+		}
+
+		cfg.RootCAs = pool
+	}
+
+	switch {
+	case len(t.Certificate) > 0 || len(t.Key) > 0:
+		cert, err := tls.X509KeyPair(t.Certificate, t.Key)
+		if err != nil {
+			return nil, fmt.Errorf("invalid client certificate: %w", err)
+		}
+
+		cfg.Certificates = []tls.Certificate{cert}
+	case t.CertFile != "" || t.KeyFile != "":
+		cert, err := tls.LoadX509KeyPair(t.CertFile, t.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("invalid client certificate: %w", err)
+		}
+
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+
+	return cfg, nil
+}
+
+// headerTransport adds the default headers of a Connection.
+type headerTransport struct {
+	next    http.RoundTripper
+	headers map[string]string
+}
+
+func (t headerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	for k, v := range t.headers {
+		if req.Header.Get(k) == "" {
+			req.Header.Set(k, v)
+		}
+	}
+
+	return t.next.RoundTrip(req)
+}
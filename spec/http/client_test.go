@@ -0,0 +1,249 @@
+package http
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"github.com/gotrino/fusion/spec/app"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBaseURL(t *testing.T) {
+	c := app.Connection{Scheme: "https", Host: "example.com", Port: 8443}
+	tests := []struct {
+		basePath, path, want string
+	}{
+		{"", "/books", "https://example.com:8443/books"},
+		{"", "", "https://example.com:8443/"},
+		{"/backend/api", "books", "https://example.com:8443/backend/api/books"},
+		{"/backend/", "/books/", "https://example.com:8443/backend/books"},
+		{"backend", "", "https://example.com:8443/backend"},
+		{"/backend", "books/1%2F2", "https://example.com:8443/backend/books/1%2F2"},
+	}
+
+	for _, tt := range tests {
+		c.BasePath = tt.basePath
+		if got := BaseURL(c, tt.path).String(); got != tt.want {
+			t.Errorf("BaseURL(%q, %q) = %s, want %s", tt.basePath, tt.path, got, tt.want)
+		}
+	}
+}
+
+// certificate returns a self-signed certificate and its key as PEM.
+func certificate(t *testing.T) ([]byte, []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "client"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+func TestNewClient(t *testing.T) {
+	cert, key := certificate(t)
+	_, otherKey := certificate(t)
+
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	if err := os.WriteFile(certFile, cert, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(keyFile, key, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		c     app.Connection
+		err   string // err is a part of the expected error, if not empty
+		check func(t *testing.T, transport *http.Transport)
+	}{
+		{name: "root ca", c: app.Connection{TLS: app.TLS{RootCAs: cert}}, check: func(t *testing.T, transport *http.Transport) {
+			if transport.TLSClientConfig.RootCAs == nil {
+				t.Fatal("expected the root CAs")
+			}
+		}},
+		{name: "root ca file", c: app.Connection{TLS: app.TLS{RootCAFile: certFile}}, check: func(t *testing.T, transport *http.Transport) {
+			if transport.TLSClientConfig.RootCAs == nil {
+				t.Fatal("expected the root CAs")
+			}
+		}},
+		{name: "missing root ca file", c: app.Connection{TLS: app.TLS{RootCAFile: filepath.Join(dir, "missing.pem")}}, err: "no such file"},
+		{name: "invalid root ca", c: app.Connection{TLS: app.TLS{RootCAs: []byte("no pem")}}, err: "no valid root CA"},
+		{name: "client certificate", c: app.Connection{TLS: app.TLS{Certificate: cert, Key: key}}, check: func(t *testing.T, transport *http.Transport) {
+			if len(transport.TLSClientConfig.Certificates) != 1 {
+				t.Fatal("expected the client certificate")
+			}
+		}},
+		{name: "client certificate files", c: app.Connection{TLS: app.TLS{CertFile: certFile, KeyFile: keyFile}}, check: func(t *testing.T, transport *http.Transport) {
+			if len(transport.TLSClientConfig.Certificates) != 1 {
+				t.Fatal("expected the client certificate")
+			}
+		}},
+		{name: "mismatched key", c: app.Connection{TLS: app.TLS{Certificate: cert, Key: otherKey}}, err: "invalid client certificate"},
+		{name: "missing key", c: app.Connection{TLS: app.TLS{Certificate: cert}}, err: "invalid client certificate"},
+		{name: "missing key file", c: app.Connection{TLS: app.TLS{CertFile: certFile}}, err: "invalid client certificate"},
+		{name: "server name", c: app.Connection{TLS: app.TLS{ServerName: "api.internal", InsecureSkipVerify: true}}, check: func(t *testing.T, transport *http.Transport) {
+			if cfg := transport.TLSClientConfig; cfg.ServerName != "api.internal" || !cfg.InsecureSkipVerify {
+				t.Fatalf("unexpected tls config %+v", cfg)
+			}
+		}},
+		{name: "proxy", c: app.Connection{Proxy: "http://proxy.internal:3128"}, check: func(t *testing.T, transport *http.Transport) {
+			req, _ := http.NewRequest("GET", "https://example.com/books", nil)
+			if u, err := transport.Proxy(req); err != nil || u.String() != "http://proxy.internal:3128" {
+				t.Fatalf("unexpected proxy %v %v", u, err)
+			}
+		}},
+		{name: "invalid proxy", c: app.Connection{Proxy: "://proxy"}, err: "invalid proxy"},
+		{name: "proxy without scheme", c: app.Connection{Proxy: "proxy.internal:3128"}, err: "invalid proxy"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, err := NewClient(tt.c)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("expected an error containing %q, got %v", tt.err, err)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			tt.check(t, client.Transport.(*http.Transport))
+		})
+	}
+}
+
+func TestClientOn(t *testing.T) {
+	var tenants []string
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tenants = append(tenants, r.Header.Get("X-Tenant"))
+	}))
+	defer srv.Close()
+
+	rootCAs := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+	c := connectionOf(t, srv)
+	c.TLS = app.TLS{RootCAs: rootCAs}
+	c.Headers = map[string]string{"X-Tenant": "default"}
+	misnamed := c
+	misnamed.TLS.ServerName = "other.invalid"
+	ctx := app.WithContext(context.Background(), app.Application{
+		Connection: c,
+		Connections: map[string]app.Connection{
+			"misnamed": misnamed,
+			"broken":   {TLS: app.TLS{RootCAs: []byte("no pem")}},
+			"plain":    {Scheme: "http", Host: "example.com", Port: 80},
+		},
+	})
+
+	client, err := ClientOn(ctx, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if shared, _ := ClientOn(ctx, ""); shared != client {
+		t.Fatal("expected the client to be shared")
+	}
+
+	for _, tenant := range []string{"", "own"} {
+		req, _ := http.NewRequest("GET", srv.URL, nil)
+		if tenant != "" {
+			req.Header.Set("X-Tenant", tenant)
+		}
+
+		res, err := client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		res.Body.Close()
+		if req.Header.Get("X-Tenant") != tenant {
+			t.Fatal("the request of the caller must not be modified")
+		}
+	}
+
+	if len(tenants) != 2 || tenants[0] != "default" || tenants[1] != "own" {
+		t.Fatalf("expected the default header unless already set, got %v", tenants)
+	}
+
+	if other, err := ClientOn(ctx, "misnamed"); err != nil {
+		t.Fatal(err)
+	} else if _, err := other.Get(srv.URL); err == nil {
+		t.Fatal("expected the certificate to be verified against the server name")
+	}
+
+	if plain, err := ClientOn(ctx, "plain"); err != nil || plain != http.DefaultClient {
+		t.Fatalf("expected the default client, got %v", err)
+	}
+
+	if _, err := ClientOn(ctx, "broken"); err == nil || !strings.Contains(err.Error(), "invalid connection broken") {
+		t.Fatalf("expected the invalid configuration, got %v", err)
+	}
+
+	if _, err := ClientOn(ctx, "missing"); !errors.Is(err, app.ErrUnknownConnection) {
+		t.Fatalf("expected an unknown connection, got %v", err)
+	}
+}
+
+func TestClientOnProxy(t *testing.T) {
+	var proxied string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied = r.URL.String()
+	}))
+	defer proxy.Close()
+
+	ctx := app.WithContext(context.Background(), app.Application{
+		Connection: app.Connection{Scheme: "http", Host: "backend.invalid", Port: 80, Proxy: proxy.URL},
+	})
+
+	client, err := ClientOn(ctx, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := client.Get(BaseURL(app.FromContext[app.Application](ctx).Connection, "/books").String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res.Body.Close()
+	if proxied != "http://backend.invalid:80/books" {
+		t.Fatalf("expected the request to be sent through the proxy, got %q", proxied)
+	}
+}
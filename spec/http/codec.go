@@ -0,0 +1,286 @@
+package http
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+var codecs = map[string]Codec{}
+var codecsLock sync.RWMutex
+
+func init() {
+	RegisterCodec(JSON{})
+	RegisterCodec(XML{})
+	RegisterCodec(NDJSON{})
+	RegisterCodec(CBOR{})
+	RegisterCodec(MessagePack{})
+	RegisterCodec(MessagePack{MediaType: "application/x-msgpack"})
+}
+
+// A Codec encodes and decodes entities for a specific media type. JSON, XML, NDJSON, CBOR and MessagePack are
+// registered by default, further formats are added with RegisterCodec.
+type Codec interface {
+	// ContentType returns the media type, like application/json.
+	ContentType() string
+	Encode(w io.Writer, v any) error
+	Decode(r io.Reader, v any) error
+}
+
+// RegisterCodec makes the codec available for content negotiation by its content type.
+func RegisterCodec(c Codec) {
+	codecsLock.Lock()
+	defer codecsLock.Unlock()
+
+	codecs[c.ContentType()] = c
+}
+
+// LookupCodec returns the registered codec for the given media type. Parameters like charset are ignored.
+func LookupCodec(contentType string) (Codec, bool) {
+	codecsLock.RLock()
+	defer codecsLock.RUnlock()
+
+	c, ok := codecs[mediaType(contentType)]
+	return c, ok
+}
+
+// Negotiate picks the codec which matches the given Content-Type header from the offered codecs. If no codec
+// has been offered, the registered codecs are used.
+func Negotiate(contentType string, offered ...Codec) (Codec, bool) {
+	if len(offered) == 0 {
+		return LookupCodec(contentType)
+	}
+
+	mt := mediaType(contentType)
+	for _, c := range offered {
+		if c.ContentType() == mt {
+			return c, true
+		}
+	}
+
+	return nil, false
+}
+
+// Accept returns the value for an Accept header, which prefers the codecs in the given order.
+func Accept(offered ...Codec) string {
+	var sb strings.Builder
+	for i, c := range offered {
+		if i > 0 {
+			sb.WriteString(", ")
+		}
+
+		sb.WriteString(c.ContentType())
+		if i > 0 {
+			q := 10 - i
+			if q < 1 {
+				q = 1
+			}
+
+			sb.WriteString(fmt.Sprintf(";q=0.%d", q))
+		}
+	}
+
+	return sb.String()
+}
+
+// Encode marshals v using the codec into Params, ready to be sent with Do.
+func Encode(c Codec, v any) (Params, error) {
+	var buf bytes.Buffer
+	if err := c.Encode(&buf, v); err != nil {
+		return Params{}, HttpError{Status: EncoderError, Cause: err}
+	}
+
+	return Params{ContentType: c.ContentType(), Body: buf.Bytes(), Accept: c.ContentType()}, nil
+}
+
+// Decode unmarshals a body as returned by Do using the codec.
+func Decode(c Codec, body []byte, v any) error {
+	if err := c.Decode(bytes.NewReader(body), v); err != nil {
+		return HttpError{Status: DecoderError, Cause: err}
+	}
+
+	return nil
+}
+
+func mediaType(contentType string) string {
+	mt, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return strings.TrimSpace(strings.ToLower(contentType))
+	}
+
+	return mt
+}
+
+// JSON is the default Codec for application/json.
+type JSON struct {
+	DisallowUnknownFields bool // DisallowUnknownFields fails decoding if the body contains unknown fields.
+	UseNumber             bool // UseNumber decodes numbers into an interface as json.Number instead of float64.
+}
+
+func (JSON) ContentType() string {
+	return "application/json"
+}
+
+func (c JSON) Encode(w io.Writer, v any) error {
+	return json.NewEncoder(w).Encode(v)
+}
+
+func (c JSON) Decode(r io.Reader, v any) error {
+	return c.NewDecoder(r).Decode(v)
+}
+
+// NewDecoder returns a configured json.Decoder, e.g. to stream the elements of an array.
+func (c JSON) NewDecoder(r io.Reader) *json.Decoder {
+	dec := json.NewDecoder(r)
+	if c.DisallowUnknownFields {
+		dec.DisallowUnknownFields()
+	}
+
+	if c.UseNumber {
+		dec.UseNumber()
+	}
+
+	return dec
+}
+
+// XML is a Codec for application/xml. Slices are wrapped into a root element, whose children are the elements.
+type XML struct {
+	Root string // Root is the name of the element which wraps a slice. Defaults to items.
+}
+
+func (XML) ContentType() string {
+	return "application/xml"
+}
+
+func (c XML) Encode(w io.Writer, v any) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Slice {
+		return xml.NewEncoder(w).Encode(v)
+	}
+
+	root := c.Root
+	if root == "" {
+		root = "items"
+	}
+
+	enc := xml.NewEncoder(w)
+	start := xml.StartElement{Name: xml.Name{Local: root}}
+	if err := enc.EncodeToken(start); err != nil {
+		return err
+	}
+
+	for i := 0; i < rv.Len(); i++ {
+		if err := enc.Encode(rv.Index(i).Interface()); err != nil {
+			return err
+		}
+	}
+
+	if err := enc.EncodeToken(start.End()); err != nil {
+		return err
+	}
+
+	return enc.Flush()
+}
+
+func (c XML) Decode(r io.Reader, v any) error {
+	dec := xml.NewDecoder(r)
+	slice, ok := slicePtr(v)
+	if !ok {
+		return dec.Decode(v)
+	}
+
+	depth := 0
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+
+			return err
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			if depth == 0 {
+				depth++
+				continue
+			}
+
+			elem := reflect.New(slice.Type().Elem())
+			if err := dec.DecodeElement(elem.Interface(), &t); err != nil {
+				return err
+			}
+
+			slice.Set(reflect.Append(slice, elem.Elem()))
+		case xml.EndElement:
+			depth--
+		}
+	}
+}
+
+// NDJSON is a Codec for application/x-ndjson, where each element of a slice is a json value on its own line.
+type NDJSON struct {
+	JSON JSON // JSON configures the decoding of each element.
+}
+
+func (NDJSON) ContentType() string {
+	return "application/x-ndjson"
+}
+
+func (c NDJSON) Encode(w io.Writer, v any) error {
+	enc := json.NewEncoder(w)
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Slice {
+		return enc.Encode(v)
+	}
+
+	for i := 0; i < rv.Len(); i++ {
+		if err := enc.Encode(rv.Index(i).Interface()); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (c NDJSON) Decode(r io.Reader, v any) error {
+	dec := c.JSON.NewDecoder(r)
+	slice, ok := slicePtr(v)
+	if !ok {
+		return dec.Decode(v)
+	}
+
+	for dec.More() {
+		elem := reflect.New(slice.Type().Elem())
+		if err := dec.Decode(elem.Interface()); err != nil {
+			return err
+		}
+
+		slice.Set(reflect.Append(slice, elem.Elem()))
+	}
+
+	return nil
+}
+
+// slicePtr returns the addressable slice, if v is a pointer to a slice (but not to a byte slice).
+func slicePtr(v any) (reflect.Value, bool) {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() {
+		return reflect.Value{}, false
+	}
+
+	rv = rv.Elem()
+	if rv.Kind() != reflect.Slice || rv.Type().Elem().Kind() == reflect.Uint8 {
+		return reflect.Value{}, false
+	}
+
+	return rv, true
+}
@@ -0,0 +1,290 @@
+package http
+
+import (
+	"bytes"
+	"encoding/hex"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type address struct {
+	City string `json:"city"`
+}
+
+type person struct {
+	ID       string            `json:"id"`
+	Name     string            `json:"name,omitempty"`
+	Age      int               `json:"age"`
+	Score    float64           `json:"score"`
+	Admin    bool              `json:"admin"`
+	Tags     []string          `json:"tags"`
+	Avatar   []byte            `json:"avatar"`
+	Born     time.Time         `json:"born"`
+	Address  *address          `json:"address"`
+	Labels   map[string]string `json:"labels"`
+	Ignored  string            `json:"-"`
+	internal string
+}
+
+func TestCodecsRoundTrip(t *testing.T) {
+	born := time.Date(1990, 5, 17, 8, 30, 0, 123, time.UTC)
+	in := []person{
+		{ID: "1", Name: "Ann", Age: -42, Score: 1.5, Admin: true, Tags: []string{"a", "b"}, Avatar: []byte{1, 2}, Born: born, Address: &address{City: "Kiel"}, Labels: map[string]string{"k": "v"}},
+		{ID: "2", Age: 1 << 40, Born: born},
+	}
+
+	for _, c := range []Codec{JSON{}, NDJSON{}, CBOR{}, MessagePack{}} {
+		t.Run(c.ContentType(), func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := c.Encode(&buf, in); err != nil {
+				t.Fatal(err)
+			}
+
+			var out []person
+			if err := c.Decode(&buf, &out); err != nil {
+				t.Fatal(err)
+			}
+
+			for i := range out {
+				out[i].Born = out[i].Born.UTC()
+			}
+
+			if !reflect.DeepEqual(in, out) {
+				t.Fatalf("got %+v, want %+v", out, in)
+			}
+		})
+	}
+}
+
+func TestXMLRoundTrip(t *testing.T) {
+	type item struct {
+		ID string `xml:"id"`
+	}
+
+	var buf bytes.Buffer
+	if err := (XML{Root: "list"}).Encode(&buf, []item{{"1"}, {"2"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.HasPrefix(buf.String(), "<list><item>") {
+		t.Fatalf("expected a root element, got %s", buf.String())
+	}
+
+	var out []item
+	if err := (XML{}).Decode(&buf, &out); err != nil || len(out) != 2 || out[1].ID != "2" {
+		t.Fatal(out, err)
+	}
+}
+
+// TestCBORVectors uses examples from appendix A of RFC 8949.
+func TestCBORVectors(t *testing.T) {
+	tests := []struct {
+		hex  string
+		want any
+	}{
+		{"00", int64(0)},
+		{"17", int64(23)},
+		{"1818", int64(24)},
+		{"1903e8", int64(1000)},
+		{"1bffffffffffffffff", uint64(math.MaxUint64)},
+		{"20", int64(-1)},
+		{"3903e7", int64(-1000)},
+		{"f90000", 0.0},
+		{"f93c00", 1.0},
+		{"f97bff", 65504.0},
+		{"f90001", 5.960464477539063e-08},
+		{"fa47c35000", 100000.0},
+		{"fb3ff199999999999a", 1.1},
+		{"f4", false},
+		{"f5", true},
+		{"f6", nil},
+		{"f7", nil},
+		{"4401020304", []byte{1, 2, 3, 4}},
+		{"6449455446", "IETF"},
+		{"62c3bc", "ü"},
+		{"83010203", []any{int64(1), int64(2), int64(3)}},
+		{"8301820203820405", []any{int64(1), []any{int64(2), int64(3)}, []any{int64(4), int64(5)}}},
+		{"a201020304", map[any]any{int64(1): int64(2), int64(3): int64(4)}},
+		{"a26161016162820203", map[string]any{"a": int64(1), "b": []any{int64(2), int64(3)}}},
+		{"5f42010243030405ff", []byte{1, 2, 3, 4, 5}},
+		{"7f657374726561646d696e67ff", "streaming"},
+		{"9f018202039f0405ffff", []any{int64(1), []any{int64(2), int64(3)}, []any{int64(4), int64(5)}}},
+		{"bf61610161629f0203ffff", map[string]any{"a": int64(1), "b": []any{int64(2), int64(3)}}},
+		{"c074323031332d30332d32315432303a30343a30305a", time.Date(2013, 3, 21, 20, 4, 0, 0, time.UTC)},
+		{"c11a514b67b0", time.Unix(1363896240, 0)},
+		{"d74401020304", []byte{1, 2, 3, 4}},
+	}
+
+	for _, tt := range tests {
+		b, _ := hex.DecodeString(tt.hex)
+		var got any
+		if err := (CBOR{}).Decode(bytes.NewReader(b), &got); err != nil {
+			t.Errorf("%s: %v", tt.hex, err)
+			continue
+		}
+
+		if wt, ok := tt.want.(time.Time); ok {
+			if gt, ok := got.(time.Time); !ok || !gt.Equal(wt) {
+				t.Errorf("%s: got %v, want %v", tt.hex, got, wt)
+			}
+
+			continue
+		}
+
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %#v, want %#v", tt.hex, got, tt.want)
+		}
+	}
+}
+
+func TestCBOREncoding(t *testing.T) {
+	tests := []struct {
+		v    any
+		want string
+	}{
+		{0, "00"},
+		{24, "1818"},
+		{-1000, "3903e7"},
+		{uint64(math.MaxUint64), "1bffffffffffffffff"},
+		{1.1, "fb3ff199999999999a"},
+		{float32(100000), "fa47c35000"},
+		{"IETF", "6449455446"},
+		{[]byte{1, 2}, "420102"},
+		{[]int{1, 2, 3}, "83010203"},
+		{struct {
+			A int `cbor:"a"`
+		}{1}, "a1616101"},
+		{(*int)(nil), "f6"},
+	}
+
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		if err := (CBOR{}).Encode(&buf, tt.v); err != nil {
+			t.Fatal(err)
+		}
+
+		if got := hex.EncodeToString(buf.Bytes()); got != tt.want {
+			t.Errorf("%v: got %s, want %s", tt.v, got, tt.want)
+		}
+	}
+}
+
+func TestMessagePackEncoding(t *testing.T) {
+	tests := []struct {
+		v    any
+		want string
+	}{
+		{nil, "c0"},
+		{true, "c3"},
+		{127, "7f"},
+		{128, "cc80"},
+		{-1, "ff"},
+		{-33, "d0df"},
+		{-32769, "d2ffff7fff"},
+		{uint64(math.MaxUint64), "cfffffffffffffffff"},
+		{1.5, "cb3ff8000000000000"},
+		{"abc", "a3616263"},
+		{strings.Repeat("x", 32), "d920" + strings.Repeat("78", 32)},
+		{[]byte{1}, "c40101"},
+		{[]int{1, 2}, "920102"},
+		{map[string]int{"a": 1}, "81a16101"},
+		{time.Unix(1, 2), "c70cff000000020000000000000001"},
+	}
+
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		if err := (MessagePack{}).Encode(&buf, tt.v); err != nil {
+			t.Fatal(err)
+		}
+
+		if got := hex.EncodeToString(buf.Bytes()); got != tt.want {
+			t.Errorf("%v: got %s, want %s", tt.v, got, tt.want)
+		}
+	}
+}
+
+func TestMessagePackDecoding(t *testing.T) {
+	tests := []struct {
+		hex  string
+		want any
+	}{
+		{"d1ff00", int64(-256)},
+		{"d3ffffffffffffffff", int64(-1)},
+		{"cdffff", int64(math.MaxUint16)},
+		{"ca3fc00000", 1.5},
+		{"dc0002c0c3", []any{nil, true}},
+		{"de0001a16192c3c2", map[string]any{"a": []any{true, false}}},
+		{"d6ff00000001", time.Unix(1, 0)},
+		{"d7ff0000000800000001", time.Unix(1, 2)},
+	}
+
+	for _, tt := range tests {
+		b, _ := hex.DecodeString(tt.hex)
+		var got any
+		if err := (MessagePack{}).Decode(bytes.NewReader(b), &got); err != nil {
+			t.Errorf("%s: %v", tt.hex, err)
+			continue
+		}
+
+		if wt, ok := tt.want.(time.Time); ok {
+			if gt, ok := got.(time.Time); !ok || !gt.Equal(wt) {
+				t.Errorf("%s: got %v, want %v", tt.hex, got, wt)
+			}
+
+			continue
+		}
+
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %#v, want %#v", tt.hex, got, tt.want)
+		}
+	}
+}
+
+func TestBinaryDecodingErrors(t *testing.T) {
+	tests := []struct {
+		codec Codec
+		hex   string
+		into  any
+	}{
+		{CBOR{}, "5bffffffffffffffff", new([]byte)},    // a hostile length must not be allocated
+		{CBOR{}, "1a000100", new(int)},                 // truncated
+		{CBOR{}, "190100", new(int8)},                  // overflow
+		{CBOR{}, "c249010000000000000000", new(any)},   // 2^64
+		{CBOR{}, "ff", new(any)},                       // break outside of an indefinite item
+		{CBOR{}, strings.Repeat("81", 1000), new(any)}, // nesting
+		{MessagePack{}, "dbffffffff", new(string)},
+		{MessagePack{}, "c1", new(any)},
+		{MessagePack{}, "a161", new(int)},
+		{MessagePack{}, "d40101", new(any)}, // unknown extension
+	}
+
+	for _, tt := range tests {
+		b, _ := hex.DecodeString(tt.hex)
+		if err := tt.codec.Decode(bytes.NewReader(b), tt.into); err == nil {
+			t.Errorf("%s %s: expected an error", tt.codec.ContentType(), tt.hex)
+		}
+	}
+}
+
+func TestNegotiate(t *testing.T) {
+	for _, ct := range []string{"application/json; charset=utf-8", "application/cbor", "application/msgpack", "application/x-msgpack", "APPLICATION/XML"} {
+		if _, ok := Negotiate(ct); !ok {
+			t.Errorf("expected a registered codec for %s", ct)
+		}
+	}
+
+	if c, ok := Negotiate("application/cbor", JSON{}, CBOR{}); !ok || c.ContentType() != "application/cbor" {
+		t.Fatal(c, ok)
+	}
+
+	if _, ok := Negotiate("application/json", CBOR{}); ok {
+		t.Fatal("expected only offered codecs to be negotiated")
+	}
+
+	if got := Accept(CBOR{}, JSON{}); got != "application/cbor, application/json;q=0.9" {
+		t.Fatal(got)
+	}
+}
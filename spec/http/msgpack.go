@@ -0,0 +1,326 @@
+package http
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+	"time"
+)
+
+// MessagePack is a Codec for application/msgpack. Values are mapped like JSON does: structs become maps keyed by
+// the field name of the msgpack or the json tag, time.Time uses the timestamp extension and byte slices become
+// binary values.
+type MessagePack struct {
+	MediaType string // MediaType defaults to application/msgpack. Older services often use application/x-msgpack.
+}
+
+func (c MessagePack) ContentType() string {
+	if c.MediaType == "" {
+		return "application/msgpack"
+	}
+
+	return c.MediaType
+}
+
+func (MessagePack) Encode(w io.Writer, v any) error {
+	enc := &msgpackWriter{}
+	if err := encodeValue(enc, reflect.ValueOf(v), "msgpack"); err != nil {
+		return err
+	}
+
+	_, err := w.Write(enc.buf)
+	return err
+}
+
+func (MessagePack) Decode(r io.Reader, v any) error {
+	dec := msgpackReader{r: bufio.NewReader(r)}
+	decoded, err := dec.value()
+	if err != nil {
+		return err
+	}
+
+	return decodeInto(v, decoded, "msgpack")
+}
+
+// msgpackTimestamp is the extension type of timestamps.
+const msgpackTimestamp = -1
+
+type msgpackWriter struct {
+	buf []byte
+}
+
+// sized appends the code for the smallest of the 8, 16 or 32 bit length variants and the length.
+func (w *msgpackWriter) sized(n int, code8, code16, code32 byte) {
+	switch {
+	case code8 != 0 && n <= math.MaxUint8:
+		w.buf = append(w.buf, code8, byte(n))
+	case n <= math.MaxUint16:
+		w.buf = binary.BigEndian.AppendUint16(append(w.buf, code16), uint16(n))
+	default:
+		w.buf = binary.BigEndian.AppendUint32(append(w.buf, code32), uint32(n))
+	}
+}
+
+func (w *msgpackWriter) writeNil() {
+	w.buf = append(w.buf, 0xc0)
+}
+
+func (w *msgpackWriter) writeBool(b bool) {
+	if b {
+		w.buf = append(w.buf, 0xc3)
+	} else {
+		w.buf = append(w.buf, 0xc2)
+	}
+}
+
+func (w *msgpackWriter) writeInt(i int64) {
+	switch {
+	case i >= 0:
+		w.writeUint(uint64(i))
+	case i >= -32:
+		w.buf = append(w.buf, byte(i))
+	case i >= math.MinInt8:
+		w.buf = append(w.buf, 0xd0, byte(i))
+	case i >= math.MinInt16:
+		w.buf = binary.BigEndian.AppendUint16(append(w.buf, 0xd1), uint16(i))
+	case i >= math.MinInt32:
+		w.buf = binary.BigEndian.AppendUint32(append(w.buf, 0xd2), uint32(i))
+	default:
+		w.buf = binary.BigEndian.AppendUint64(append(w.buf, 0xd3), uint64(i))
+	}
+}
+
+func (w *msgpackWriter) writeUint(u uint64) {
+	switch {
+	case u <= math.MaxInt8:
+		w.buf = append(w.buf, byte(u))
+	case u <= math.MaxUint8:
+		w.buf = append(w.buf, 0xcc, byte(u))
+	case u <= math.MaxUint16:
+		w.buf = binary.BigEndian.AppendUint16(append(w.buf, 0xcd), uint16(u))
+	case u <= math.MaxUint32:
+		w.buf = binary.BigEndian.AppendUint32(append(w.buf, 0xce), uint32(u))
+	default:
+		w.buf = binary.BigEndian.AppendUint64(append(w.buf, 0xcf), u)
+	}
+}
+
+func (w *msgpackWriter) writeFloat(f float64, bits int) {
+	if bits == 32 {
+		w.buf = binary.BigEndian.AppendUint32(append(w.buf, 0xca), math.Float32bits(float32(f)))
+	} else {
+		w.buf = binary.BigEndian.AppendUint64(append(w.buf, 0xcb), math.Float64bits(f))
+	}
+}
+
+func (w *msgpackWriter) writeString(s string) {
+	if len(s) < 32 {
+		w.buf = append(w.buf, 0xa0|byte(len(s)))
+	} else {
+		w.sized(len(s), 0xd9, 0xda, 0xdb)
+	}
+
+	w.buf = append(w.buf, s...)
+}
+
+func (w *msgpackWriter) writeBytes(b []byte) {
+	w.sized(len(b), 0xc4, 0xc5, 0xc6)
+	w.buf = append(w.buf, b...)
+}
+
+// writeTime uses the 96 bit timestamp, which covers every time.Time.
+func (w *msgpackWriter) writeTime(t time.Time) {
+	w.buf = append(w.buf, 0xc7, 12, 0xff) // the type -1 as int8
+	w.buf = binary.BigEndian.AppendUint32(w.buf, uint32(t.Nanosecond()))
+	w.buf = binary.BigEndian.AppendUint64(w.buf, uint64(t.Unix()))
+}
+
+func (w *msgpackWriter) writeArrayHeader(n int) {
+	if n < 16 {
+		w.buf = append(w.buf, 0x90|byte(n))
+	} else {
+		w.sized(n, 0, 0xdc, 0xdd)
+	}
+}
+
+func (w *msgpackWriter) writeMapHeader(n int) {
+	if n < 16 {
+		w.buf = append(w.buf, 0x80|byte(n))
+	} else {
+		w.sized(n, 0, 0xde, 0xdf)
+	}
+}
+
+type msgpackReader struct {
+	r     *bufio.Reader
+	depth int
+}
+
+// uint reads a big endian unsigned integer of the given size in bytes.
+func (d *msgpackReader) uint(size int) (uint64, error) {
+	var buf [8]byte
+	if _, err := io.ReadFull(d.r, buf[8-size:]); err != nil {
+		return 0, unexpectedEOF(err)
+	}
+
+	return binary.BigEndian.Uint64(buf[:]), nil
+}
+
+func (d *msgpackReader) value() (any, error) {
+	d.depth++
+	defer func() { d.depth-- }()
+	if d.depth > maxDepth {
+		return nil, errors.New("msgpack: nesting exceeds the limit")
+	}
+
+	b, err := d.r.ReadByte()
+	if err != nil {
+		return nil, unexpectedEOF(err)
+	}
+
+	switch {
+	case b <= 0x7f:
+		return int64(b), nil
+	case b <= 0x8f:
+		return d.pairs(uint64(b & 0x0f))
+	case b <= 0x9f:
+		return d.array(uint64(b & 0x0f))
+	case b <= 0xbf:
+		s, err := readBytes(d.r, uint64(b&0x1f))
+		return string(s), err
+	case b >= 0xe0:
+		return int64(int8(b)), nil
+	}
+
+	switch b {
+	case 0xc0:
+		return nil, nil
+	case 0xc2:
+		return false, nil
+	case 0xc3:
+		return true, nil
+	case 0xc4, 0xc5, 0xc6:
+		n, err := d.uint(1 << (b - 0xc4))
+		if err != nil {
+			return nil, err
+		}
+
+		return readBytes(d.r, n)
+	case 0xc7, 0xc8, 0xc9:
+		n, err := d.uint(1 << (b - 0xc7))
+		if err != nil {
+			return nil, err
+		}
+
+		return d.ext(n)
+	case 0xca:
+		n, err := d.uint(4)
+		return float64(math.Float32frombits(uint32(n))), err
+	case 0xcb:
+		n, err := d.uint(8)
+		return math.Float64frombits(n), err
+	case 0xcc, 0xcd, 0xce, 0xcf:
+		return d.uint(1 << (b - 0xcc))
+	case 0xd0, 0xd1, 0xd2, 0xd3:
+		size := 1 << (b - 0xd0)
+		n, err := d.uint(size)
+		if err != nil {
+			return nil, err
+		}
+
+		shift := 64 - 8*size
+		return int64(n<<shift) >> shift, nil // sign extension
+	case 0xd4, 0xd5, 0xd6, 0xd7, 0xd8:
+		return d.ext(1 << (b - 0xd4))
+	case 0xd9, 0xda, 0xdb:
+		n, err := d.uint(1 << (b - 0xd9))
+		if err != nil {
+			return nil, err
+		}
+
+		s, err := readBytes(d.r, n)
+		return string(s), err
+	case 0xdc, 0xdd:
+		n, err := d.uint(2 << (b - 0xdc))
+		if err != nil {
+			return nil, err
+		}
+
+		return d.array(n)
+	case 0xde, 0xdf:
+		n, err := d.uint(2 << (b - 0xde))
+		if err != nil {
+			return nil, err
+		}
+
+		return d.pairs(n)
+	default:
+		return nil, fmt.Errorf("msgpack: invalid code 0x%x", b)
+	}
+}
+
+func (d *msgpackReader) array(n uint64) (any, error) {
+	arr := make([]any, 0, capacity(n))
+	for i := uint64(0); i < n; i++ {
+		v, err := d.value()
+		if err != nil {
+			return nil, err
+		}
+
+		arr = append(arr, v)
+	}
+
+	return arr, nil
+}
+
+func (d *msgpackReader) pairs(n uint64) (any, error) {
+	pairs := make([]pair, 0, capacity(n))
+	for i := uint64(0); i < n; i++ {
+		k, err := d.value()
+		if err != nil {
+			return nil, err
+		}
+
+		v, err := d.value()
+		if err != nil {
+			return nil, err
+		}
+
+		pairs = append(pairs, pair{key: k, value: v})
+	}
+
+	return pairs, nil
+}
+
+// ext reads an extension with n bytes of data. Only timestamps are understood.
+func (d *msgpackReader) ext(n uint64) (any, error) {
+	typ, err := d.r.ReadByte()
+	if err != nil {
+		return nil, unexpectedEOF(err)
+	}
+
+	data, err := readBytes(d.r, n)
+	if err != nil {
+		return nil, err
+	}
+
+	if int8(typ) != msgpackTimestamp {
+		return nil, fmt.Errorf("msgpack: unsupported extension type %d", int8(typ))
+	}
+
+	switch len(data) {
+	case 4:
+		return time.Unix(int64(binary.BigEndian.Uint32(data)), 0), nil
+	case 8:
+		v := binary.BigEndian.Uint64(data)
+		return time.Unix(int64(v&(1<<34-1)), int64(v>>34)), nil
+	case 12:
+		return time.Unix(int64(binary.BigEndian.Uint64(data[4:])), int64(binary.BigEndian.Uint32(data))), nil
+	default:
+		return nil, fmt.Errorf("msgpack: invalid timestamp of %d bytes", len(data))
+	}
+}
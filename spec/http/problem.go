@@ -0,0 +1,231 @@
+package http
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/gotrino/fusion/spec/app"
+	"io"
+	"mime"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// ProblemContentType is the media type of RFC 7807 problem details.
+const ProblemContentType = "application/problem+json"
+
+// maxProblemSize limits how much of an error body is read.
+const maxProblemSize = 1 << 20
+
+// Problem contains the RFC 7807 problem details of an error response. The field errors are taken from the common
+// extension members invalid-params, errors or violations.
+type Problem struct {
+	Type     string
+	Title    string
+	Detail   string
+	Instance string
+	Status   int
+	Fields   []app.FieldError
+}
+
+// ProblemDecoder converts an error body, which is not of type application/problem+json, into a Problem.
+type ProblemDecoder func(contentType string, body []byte) (Problem, bool)
+
+// FallbackProblemDecoder is used for error bodies of other types. The default understands json objects like
+// {"message": "...", "errors": {"title": ["must not be empty"]}}. May be replaced at startup or set to nil.
+var FallbackProblemDecoder ProblemDecoder = decodeLooseProblem
+
+// ResponseError reads the body of the error response and returns an HttpError with the decoded Problem, if any.
+// The Problem of a 400 or 422, or of a 409 with field errors, is classified as app.ValidationError, which contains
+// the field errors.
+func ResponseError(res *http.Response) HttpError {
+	e := HttpError{Status: res.StatusCode}
+	buf, err := io.ReadAll(io.LimitReader(res.Body, maxProblemSize))
+	if err != nil || len(buf) == 0 {
+		return e
+	}
+
+	contentType := res.Header.Get("Content-Type")
+	var problem Problem
+	ok := false
+	if mediaType, _, _ := mime.ParseMediaType(contentType); mediaType == ProblemContentType {
+		problem, ok = decodeProblem(buf)
+	} else if FallbackProblemDecoder != nil {
+		problem, ok = FallbackProblemDecoder(contentType, buf)
+	}
+
+	if !ok {
+		return e
+	}
+
+	if problem.Status == 0 {
+		problem.Status = res.StatusCode
+	}
+
+	e.Problem = &problem
+	if rejectsInput(res.StatusCode, problem) {
+		e.Cause = app.ValidationError{Message: problem.message(), Fields: problem.Fields}
+	}
+
+	return e
+}
+
+// rejectsInput reports whether the Problem describes invalid input: 400 and 422 always do, 409 only with field
+// errors, like a duplicate email. Field errors of other statuses, like a 500 listing internal errors, do not.
+func rejectsInput(status int, problem Problem) bool {
+	switch status {
+	case http.StatusBadRequest, http.StatusUnprocessableEntity:
+		return true
+	case http.StatusConflict:
+		return len(problem.Fields) > 0
+	default:
+		return false
+	}
+}
+
+func (p Problem) message() string {
+	switch {
+	case p.Detail != "":
+		return p.Detail
+	case p.Title != "":
+		return p.Title
+	case len(p.Fields) > 0:
+		return p.Fields[0].Field + ": " + p.Fields[0].Message
+	default:
+		return http.StatusText(p.Status)
+	}
+}
+
+func decodeProblem(buf []byte) (Problem, bool) {
+	var doc map[string]json.RawMessage
+	if err := json.Unmarshal(buf, &doc); err != nil {
+		return Problem{}, false
+	}
+
+	var p Problem
+	str(doc["type"], &p.Type)
+	str(doc["title"], &p.Title)
+	str(doc["detail"], &p.Detail)
+	str(doc["instance"], &p.Instance)
+	_ = json.Unmarshal(doc["status"], &p.Status)
+	p.Fields = fieldErrors(doc)
+
+	return p, true
+}
+
+// decodeLooseProblem understands the widespread json shapes using message or error and errors.
+func decodeLooseProblem(contentType string, buf []byte) (Problem, bool) {
+	if mediaType, _, _ := mime.ParseMediaType(contentType); mediaType != "application/json" {
+		return Problem{}, false
+	}
+
+	var doc map[string]json.RawMessage
+	if err := json.Unmarshal(buf, &doc); err != nil {
+		return Problem{}, false
+	}
+
+	var p Problem
+	str(doc["title"], &p.Title)
+	str(doc["detail"], &p.Detail)
+	if p.Detail == "" {
+		str(doc["message"], &p.Detail)
+	}
+
+	if p.Detail == "" {
+		str(doc["error"], &p.Detail)
+	}
+
+	p.Fields = fieldErrors(doc)
+	if p.Title == "" && p.Detail == "" && len(p.Fields) == 0 {
+		return Problem{}, false
+	}
+
+	return p, true
+}
+
+// fieldErrors supports arrays of objects naming the field by name, field, pointer or path and the message by
+// reason, message or detail as well as objects mapping the field names to a message or a list of messages.
+func fieldErrors(doc map[string]json.RawMessage) []app.FieldError {
+	for _, key := range []string{"invalid-params", "errors", "violations"} {
+		raw, ok := doc[key]
+		if !ok {
+			continue
+		}
+
+		var list []map[string]json.RawMessage
+		if err := json.Unmarshal(raw, &list); err == nil {
+			var res []app.FieldError
+			for _, entry := range list {
+				var fe app.FieldError
+				for _, k := range []string{"name", "field", "pointer", "path", "propertyPath"} {
+					if str(entry[k], &fe.Field) {
+						break
+					}
+				}
+
+				for _, k := range []string{"reason", "message", "detail"} {
+					if str(entry[k], &fe.Message) {
+						break
+					}
+				}
+
+				fe.Field = strings.ReplaceAll(strings.TrimPrefix(fe.Field, "/"), "/", ".")
+				res = append(res, fe)
+			}
+
+			return res
+		}
+
+		var byField map[string]json.RawMessage
+		if err := json.Unmarshal(raw, &byField); err == nil {
+			names := make([]string, 0, len(byField))
+			for name := range byField {
+				names = append(names, name)
+			}
+
+			sort.Strings(names)
+
+			var res []app.FieldError
+			for _, name := range names {
+				var msgs []string
+				var msg string
+				if str(byField[name], &msg) {
+					msgs = []string{msg}
+				} else {
+					_ = json.Unmarshal(byField[name], &msgs)
+				}
+
+				for _, msg := range msgs {
+					res = append(res, app.FieldError{Field: name, Message: msg})
+				}
+			}
+
+			return res
+		}
+	}
+
+	return nil
+}
+
+// str decodes a json string and reports whether it was a non-empty string.
+func str(raw json.RawMessage, dst *string) bool {
+	if len(raw) == 0 {
+		return false
+	}
+
+	var s string
+	if err := json.Unmarshal(raw, &s); err != nil || s == "" {
+		return false
+	}
+
+	*dst = s
+	return true
+}
+
+func (p Problem) String() string {
+	if p.Detail != "" && p.Title != "" {
+		return fmt.Sprintf("%s: %s", p.Title, p.Detail)
+	}
+
+	return p.message()
+}
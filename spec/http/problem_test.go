@@ -0,0 +1,123 @@
+package http
+
+import (
+	"errors"
+	"fmt"
+	"github.com/gotrino/fusion/spec/app"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func response(status int, contentType string, body string) *http.Response {
+	return &http.Response{
+		StatusCode: status,
+		Header:     http.Header{"Content-Type": []string{contentType}},
+		Body:       io.NopCloser(strings.NewReader(body)),
+	}
+}
+
+func TestResponseError(t *testing.T) {
+	looseFields := []app.FieldError{
+		{Field: "isbn", Message: "invalid"},
+		{Field: "title", Message: "required"},
+		{Field: "title", Message: "too short"},
+	}
+
+	tests := []struct {
+		name        string
+		resp        *http.Response
+		problem     *Problem
+		validation  bool
+		fieldErrors []app.FieldError
+	}{
+		{
+			name: "problem details",
+			resp: response(422, ProblemContentType, `{"type":"about:blank","title":"Invalid","detail":"check the input","invalid-params":[{"name":"title","reason":"required"}]}`),
+			problem: &Problem{Type: "about:blank", Title: "Invalid", Detail: "check the input", Status: 422,
+				Fields: []app.FieldError{{Field: "title", Message: "required"}}},
+			validation:  true,
+			fieldErrors: []app.FieldError{{Field: "title", Message: "required"}},
+		},
+		{
+			name:        "json pointers",
+			resp:        response(400, ProblemContentType, `{"status":400,"violations":[{"pointer":"/author/name","detail":"too long"}]}`),
+			problem:     &Problem{Status: 400, Fields: []app.FieldError{{Field: "author.name", Message: "too long"}}},
+			validation:  true,
+			fieldErrors: []app.FieldError{{Field: "author.name", Message: "too long"}},
+		},
+		{
+			name:        "loose json",
+			resp:        response(400, "application/json; charset=utf-8", `{"message":"invalid","errors":{"title":["required","too short"],"isbn":"invalid"}}`),
+			problem:     &Problem{Detail: "invalid", Status: 400, Fields: looseFields},
+			validation:  true,
+			fieldErrors: looseFields,
+		},
+		{
+			name:    "server error",
+			resp:    response(500, "application/json", `{"error":"database down"}`),
+			problem: &Problem{Detail: "database down", Status: 500},
+		},
+		{
+			name:        "conflicting fields",
+			resp:        response(409, ProblemContentType, `{"title":"Conflict","invalid-params":[{"name":"email","reason":"taken"}]}`),
+			problem:     &Problem{Title: "Conflict", Status: 409, Fields: []app.FieldError{{Field: "email", Message: "taken"}}},
+			validation:  true,
+			fieldErrors: []app.FieldError{{Field: "email", Message: "taken"}},
+		},
+		{
+			name:    "conflict",
+			resp:    response(409, ProblemContentType, `{"title":"outdated version"}`),
+			problem: &Problem{Title: "outdated version", Status: 409},
+		},
+		{
+			name:    "server error with errors",
+			resp:    response(500, "application/json", `{"message":"failed","errors":{"db":"connection refused"}}`),
+			problem: &Problem{Detail: "failed", Status: 500, Fields: []app.FieldError{{Field: "db", Message: "connection refused"}}},
+		},
+		{
+			name:    "forbidden with errors",
+			resp:    response(403, ProblemContentType, `{"invalid-params":[{"name":"owner","reason":"not yours"}]}`),
+			problem: &Problem{Status: 403, Fields: []app.FieldError{{Field: "owner", Message: "not yours"}}},
+		},
+		{name: "plain text", resp: response(502, "text/html", "<h1>Bad Gateway</h1>")},
+		{name: "unrelated json", resp: response(404, "application/json", `{"id":"1"}`)},
+		{name: "invalid problem", resp: response(400, ProblemContentType, `{`)},
+		{name: "empty body", resp: response(503, "", "")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ResponseError(tt.resp)
+			if err.Status != tt.resp.StatusCode {
+				t.Errorf("got status %d", err.Status)
+			}
+
+			if !reflect.DeepEqual(err.Problem, tt.problem) {
+				t.Errorf("got problem %+v, want %+v", err.Problem, tt.problem)
+			}
+
+			if failed, _ := app.ValidationFailed(err); failed != tt.validation {
+				t.Errorf("expected validation failure %v", tt.validation)
+			}
+
+			if got := app.FieldErrors(fmt.Errorf("save: %w", err)); !reflect.DeepEqual(got, tt.fieldErrors) {
+				t.Errorf("got field errors %v, want %v", got, tt.fieldErrors)
+			}
+		})
+	}
+}
+
+func TestFieldErrorsOfPointer(t *testing.T) {
+	fields := []app.FieldError{{Field: "title", Message: "required"}}
+	err := fmt.Errorf("save: %w", &app.ValidationError{Message: "invalid", Fields: fields})
+	if got := app.FieldErrors(err); !reflect.DeepEqual(got, fields) {
+		t.Fatalf("got %v", got)
+	}
+
+	if app.FieldErrors(errors.New("other")) != nil {
+		t.Fatal("expected no field errors")
+	}
+}
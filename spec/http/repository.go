@@ -6,11 +6,9 @@ import (
 	"fmt"
 	"github.com/gotrino/fusion/spec/app"
 	"io"
-	"log"
 	"net/http"
 	"net/url"
 	"path"
-	"strings"
 )
 
 const (
@@ -28,19 +26,35 @@ const (
 	StatusNoContent = http.StatusNoContent
 )
 
+// Repository delegates to the given callbacks. The context-taking callbacks are preferred over the plain ones.
 type Repository[T any] struct {
 	OnSave   func(t T) error
 	OnLoad   func(id string) (T, error)
 	OnList   func() ([]T, error)
 	OnDelete func(id string) error
+
+	OnSaveContext   func(ctx context.Context, t T) error
+	OnLoadContext   func(ctx context.Context, id string) (T, error)
+	OnListContext   func(ctx context.Context) ([]T, error)
+	OnDeleteContext func(ctx context.Context, id string) error
 }
 
 func (r Repository[T]) List() ([]any, error) {
-	if r.OnList == nil {
-		return nil, fmt.Errorf("OnSave is not implemented")
+	return r.ListContext(context.Background())
+}
+
+func (r Repository[T]) ListContext(ctx context.Context) ([]any, error) {
+	var res []T
+	var err error
+	switch {
+	case r.OnListContext != nil:
+		res, err = r.OnListContext(ctx)
+	case r.OnList != nil:
+		res, err = r.OnList()
+	default:
+		return nil, fmt.Errorf("OnList is not implemented")
 	}
 
-	res, err := r.OnList()
 	if err != nil {
 		return nil, err
 	}
@@ -54,27 +68,48 @@ func (r Repository[T]) List() ([]any, error) {
 }
 
 func (r Repository[T]) Delete(id string) error {
-	if r.OnDelete == nil {
+	return r.DeleteContext(context.Background(), id)
+}
+
+func (r Repository[T]) DeleteContext(ctx context.Context, id string) error {
+	switch {
+	case r.OnDeleteContext != nil:
+		return r.OnDeleteContext(ctx, id)
+	case r.OnDelete != nil:
+		return r.OnDelete(id)
+	default:
 		return fmt.Errorf("OnDelete is not implemented")
 	}
-
-	return r.OnDelete(id)
 }
 
 func (r Repository[T]) Save(entity any) error {
-	if r.OnSave == nil {
+	return r.SaveContext(context.Background(), entity)
+}
+
+func (r Repository[T]) SaveContext(ctx context.Context, entity any) error {
+	switch {
+	case r.OnSaveContext != nil:
+		return r.OnSaveContext(ctx, entity.(T))
+	case r.OnSave != nil:
+		return r.OnSave(entity.(T))
+	default:
 		return fmt.Errorf("OnSave is not implemented")
 	}
-
-	return r.OnSave(entity.(T))
 }
 
 func (r Repository[T]) Load(id string) (any, error) {
-	if r.OnLoad == nil {
+	return r.LoadContext(context.Background(), id)
+}
+
+func (r Repository[T]) LoadContext(ctx context.Context, id string) (any, error) {
+	switch {
+	case r.OnLoadContext != nil:
+		return r.OnLoadContext(ctx, id)
+	case r.OnLoad != nil:
+		return r.OnLoad(id)
+	default:
 		return nil, fmt.Errorf("OnLoad is not implemented")
 	}
-
-	return r.OnLoad(id)
 }
 
 func (Repository[T]) GetDefault() any {
@@ -99,49 +134,109 @@ func NewRequest(ctx context.Context, method string, url *url.URL, body io.Reader
 }
 
 func URL(ctx context.Context, paths ...string) *url.URL {
-	a := app.FromContext[app.Application](ctx)
-	p := path.Join(paths...)
-	if strings.HasPrefix(p, "/") {
-		p = p[1:]
-	}
+	return URLOn(ctx, "", paths...)
+}
 
-	base, err := url.Parse(fmt.Sprintf("%s://%s:%d/%s", a.Connection.Scheme, a.Connection.Host, a.Connection.Port, p))
+// URLOn is like URL but uses the named Connection of the application. It panics for an unknown connection, thus
+// declarations should check the name first, see app.Application.ConnectionOf.
+func URLOn(ctx context.Context, connection string, paths ...string) *url.URL {
+	c, err := app.FromContext[app.Application](ctx).ConnectionOf(connection)
 	if err != nil {
-		panic(fmt.Errorf("invalid url: %w", err))
+		panic(err)
 	}
 
-	return base
+	return BaseURL(c, path.Join(paths...))
 }
 
-func Client(ctx context.Context) *http.Client {
-	return http.DefaultClient
+// Client returns the client of the default Connection, see ClientOn.
+func Client(ctx context.Context) (*http.Client, error) {
+	return ClientOn(ctx, "")
 }
 
 type Params struct {
 	ContentType string
+	Accept      string // Accept is sent as Accept header, if not empty. See also Accept and Encode.
 	Body        []byte
+	// Reader is streamed as body instead of Body, like a file. A streamed body is not retried.
+	Reader        io.Reader
+	ContentLength int64 // ContentLength of the Reader, if known. Zero means unknown.
+	// Header contains additional headers, like Content-Disposition.
+	Header     http.Header
+	Progress   app.Progress    // Progress is notified while the Reader is sent, if not nil.
+	Resilience *app.Resilience // Resilience overrides the policy of the applications Connection, if not nil.
+	Connection string          // Connection is the name of the Connection, whose policy and authentication are used.
 }
 
+// Do performs the request using the Connection of the params and returns the body, if the status is acceptable.
+// A request rejected with 401 is replayed once, after the credentials have been renewed, see ReauthenticatorOn.
 func Do(ctx context.Context, method string, url *url.URL, params Params, acceptableStatus ...int) ([]byte, error) {
+	res, err := Stream(ctx, method, url, params, acceptableStatus...)
+	if err != nil {
+		return nil, err
+	}
+
+	defer res.Body.Close()
+
+	buf, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	return buf, nil
+}
+
+// Stream is like Do but returns the response with the unread body, which must be closed by the caller.
+// Use ReadFile to download a file.
+func Stream(ctx context.Context, method string, url *url.URL, params Params, acceptableStatus ...int) (*Response, error) {
 	var body io.Reader
-	if params.Body != nil {
+	switch {
+	case params.Body != nil:
 		body = bytes.NewReader(params.Body)
+	case params.Reader != nil:
+		total := params.ContentLength
+		if total <= 0 {
+			total = -1
+		}
+
+		body = WithProgress(params.Reader, total, params.Progress)
 	}
+
 	req := NewRequest(ctx, method, url, body)
+	if params.Reader != nil && params.ContentLength > 0 {
+		req.ContentLength = params.ContentLength
+	}
+
+	for k, v := range params.Header {
+		req.Header[k] = v
+	}
+
 	if params.ContentType != "" {
 		req.Header.Set("Content-Type", params.ContentType)
 	}
 
-	req = Authorizer(ctx)(req)
+	if params.Accept != "" {
+		req.Header.Set("Accept", params.Accept)
+	}
 
-	res, err := Client(ctx).Do(req)
+	c, err := app.FromContext[app.Application](ctx).ConnectionOf(params.Connection)
 	if err != nil {
 		return nil, err
 	}
 
-	defer res.Body.Close()
+	policy := c.Resilience
+	if params.Resilience != nil {
+		policy = *params.Resilience
+	}
 
-	log.Printf("%+v", res)
+	client, err := ClientOn(ctx, params.Connection)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := SendAuthorized(client, req, policy, AuthorizerOn(ctx, params.Connection), ReauthenticatorOn(ctx, params.Connection))
+	if err != nil {
+		return nil, err
+	}
 
 	statusFound := false
 	for _, status := range acceptableStatus {
@@ -152,37 +247,36 @@ func Do(ctx context.Context, method string, url *url.URL, params Params, accepta
 	}
 
 	if !statusFound {
-		return nil, HttpError{Status: res.StatusCode}
-	}
-
-	buf, err := io.ReadAll(res.Body)
-	if err != nil {
-		return nil, err
+		defer res.Body.Close()
+		return nil, ResponseError(res)
 	}
 
-	return buf, nil
+	return res, nil
 }
 
 func Authorizer(ctx context.Context) func(request *http.Request) *http.Request {
+	return AuthorizerOn(ctx, "")
+}
+
+// AuthorizerOn is like Authorizer but uses the Authentication of the named Connection, see RegisterAuthorizer.
+func AuthorizerOn(ctx context.Context, connection string) func(request *http.Request) *http.Request {
 	return func(request *http.Request) *http.Request {
 		myApp := app.FromContext[app.Application](ctx)
-		switch t := myApp.Authentication.(type) {
-		case app.HardcodedBearer:
-			request.Header.Set("Authorization", "Bearer "+t.Token)
-		default:
-			panic(fmt.Errorf("unsupported authorization: %T", t))
-		}
-
-		return request
+		return authorize(ctx, connection, myApp.AuthenticationOf(connection), request)
 	}
 }
 
 type HttpError struct {
-	Status int
-	Cause  error
+	Status  int
+	Cause   error
+	Problem *Problem // Problem contains the details reported by the server, if any.
 }
 
 func (e HttpError) Error() string {
+	if e.Problem != nil {
+		return fmt.Sprintf("http-error: %d: %s", e.Status, e.Problem)
+	}
+
 	return fmt.Sprintf("http-error: %d", e.Status)
 }
 
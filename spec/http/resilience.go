@@ -0,0 +1,266 @@
+package http
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/gotrino/fusion/spec/app"
+	"github.com/gotrino/fusion/spec/observe"
+	mrand "math/rand"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is the cause of a HttpError if a request has been rejected without contacting the server, because
+// the circuit of the Connection is open.
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+var breakers = map[string]*breaker{}
+var breakersLock sync.Mutex
+
+// Send executes the request using the given client and retries it according to the policy. Network errors and the
+// statuses 429, 502, 503 and 504 are retried, respecting a Retry-After header. A PUT or POST request gets an
+// Idempotency-Key header, so that the server can detect replays. Each Connection (scheme and host) has its own
+// circuit breaker per policy. A 429 and a request canceled by the caller neither count as failure of the breaker
+// nor are they retried in the latter case.
+func Send(client *http.Client, req *http.Request, policy app.Resilience) (*http.Response, error) {
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	if policy.MaxRetries > 0 && (req.Method == http.MethodPut || req.Method == http.MethodPost) && req.Header.Get("Idempotency-Key") == "" {
+		req.Header.Set("Idempotency-Key", newIdempotencyKey())
+	}
+
+	cb := circuit(req, policy)
+	for attempt := 0; ; attempt++ {
+		if !cb.allow() {
+			return nil, HttpError{Status: http.StatusServiceUnavailable, Cause: ErrCircuitOpen}
+		}
+
+		observed, end := observe.StartRequest(req)
+		res, err := client.Do(observed)
+		end(res, err)
+		if req.Context().Err() != nil {
+			cb.release() // the caller has given up, which says nothing about the server
+			return res, err
+		}
+
+		if !retryable(res, err) {
+			cb.done(true)
+			return res, err
+		}
+
+		if res != nil && res.StatusCode == http.StatusTooManyRequests {
+			cb.release() // the server is alive, but throttles us
+		} else {
+			cb.done(false)
+		}
+
+		if attempt >= policy.MaxRetries || !replayable(req) {
+			return res, err
+		}
+
+		delay := backoff(policy, attempt)
+		if res != nil {
+			if after, ok := retryAfter(res); ok {
+				delay = after
+				if limit := maxDelay(policy); delay > limit {
+					delay = limit
+				}
+			}
+
+			res.Body.Close()
+		}
+
+		if req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+
+			req.Body = body
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, req.Context().Err()
+		case <-timer.C:
+		}
+	}
+}
+
+func retryable(res *http.Response, err error) bool {
+	if err != nil {
+		return true
+	}
+
+	switch res.StatusCode {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	default:
+		return false
+	}
+}
+
+// replayable checks if the verb is idempotent (or has been made so) and if the body can be sent again.
+func replayable(req *http.Request) bool {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodDelete:
+	case http.MethodPut, http.MethodPost:
+		if req.Header.Get("Idempotency-Key") == "" {
+			return false
+		}
+	default:
+		return false
+	}
+
+	return req.Body == nil || req.Body == http.NoBody || req.GetBody != nil
+}
+
+func backoff(policy app.Resilience, attempt int) time.Duration {
+	if policy.BaseDelay <= 0 {
+		return 0
+	}
+
+	limit := maxDelay(policy)
+	d := policy.BaseDelay << uint(attempt)
+	if d <= 0 || d > limit {
+		d = limit
+	}
+
+	return time.Duration(mrand.Int63n(int64(d) + 1))
+}
+
+func maxDelay(policy app.Resilience) time.Duration {
+	if policy.MaxDelay <= 0 {
+		return 30 * time.Second
+	}
+
+	return policy.MaxDelay
+}
+
+// retryAfter parses the Retry-After header which is either given in seconds or as a http date.
+func retryAfter(res *http.Response) (time.Duration, bool) {
+	v := res.Header.Get("Retry-After")
+	if v == "" {
+		return 0, false
+	}
+
+	if secs, err := strconv.Atoi(v); err == nil && secs >= 0 {
+		return time.Duration(secs) * time.Second, true
+	}
+
+	if t, err := http.ParseTime(v); err == nil {
+		d := time.Until(t)
+		if d < 0 {
+			d = 0
+		}
+
+		return d, true
+	}
+
+	return 0, false
+}
+
+func newIdempotencyKey() string {
+	var buf [16]byte
+	if _, err := rand.Read(buf[:]); err != nil {
+		panic(err)
+	}
+
+	return hex.EncodeToString(buf[:])
+}
+
+// breaker is a simple consecutive failure circuit breaker. After the cooldown a single trial request is let through,
+// which either closes or reopens the circuit.
+type breaker struct {
+	lock      sync.Mutex
+	threshold int
+	cooldown  time.Duration
+	failures  int
+	openUntil time.Time
+	trial     bool
+}
+
+func circuit(req *http.Request, policy app.Resilience) *breaker {
+	if policy.BreakerThreshold <= 0 {
+		return nil
+	}
+
+	cooldown := policy.BreakerCooldown
+	if cooldown <= 0 {
+		cooldown = 30 * time.Second
+	}
+
+	// callers with different policies must not reconfigure each others breaker
+	key := fmt.Sprintf("%s://%s#%d#%s", req.URL.Scheme, req.URL.Host, policy.BreakerThreshold, cooldown)
+
+	breakersLock.Lock()
+	defer breakersLock.Unlock()
+
+	b, ok := breakers[key]
+	if !ok {
+		b = &breaker{threshold: policy.BreakerThreshold, cooldown: cooldown}
+		breakers[key] = b
+	}
+
+	return b
+}
+
+func (b *breaker) allow() bool {
+	if b == nil {
+		return true
+	}
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if b.failures < b.threshold {
+		return true
+	}
+
+	if time.Now().Before(b.openUntil) || b.trial {
+		return false
+	}
+
+	b.trial = true
+	return true
+}
+
+// release ends a trial without judging the server.
+func (b *breaker) release() {
+	if b == nil {
+		return
+	}
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.trial = false
+}
+
+func (b *breaker) done(success bool) {
+	if b == nil {
+		return
+	}
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.trial = false
+	if success {
+		b.failures = 0
+		return
+	}
+
+	b.failures++
+	if b.failures >= b.threshold {
+		b.openUntil = time.Now().Add(b.cooldown)
+	}
+}
@@ -0,0 +1,217 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"github.com/gotrino/fusion/spec/app"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// statusServer responds with the given statuses in order and repeats the last one.
+func statusServer(statuses ...int) (*httptest.Server, *int32) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := int(atomic.AddInt32(&calls, 1)) - 1
+		if n >= len(statuses) {
+			n = len(statuses) - 1
+		}
+
+		w.Header().Set("Retry-After", "0")
+		w.WriteHeader(statuses[n])
+	}))
+
+	return srv, &calls
+}
+
+func send(t *testing.T, ctx context.Context, method, url string, policy app.Resilience) (int, error) {
+	t.Helper()
+	req, err := http.NewRequestWithContext(ctx, method, url, strings.NewReader("body"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := Send(nil, req, policy)
+	if err != nil {
+		return 0, err
+	}
+
+	res.Body.Close()
+	return res.StatusCode, nil
+}
+
+func TestSendRetries(t *testing.T) {
+	tests := []struct {
+		name     string
+		method   string
+		statuses []int
+		retries  int
+		want     int
+		calls    int32
+	}{
+		{"success", "GET", []int{200}, 3, 200, 1},
+		{"retry 503", "GET", []int{503, 503, 200}, 3, 200, 3},
+		{"retry 429", "GET", []int{429, 200}, 3, 200, 2},
+		{"retries exhausted", "GET", []int{502}, 2, 502, 3},
+		{"no retry for 500", "GET", []int{500, 200}, 3, 500, 1},
+		{"no retry without policy", "GET", []int{503, 200}, 0, 503, 1},
+		{"put is made idempotent", "PUT", []int{504, 200}, 1, 200, 2},
+		{"patch is never retried", "PATCH", []int{503, 200}, 3, 503, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, calls := statusServer(tt.statuses...)
+			defer srv.Close()
+
+			got, err := send(t, context.Background(), tt.method, srv.URL, app.Resilience{MaxRetries: tt.retries, BaseDelay: time.Millisecond})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got != tt.want || atomic.LoadInt32(calls) != tt.calls {
+				t.Fatalf("got status %d after %d calls, want %d after %d", got, atomic.LoadInt32(calls), tt.want, tt.calls)
+			}
+		})
+	}
+}
+
+func TestSendIdempotencyKey(t *testing.T) {
+	var keys []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		keys = append(keys, r.Header.Get("Idempotency-Key"))
+		if len(keys) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer srv.Close()
+
+	if _, err := send(t, context.Background(), "POST", srv.URL, app.Resilience{MaxRetries: 1}); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(keys) != 2 || keys[0] == "" || keys[0] != keys[1] {
+		t.Fatalf("expected the same key on both attempts, got %q", keys)
+	}
+}
+
+func TestSendCanceledByCaller(t *testing.T) {
+	release := make(chan struct{})
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		<-release
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	policy := app.Resilience{MaxRetries: 3, BreakerThreshold: 1, BreakerCooldown: time.Hour}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	if _, err := send(t, ctx, "GET", srv.URL, policy); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected the deadline, got %v", err)
+	}
+
+	if atomic.LoadInt32(&calls) != 1 {
+		t.Fatalf("a canceled request must not be retried, got %d calls", atomic.LoadInt32(&calls))
+	}
+
+	if !circuit(httptest.NewRequest("GET", srv.URL, nil), policy).allow() {
+		t.Fatal("a canceled request must not open the circuit")
+	}
+}
+
+func TestBreaker(t *testing.T) {
+	srv, calls := statusServer(503, 503, 429, 200)
+	defer srv.Close()
+
+	policy := app.Resilience{BreakerThreshold: 2, BreakerCooldown: time.Hour}
+	for i := 0; i < 2; i++ {
+		if status, err := send(t, context.Background(), "GET", srv.URL, policy); err != nil || status != 503 {
+			t.Fatal(status, err)
+		}
+	}
+
+	_, err := send(t, context.Background(), "GET", srv.URL, policy)
+	if !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("expected an open circuit, got %v", err)
+	}
+
+	if atomic.LoadInt32(calls) != 2 {
+		t.Fatalf("an open circuit must not contact the server, got %d calls", atomic.LoadInt32(calls))
+	}
+
+	// another policy has its own breaker, whose 429 is no failure
+	other := app.Resilience{BreakerThreshold: 1, BreakerCooldown: time.Hour}
+	for _, want := range []int{429, 200} {
+		if status, err := send(t, context.Background(), "GET", srv.URL, other); err != nil || status != want {
+			t.Fatal(status, err)
+		}
+	}
+}
+
+func TestBreakerTrial(t *testing.T) {
+	b := &breaker{threshold: 1, cooldown: time.Millisecond}
+	b.done(false)
+	if b.allow() {
+		t.Fatal("expected an open circuit")
+	}
+
+	time.Sleep(2 * time.Millisecond)
+	if !b.allow() {
+		t.Fatal("expected a trial after the cooldown")
+	}
+
+	if b.allow() {
+		t.Fatal("expected a single trial")
+	}
+
+	b.done(true)
+	if !b.allow() || !b.allow() {
+		t.Fatal("expected a closed circuit")
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	policy := app.Resilience{BaseDelay: 10 * time.Millisecond, MaxDelay: 50 * time.Millisecond}
+	for attempt := 0; attempt < 70; attempt++ {
+		if d := backoff(policy, attempt); d < 0 || d > policy.MaxDelay {
+			t.Fatalf("attempt %d: delay %v exceeds the limit", attempt, d)
+		}
+	}
+
+	if d := backoff(app.Resilience{}, 3); d != 0 {
+		t.Fatalf("expected no delay, got %v", d)
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	tests := []struct {
+		header string
+		want   time.Duration
+		ok     bool
+	}{
+		{"", 0, false},
+		{"3", 3 * time.Second, true},
+		{"-1", 0, false},
+		{"soon", 0, false},
+		{time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat), 0, true},
+	}
+
+	for _, tt := range tests {
+		res := &http.Response{Header: http.Header{}}
+		if tt.header != "" {
+			res.Header.Set("Retry-After", tt.header)
+		}
+
+		got, ok := retryAfter(res)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("%q: got %v %v, want %v %v", tt.header, got, ok, tt.want, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package http
+
+import (
+	"github.com/gotrino/fusion/spec/app"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/textproto"
+	"strings"
+)
+
+// WithProgress reports each read to the progress, if not nil.
+func WithProgress(r io.Reader, total int64, progress app.Progress) io.Reader {
+	if progress == nil {
+		return r
+	}
+
+	return &progressReader{r: r, total: total, progress: progress}
+}
+
+type progressReader struct {
+	r        io.Reader
+	total    int64
+	n        int64
+	progress app.Progress
+}
+
+func (p *progressReader) Read(buf []byte) (int, error) {
+	n, err := p.r.Read(buf)
+	if n > 0 {
+		p.n += int64(n)
+		p.progress(p.n, p.total)
+	}
+
+	return n, err
+}
+
+// Multipart streams the file as the named field of a multipart/form-data body and returns it with its content
+// type. The Content of the file is closed when the body has been written.
+func Multipart(field string, f app.File) (io.ReadCloser, string) {
+	pr, pw := io.Pipe()
+	w := multipart.NewWriter(pw)
+
+	go func() {
+		defer f.Content.Close()
+
+		h := textproto.MIMEHeader{}
+		h.Set("Content-Disposition", mime.FormatMediaType("form-data", map[string]string{"name": field, "filename": f.Name}))
+		contentType := f.ContentType
+		if contentType == "" {
+			contentType = "application/octet-stream"
+		}
+
+		h.Set("Content-Type", contentType)
+		part, err := w.CreatePart(h)
+		if err == nil {
+			_, err = io.Copy(part, f.Content)
+		}
+
+		if err == nil {
+			err = w.Close()
+		}
+
+		pw.CloseWithError(err)
+	}()
+
+	return pr, w.FormDataContentType()
+}
+
+// ContentDisposition returns the header value to transfer a file with the given name.
+func ContentDisposition(name string) string {
+	if name == "" {
+		return "attachment"
+	}
+
+	return mime.FormatMediaType("attachment", map[string]string{"filename": name})
+}
+
+// FileName returns the file name of a Content-Disposition header, supporting the extended filename* notation.
+func FileName(contentDisposition string) string {
+	_, params, err := mime.ParseMediaType(contentDisposition)
+	if err != nil {
+		return ""
+	}
+
+	name := params["filename"]
+	// never trust a path from the server
+	if i := strings.LastIndexAny(name, `/\`); i >= 0 {
+		name = name[i+1:]
+	}
+
+	return name
+}
+
+// ReadFile wraps the body of a download response into a File.
+func ReadFile(res *Response, progress app.Progress) app.File {
+	size := res.ContentLength
+	return app.File{
+		Name:        FileName(res.Header.Get("Content-Disposition")),
+		ContentType: res.Header.Get("Content-Type"),
+		Size:        size,
+		Content:     readCloser{Reader: WithProgress(res.Body, size, progress), Closer: res.Body},
+	}
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
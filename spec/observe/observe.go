@@ -0,0 +1,161 @@
+// Package observe provides hooks to trace and log requests, repository operations, navigation and context lookups
+// without patching the library. Install an Observer once at startup using Set.
+package observe
+
+import (
+	"context"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// Operation describes a repository operation, like a List performed by a table.
+type Operation struct {
+	Repository string // Repository is the type of the repository implementation, like rest.RESTRepo[main.Book].
+	Name       string // Name is one of list, load, save, delete, saveAll or deleteAll.
+	ID         string // ID is the entity id of load, save and delete.
+}
+
+// Observer is notified by the runtimes and repositories. The start notifications return the context which is
+// passed to the according end notification, so that spans can be propagated. Implementations must be safe for
+// concurrent use, should return quickly and must not call app.FromContext or app.Lookup, which are observed
+// themselves. Embed Nop to implement only a subset.
+type Observer interface {
+	RequestStart(ctx context.Context, req *http.Request) context.Context
+	// RequestEnd is called for each attempt. Either res or err is nil.
+	RequestEnd(ctx context.Context, req *http.Request, res *http.Response, err error, elapsed time.Duration)
+	OperationStart(ctx context.Context, op Operation) context.Context
+	OperationEnd(ctx context.Context, op Operation, err error, elapsed time.Duration)
+	// Navigate is called with the app.ActivityComposer to navigate to.
+	Navigate(ctx context.Context, target any)
+	ContextLookup(ctx context.Context, key string, found bool)
+}
+
+// Nop ignores all notifications.
+type Nop struct{}
+
+func (Nop) RequestStart(ctx context.Context, req *http.Request) context.Context {
+	return ctx
+}
+
+func (Nop) RequestEnd(ctx context.Context, req *http.Request, res *http.Response, err error, elapsed time.Duration) {
+}
+
+func (Nop) OperationStart(ctx context.Context, op Operation) context.Context {
+	return ctx
+}
+
+func (Nop) OperationEnd(ctx context.Context, op Operation, err error, elapsed time.Duration) {
+}
+
+func (Nop) Navigate(ctx context.Context, target any) {
+}
+
+func (Nop) ContextLookup(ctx context.Context, key string, found bool) {
+}
+
+type holder struct {
+	Observer
+}
+
+var current atomic.Value
+
+func init() {
+	current.Store(holder{Nop{}})
+}
+
+// Set installs the observer. Nil restores the default, which ignores all notifications.
+func Set(o Observer) {
+	if o == nil {
+		o = Nop{}
+	}
+
+	current.Store(holder{o})
+}
+
+// Get returns the installed observer.
+func Get() Observer {
+	return current.Load().(holder).Observer
+}
+
+// StartRequest notifies about the request and returns it bound to the observed context together with the function
+// to call when the response has been received.
+func StartRequest(req *http.Request) (*http.Request, func(res *http.Response, err error)) {
+	o := Get()
+	if _, ok := o.(Nop); ok {
+		return req, func(*http.Response, error) {}
+	}
+
+	start := time.Now()
+	ctx := o.RequestStart(req.Context(), req)
+	if ctx != req.Context() {
+		req = req.WithContext(ctx)
+	}
+
+	return req, func(res *http.Response, err error) {
+		o.RequestEnd(ctx, req, res, err, time.Since(start))
+	}
+}
+
+// StartOperation notifies about the operation and returns the observed context together with the function to call
+// when the operation has finished.
+func StartOperation(ctx context.Context, op Operation) (context.Context, func(err error)) {
+	o := Get()
+	if _, ok := o.(Nop); ok {
+		return ctx, func(error) {}
+	}
+
+	start := time.Now()
+	ctx = o.OperationStart(ctx, op)
+
+	return ctx, func(err error) {
+		o.OperationEnd(ctx, op, err, time.Since(start))
+	}
+}
+
+// Multi notifies all given observers in order.
+func Multi(observers ...Observer) Observer {
+	return multi(observers)
+}
+
+type multi []Observer
+
+func (m multi) RequestStart(ctx context.Context, req *http.Request) context.Context {
+	for _, o := range m {
+		ctx = o.RequestStart(ctx, req)
+	}
+
+	return ctx
+}
+
+func (m multi) RequestEnd(ctx context.Context, req *http.Request, res *http.Response, err error, elapsed time.Duration) {
+	for _, o := range m {
+		o.RequestEnd(ctx, req, res, err, elapsed)
+	}
+}
+
+func (m multi) OperationStart(ctx context.Context, op Operation) context.Context {
+	for _, o := range m {
+		ctx = o.OperationStart(ctx, op)
+	}
+
+	return ctx
+}
+
+func (m multi) OperationEnd(ctx context.Context, op Operation, err error, elapsed time.Duration) {
+	for _, o := range m {
+		o.OperationEnd(ctx, op, err, elapsed)
+	}
+}
+
+func (m multi) Navigate(ctx context.Context, target any) {
+	for _, o := range m {
+		o.Navigate(ctx, target)
+	}
+}
+
+func (m multi) ContextLookup(ctx context.Context, key string, found bool) {
+	for _, o := range m {
+		o.ContextLookup(ctx, key, found)
+	}
+}
@@ -0,0 +1,104 @@
+package observe
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Redacted replaces the values of sensitive headers.
+const Redacted = "REDACTED"
+
+// SensitiveHeaders are redacted by Redact. May be extended at startup, e.g. by custom api key headers.
+var SensitiveHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie", "X-Api-Key"}
+
+// Redact returns a copy of the header whose sensitive values are replaced, so that it can be logged safely.
+func Redact(h http.Header) http.Header {
+	res := h.Clone()
+	for _, name := range SensitiveHeaders {
+		if _, ok := res[http.CanonicalHeaderKey(name)]; ok {
+			res.Set(name, Redacted)
+		}
+	}
+
+	return res
+}
+
+// SensitiveQueryParams are redacted by RedactURL, like the token of a websocket url or a signed download link.
+// The names are compared case-insensitively. May be extended at startup.
+var SensitiveQueryParams = []string{"access_token", "refresh_token", "id_token", "token", "api_key", "apikey", "client_secret", "password", "signature", "sig"}
+
+// RedactURL returns the url without the password of the user info and with the values of sensitive query
+// parameters replaced.
+func RedactURL(u *url.URL) string {
+	if u == nil {
+		return ""
+	}
+
+	redacted := *u
+	if u.RawQuery != "" {
+		query := u.Query()
+		changed := false
+		for key := range query {
+			for _, name := range SensitiveQueryParams {
+				if strings.EqualFold(key, name) {
+					query[key] = []string{Redacted}
+					changed = true
+				}
+			}
+		}
+
+		if changed {
+			redacted.RawQuery = query.Encode()
+		}
+	}
+
+	return redacted.Redacted()
+}
+
+// redactError returns the error with the urls in its message redacted, like those of a *url.Error, which the
+// http.Client returns for transport failures. Errors without a sensitive url are returned as is.
+func redactError(err error, u *url.URL) error {
+	if err == nil {
+		return nil
+	}
+
+	msg := err.Error()
+	replace := func(raw string, u *url.URL) {
+		if redacted := RedactURL(u); raw != "" && raw != redacted {
+			msg = strings.ReplaceAll(msg, raw, redacted)
+		}
+	}
+
+	if u != nil {
+		replace(u.String(), u)
+	}
+
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		if parsed, perr := url.Parse(urlErr.URL); perr == nil {
+			replace(urlErr.URL, parsed)
+		}
+	}
+
+	if msg == err.Error() {
+		return err
+	}
+
+	return redactedError{err: err, msg: msg}
+}
+
+// redactedError keeps the original error for errors.Is and errors.As, but hides it from the message.
+type redactedError struct {
+	err error
+	msg string
+}
+
+func (e redactedError) Error() string {
+	return e.msg
+}
+
+func (e redactedError) Unwrap() error {
+	return e.err
+}
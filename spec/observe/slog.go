@@ -0,0 +1,90 @@
+package observe
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// Slog returns an Observer which logs to the given logger. Finished requests and operations are logged at debug
+// level or at warn level, if they have failed or took longer than slow. Headers, urls and errors are logged
+// redacted, see Redact and RedactURL.
+func Slog(logger *slog.Logger, slow time.Duration) Observer {
+	if logger == nil {
+		logger = slog.Default()
+	}
+
+	return slogObserver{logger: logger, slow: slow}
+}
+
+type slogObserver struct {
+	logger *slog.Logger
+	slow   time.Duration
+}
+
+func (o slogObserver) level(err error, elapsed time.Duration) slog.Level {
+	if err != nil || (o.slow > 0 && elapsed >= o.slow) {
+		return slog.LevelWarn
+	}
+
+	return slog.LevelDebug
+}
+
+func (o slogObserver) RequestStart(ctx context.Context, req *http.Request) context.Context {
+	return ctx
+}
+
+func (o slogObserver) RequestEnd(ctx context.Context, req *http.Request, res *http.Response, err error, elapsed time.Duration) {
+	attrs := []slog.Attr{
+		slog.String("method", req.Method),
+		slog.String("url", RedactURL(req.URL)),
+		slog.Duration("elapsed", elapsed),
+		slog.Any("header", Redact(req.Header)),
+	}
+
+	if res != nil {
+		attrs = append(attrs, slog.Int("status", res.StatusCode))
+	}
+
+	if err != nil {
+		attrs = append(attrs, slog.String("error", redactError(err, req.URL).Error()))
+	}
+
+	o.logger.LogAttrs(ctx, o.level(err, elapsed), "http request", attrs...)
+}
+
+func (o slogObserver) OperationStart(ctx context.Context, op Operation) context.Context {
+	return ctx
+}
+
+func (o slogObserver) OperationEnd(ctx context.Context, op Operation, err error, elapsed time.Duration) {
+	attrs := []slog.Attr{
+		slog.String("repository", op.Repository),
+		slog.String("operation", op.Name),
+		slog.Duration("elapsed", elapsed),
+	}
+
+	if op.ID != "" {
+		attrs = append(attrs, slog.String("id", op.ID))
+	}
+
+	if err != nil {
+		attrs = append(attrs, slog.String("error", err.Error()))
+	}
+
+	o.logger.LogAttrs(ctx, o.level(err, elapsed), "repository operation", attrs...)
+}
+
+func (o slogObserver) Navigate(ctx context.Context, target any) {
+	o.logger.LogAttrs(ctx, slog.LevelInfo, "navigate", slog.String("target", fmt.Sprintf("%T", target)))
+}
+
+func (o slogObserver) ContextLookup(ctx context.Context, key string, found bool) {
+	if !o.logger.Enabled(ctx, slog.LevelDebug) {
+		return
+	}
+
+	o.logger.LogAttrs(ctx, slog.LevelDebug, "context lookup", slog.String("key", key), slog.Bool("found", found))
+}
@@ -0,0 +1,85 @@
+package observe
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// Attr is a key value pair of a Span.
+type Attr struct {
+	Key   string
+	Value any
+}
+
+// Span is a single traced unit of work.
+type Span interface {
+	SetAttributes(attrs ...Attr)
+	// End finishes the span and records the error, if not nil.
+	End(err error)
+}
+
+// Tracer starts spans. It maps directly onto an OpenTelemetry trace.Tracer, e.g.:
+//
+//	func (t otelTracer) Start(ctx context.Context, name string, attrs ...observe.Attr) (context.Context, observe.Span) {
+//		ctx, span := t.tracer.Start(ctx, name, trace.WithAttributes(convert(attrs)...))
+//		return ctx, otelSpan{span}
+//	}
+type Tracer interface {
+	Start(ctx context.Context, name string, attrs ...Attr) (context.Context, Span)
+}
+
+type spanKey struct{}
+
+// Traced returns an Observer which starts a span for each request and repository operation. Requests made by an
+// operation become child spans, if the tracer propagates them through the context.
+func Traced(t Tracer) Observer {
+	return tracing{t}
+}
+
+type tracing struct {
+	tracer Tracer
+}
+
+func (t tracing) RequestStart(ctx context.Context, req *http.Request) context.Context {
+	ctx, span := t.tracer.Start(ctx, "HTTP "+req.Method,
+		Attr{"http.request.method", req.Method},
+		Attr{"url.full", RedactURL(req.URL)},
+	)
+
+	return context.WithValue(ctx, spanKey{}, span)
+}
+
+func (t tracing) RequestEnd(ctx context.Context, req *http.Request, res *http.Response, err error, elapsed time.Duration) {
+	span, ok := ctx.Value(spanKey{}).(Span)
+	if !ok {
+		return
+	}
+
+	if res != nil {
+		span.SetAttributes(Attr{"http.response.status_code", res.StatusCode})
+	}
+
+	span.End(redactError(err, req.URL))
+}
+
+func (t tracing) OperationStart(ctx context.Context, op Operation) context.Context {
+	ctx, span := t.tracer.Start(ctx, op.Name,
+		Attr{"repository", op.Repository},
+		Attr{"entity.id", op.ID},
+	)
+
+	return context.WithValue(ctx, spanKey{}, span)
+}
+
+func (t tracing) OperationEnd(ctx context.Context, op Operation, err error, elapsed time.Duration) {
+	if span, ok := ctx.Value(spanKey{}).(Span); ok {
+		span.End(err)
+	}
+}
+
+func (t tracing) Navigate(ctx context.Context, target any) {
+}
+
+func (t tracing) ContextLookup(ctx context.Context, key string, found bool) {
+}
@@ -0,0 +1,173 @@
+package rest
+
+import (
+	"context"
+	"github.com/gotrino/fusion/runtime/rest"
+	"github.com/gotrino/fusion/spec/app"
+	"github.com/gotrino/fusion/spec/http"
+	"strings"
+)
+
+// Endpoint declares the http call of a single repository operation.
+type Endpoint struct {
+	// Method like POST overrides the default verb, which is GET for List and Load, PUT for Save and DELETE for Delete.
+	Method string
+	// Path is a template like /api/books/{id}, where id is bound to the entity id. Other placeholders are bound by
+	// Params, the Params of the Endpoints and the app.RouteParams in that order. An empty Path disables the operation.
+	Path   string
+	Params rest.Params
+	// Status lists the accepted status codes. Defaults to 200 for List and Load and to 200, 201, 202 and 204 otherwise.
+	Status []int
+	// Codec encodes the entity and decodes the response. Defaults to json.
+	Codec http.Codec
+	// MapError translates the errors of this operation, e.g. a 409 into an app.ValidationError, if not nil.
+	MapError func(err error) error
+}
+
+// Endpoints declares a repository by describing the http call of each operation, for backends which do not follow
+// the conventions of Repository. It creates a http.Repository.
+type Endpoints[T any] struct {
+	Connection string      // Connection is the name of the backend, see app.Application.Connections. Empty means default.
+	Params     rest.Params // Params binds placeholders shared by all endpoints.
+	Resilience *app.Resilience
+	List       Endpoint
+	Load       Endpoint
+	Save       Endpoint
+	Delete     Endpoint
+	Default    T
+}
+
+func (e Endpoints[T]) GetDefault() any {
+	return e.Default
+}
+
+func (Endpoints[T]) IsRepository() bool {
+	return true
+}
+
+func (e Endpoints[T]) New(ctx context.Context) app.RepositoryImplStencil {
+	return e.Repository(ctx)
+}
+
+// Repository creates the http.Repository. The given context provides the application and route params, in case
+// the operations are called without them.
+func (e Endpoints[T]) Repository(ctx context.Context) http.Repository[T] {
+	var repo http.Repository[T]
+	if e.List.Path != "" {
+		repo.OnListContext = func(opCtx context.Context) ([]T, error) {
+			var res []T
+			err := e.call(e.scope(ctx, opCtx), e.List, "GET", "", nil, &res, http.StatusOK)
+			return res, err
+		}
+	}
+
+	if e.Load.Path != "" {
+		repo.OnLoadContext = func(opCtx context.Context, id string) (T, error) {
+			var res T
+			err := e.call(e.scope(ctx, opCtx), e.Load, "GET", id, nil, &res, http.StatusOK)
+			return res, err
+		}
+	}
+
+	if e.Save.Path != "" {
+		repo.OnSaveContext = func(opCtx context.Context, t T) error {
+			id, err := rest.GetID(t)
+			if err != nil {
+				return err
+			}
+
+			return e.call(e.scope(ctx, opCtx), e.Save, "PUT", id, t, nil, http.StatusOK, http.StatusCreated, http.StatusAccepted, http.StatusNoContent)
+		}
+	}
+
+	if e.Delete.Path != "" {
+		repo.OnDeleteContext = func(opCtx context.Context, id string) error {
+			return e.call(e.scope(ctx, opCtx), e.Delete, "DELETE", id, nil, nil, http.StatusOK, http.StatusAccepted, http.StatusNoContent)
+		}
+	}
+
+	return repo
+}
+
+// scope returns the context of the operation, which keeps its cancellation and deadline. The application and the
+// route params are borrowed from the context of the declaration, if the operation does not provide them.
+func (e Endpoints[T]) scope(ctx, opCtx context.Context) context.Context {
+	if _, ok := app.Lookup[app.Application](opCtx); !ok {
+		if a, ok := app.Lookup[app.Application](ctx); ok {
+			opCtx = app.WithContext(opCtx, a)
+		}
+	}
+
+	if _, ok := app.Lookup[app.RouteParams](opCtx); !ok {
+		if route, ok := app.Lookup[app.RouteParams](ctx); ok {
+			opCtx = app.WithContext(opCtx, route)
+		}
+	}
+
+	return opCtx
+}
+
+func (e Endpoints[T]) call(ctx context.Context, ep Endpoint, method, id string, body, dst any, status ...int) error {
+	err := e.do(ctx, ep, method, id, body, dst, status)
+	if err != nil && ep.MapError != nil {
+		return ep.MapError(err)
+	}
+
+	return err
+}
+
+func (e Endpoints[T]) do(ctx context.Context, ep Endpoint, method, id string, body, dst any, status []int) error {
+	if _, err := app.FromContext[app.Application](ctx).ConnectionOf(e.Connection); err != nil {
+		return err
+	}
+
+	p, err := e.path(ctx, ep, id)
+	if err != nil {
+		return err
+	}
+
+	if ep.Method != "" {
+		method = ep.Method
+	}
+
+	if len(ep.Status) > 0 {
+		status = ep.Status
+	}
+
+	var codec http.Codec = http.JSON{}
+	if ep.Codec != nil {
+		codec = ep.Codec
+	}
+
+	params := http.Params{Accept: codec.ContentType(), Resilience: e.Resilience, Connection: e.Connection}
+	if body != nil {
+		encoded, err := http.Encode(codec, body)
+		if err != nil {
+			return err
+		}
+
+		params.ContentType, params.Body = encoded.ContentType, encoded.Body
+	}
+
+	buf, err := http.Do(ctx, method, http.URLOn(ctx, e.Connection, p), params, status...)
+	if err != nil {
+		return err
+	}
+
+	if dst == nil || len(buf) == 0 {
+		return nil
+	}
+
+	return http.Decode(codec, buf, dst)
+}
+
+func (e Endpoints[T]) path(ctx context.Context, ep Endpoint, id string) (string, error) {
+	merged := params(ctx, e.Params, ep.Params)
+
+	template := ep.Path
+	if id != "" {
+		template = strings.ReplaceAll(template, "{id}", rest.EscapeID(id))
+	}
+
+	return rest.Expand(template, merged)
+}
@@ -0,0 +1,62 @@
+package rest_test
+
+import (
+	"context"
+	"errors"
+	"github.com/gotrino/fusion/runtime/rest/resttest"
+	http2 "github.com/gotrino/fusion/spec/http"
+	"github.com/gotrino/fusion/spec/rest"
+	"testing"
+)
+
+type book struct {
+	ID    string `json:"id"`
+	Title string `json:"title"`
+	Notes any    `json:"notes,omitempty"`
+}
+
+func endpoints() rest.Endpoints[book] {
+	return rest.Endpoints[book]{
+		Load:   rest.Endpoint{Path: "/api/books/{id}"},
+		Save:   rest.Endpoint{Path: "/api/books/{id}"},
+		Delete: rest.Endpoint{Path: "/api/books/{id}"},
+	}
+}
+
+func TestEndpointsBorrowApplication(t *testing.T) {
+	srv := resttest.NewServer(rest.Repository[book]{Path: "/api/books"}, book{ID: "a/b", Title: "Dune"})
+	defer srv.Close()
+
+	repo := endpoints().Repository(srv.Context(context.Background(), "secret"))
+	res, err := repo.LoadContext(context.Background(), "a/b")
+	if err != nil || res.(book).Title != "Dune" {
+		t.Fatal(res, err)
+	}
+
+	if got := srv.Requests()[0].Header.Get("Authorization"); got != "Bearer secret" {
+		t.Fatalf("expected the application of the declaration, got %q", got)
+	}
+
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := repo.LoadContext(canceled, "a/b"); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected the operation to keep its cancellation, got %v", err)
+	}
+}
+
+func TestEndpointsEncoderError(t *testing.T) {
+	srv := resttest.NewServer(rest.Repository[book]{Path: "/api/books"})
+	defer srv.Close()
+
+	repo := endpoints().Repository(srv.Context(context.Background(), ""))
+	err := repo.SaveContext(context.Background(), book{ID: "1", Notes: make(chan int)})
+	var httpErr http2.HttpError
+	if !errors.As(err, &httpErr) || httpErr.Status != http2.EncoderError {
+		t.Fatalf("expected an encoder error, got %v", err)
+	}
+
+	var nested http2.HttpError
+	if errors.As(httpErr.Cause, &nested) {
+		t.Fatalf("expected a single HttpError, got %v", err)
+	}
+}
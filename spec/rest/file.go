@@ -0,0 +1,27 @@
+package rest
+
+import (
+	"context"
+	"github.com/gotrino/fusion/runtime/rest"
+	"github.com/gotrino/fusion/spec/app"
+)
+
+// File declares a repository which keeps its entities in a local json file or directory, e.g. for small admin
+// tools which only edit configuration files.
+type File[T any] struct {
+	Path    string          // Path of the file or directory.
+	Layout  rest.FileLayout // Layout defaults to a single json array.
+	Default T
+}
+
+func (r File[T]) GetDefault() any {
+	return r.Default
+}
+
+func (File[T]) IsRepository() bool {
+	return true
+}
+
+func (r File[T]) New(ctx context.Context) app.RepositoryImplStencil {
+	return rest.File[T](r.Path, r.Layout).ToStencil()
+}
@@ -0,0 +1,32 @@
+package rest
+
+import (
+	"context"
+	"github.com/gotrino/fusion/runtime/rest"
+	"github.com/gotrino/fusion/spec/app"
+)
+
+// GraphQL declares a repository whose operations are GraphQL queries and mutations against a single endpoint.
+type GraphQL[T any] struct {
+	Path       string              // the endpoint path like /graphql
+	Collection string              // Collection is the root field of the list query, like books.
+	Entity     string              // Entity is the root field of the load query and the suffix of the mutations.
+	Queries    rest.GraphQLQueries // Queries overrides the derived documents.
+	Fields     []string            // Fields is the default selection set. Defaults to the json field names of T.
+	Default    T
+}
+
+func (r GraphQL[T]) GetDefault() any {
+	return r.Default
+}
+
+func (GraphQL[T]) IsRepository() bool {
+	return true
+}
+
+func (r GraphQL[T]) New(ctx context.Context) app.RepositoryImplStencil {
+	repo := rest.GraphQL[T](ctx, r.Path, r.Collection, r.Entity)
+	repo.Queries = r.Queries
+	repo.Fields = r.Fields
+	return repo.ToStencil()
+}
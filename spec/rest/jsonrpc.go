@@ -0,0 +1,31 @@
+package rest
+
+import (
+	"context"
+	"github.com/gotrino/fusion/runtime/rest"
+	"github.com/gotrino/fusion/spec/app"
+)
+
+// JSONRPC declares a repository whose operations are JSON-RPC 2.0 calls against a single endpoint.
+type JSONRPC[T any] struct {
+	Path     string          // the endpoint path like /rpc
+	Methods  rest.RPCMethods // Methods declares the method names, like books.list
+	Named    bool            // Named passes parameters by name instead of by position.
+	Statuses map[int]int     // Statuses maps server defined error codes onto http status codes.
+	Default  T
+}
+
+func (r JSONRPC[T]) GetDefault() any {
+	return r.Default
+}
+
+func (JSONRPC[T]) IsRepository() bool {
+	return true
+}
+
+func (r JSONRPC[T]) New(ctx context.Context) app.RepositoryImplStencil {
+	repo := rest.JSONRPC[T](ctx, r.Path, r.Methods)
+	repo.Named = r.Named
+	repo.Statuses = r.Statuses
+	return repo.ToStencil()
+}
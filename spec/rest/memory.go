@@ -0,0 +1,32 @@
+package rest
+
+import (
+	"context"
+	"github.com/gotrino/fusion/runtime/rest"
+	"github.com/gotrino/fusion/spec/app"
+)
+
+// Memory declares a repository which is backed by the given in-memory store, e.g. to prototype screens before
+// the backend exists. The store is shared across all renderings, so changes are kept.
+type Memory[T any] struct {
+	// Store keeps the entities. If nil, all declarations of the same entity type share a store, see
+	// rest.SharedMemory.
+	Store   *rest.MemoryRepo[T]
+	Default T
+}
+
+func (r Memory[T]) GetDefault() any {
+	return r.Default
+}
+
+func (Memory[T]) IsRepository() bool {
+	return true
+}
+
+func (r Memory[T]) New(ctx context.Context) app.RepositoryImplStencil {
+	if r.Store == nil {
+		return rest.SharedMemory[T]("").ToStencil()
+	}
+
+	return r.Store.ToStencil()
+}
@@ -4,11 +4,32 @@ import (
 	"context"
 	"github.com/gotrino/fusion/runtime/rest"
 	"github.com/gotrino/fusion/spec/app"
+	"github.com/gotrino/fusion/spec/http"
+	"time"
 )
 
 type Repository[T any] struct {
-	Path    string // the resource path like /api/v1/books
-	Default T
+	Path       string      // the resource path like /api/v1/books or a template like /api/v1/authors/{authorID}/books
+	Connection string      // Connection is the name of the backend, see app.Application.Connections. Empty means default.
+	Params     rest.Params // Params binds the placeholders of Path. Unbound ones are taken from the app.RouteParams.
+	Default    T
+	Resilience *app.Resilience // Resilience overrides the policy of the applications Connection, if not nil.
+	// Cache enables a shared in-memory cache and conditional GET requests for this resource, if not nil.
+	Cache *rest.CacheOptions
+	// Timeout is the deadline of each single repository operation. Zero means no timeout.
+	Timeout time.Duration
+	// Codecs declares the supported encodings in order of preference. Defaults to json.
+	Codecs []http.Codec
+	// Events declares the change stream, which allows tables and forms to update live.
+	Events rest.WatchOptions
+	// Content declares the binary content of the entities, which forms and tables transfer as files.
+	Content rest.ContentOptions
+	// BulkPath is the path relative to Path, which saves and deletes many entities with a single request, like
+	// /batch. Empty means that batches are processed by concurrent requests, see rest.RESTRepo.BulkPath.
+	BulkPath string
+	// Offline keeps the last results and queues mutations while the Connection is unreachable, if not nil. The
+	// queue is replayed in the background until the context of New is done.
+	Offline *rest.OfflineOptions[T]
 }
 
 func (r Repository[T]) GetDefault() any {
@@ -20,5 +41,60 @@ func (Repository[T]) IsRepository() bool {
 }
 
 func (r Repository[T]) New(ctx context.Context) app.RepositoryImplStencil {
-	return rest.REST[T](ctx, r.Path).ToStencil()
+	repo := r.rest(ctx)
+	key := r.Path // an unbound placeholder fails each operation anyway
+	if u, err := repo.URL(); err == nil {
+		key = u.String()
+	}
+	var impl rest.Repository[T] = repo
+	if r.Cache != nil {
+		repo.ETags = rest.SharedETags(key)
+		impl = rest.Cached[T](repo, rest.SharedCache(key, *r.Cache))
+	}
+
+	if r.Offline != nil {
+		store, err := rest.SharedOfflineStore[T](key, *r.Offline)
+		if err != nil {
+			panic(err)
+		}
+
+		offline := rest.Offline[T](impl, store)
+		offline.Probe(ctx, r.Offline.SyncInterval)
+		return offline.ToStencil()
+	}
+
+	return rest.Stencil[T](impl)
+}
+
+func (r Repository[T]) rest(ctx context.Context) rest.RESTRepo[T] {
+	repo := rest.RESTOn[T](ctx, r.Connection, r.Path)
+	repo.PathParams = params(ctx, r.Params)
+	repo.Timeout = r.Timeout
+	repo.Codecs = r.Codecs
+	repo.Events = r.Events
+	repo.Content = r.Content
+	repo.BulkPath = r.BulkPath
+	if r.Resilience != nil {
+		repo.Resilience = *r.Resilience
+	}
+
+	return repo
+}
+
+// params merges the route params of the context and the given params, where later ones take precedence.
+func params(ctx context.Context, declared ...rest.Params) rest.Params {
+	merged := rest.Params{}
+	if route, ok := app.Lookup[app.RouteParams](ctx); ok {
+		for k, v := range route {
+			merged[k] = v
+		}
+	}
+
+	for _, params := range declared {
+		for k, v := range params {
+			merged[k] = v
+		}
+	}
+
+	return merged
 }
@@ -0,0 +1,113 @@
+package rest_test
+
+import (
+	"context"
+	"errors"
+	"github.com/gotrino/fusion/runtime/rest/resttest"
+	"github.com/gotrino/fusion/spec/app"
+	"github.com/gotrino/fusion/spec/rest"
+	"io/fs"
+	"path/filepath"
+	"testing"
+)
+
+// namedContext returns the context of the server, whose books Connection uses the given authentication.
+func namedContext(srv *resttest.Server[book], auth app.Authentication) context.Context {
+	a := app.FromContext[app.Application](srv.Context(context.Background(), "application"))
+	named := a.Connections["books"]
+	named.Authentication = auth
+	a.Connections["books"] = named
+
+	return app.WithContext(context.Background(), a)
+}
+
+func TestNamedConnections(t *testing.T) {
+	tests := []struct {
+		name string
+		auth app.Authentication
+		want string
+	}{
+		{"own authentication", app.HardcodedBearer{Token: "books"}, "Bearer books"},
+		{"application authentication", nil, "Bearer application"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := resttest.NewServer(rest.Repository[book]{Path: "/api/books", Connection: "books"}, book{ID: "1", Title: "Dune"})
+			defer srv.Close()
+
+			ctx := namedContext(srv, tt.auth)
+			list, err := rest.Repository[book]{Path: "/api/books", Connection: "books"}.New(ctx).List()
+			if err != nil || len(list) != 1 {
+				t.Fatal(list, err)
+			}
+
+			if res, err := endpoints().Repository(ctx).Load("1"); err == nil {
+				t.Fatalf("expected the endpoints of the default connection to fail, got %v", res)
+			}
+
+			named := endpoints()
+			named.Connection = "books"
+			if res, err := named.Repository(ctx).Load("1"); err != nil || res.(book).Title != "Dune" {
+				t.Fatal(res, err)
+			}
+
+			for _, req := range srv.Requests() {
+				if got := req.Header.Get("Authorization"); got != tt.want {
+					t.Fatalf("expected %q, got %q", tt.want, got)
+				}
+			}
+		})
+	}
+}
+
+func TestUnknownConnection(t *testing.T) {
+	srv := resttest.NewServer(rest.Repository[book]{Path: "/api/books"})
+	defer srv.Close()
+
+	ctx := srv.Context(context.Background(), "")
+	impl := rest.Repository[book]{Path: "/api/books", Connection: "typo"}.New(ctx)
+	if _, err := impl.List(); !errors.Is(err, app.ErrUnknownConnection) {
+		t.Fatalf("expected an unknown connection, got %v", err)
+	}
+
+	if err := impl.Save(book{ID: "1"}); !errors.Is(err, app.ErrUnknownConnection) {
+		t.Fatalf("expected an unknown connection, got %v", err)
+	}
+
+	named := endpoints()
+	named.Connection = "typo"
+	if _, err := named.Repository(ctx).Load("1"); !errors.Is(err, app.ErrUnknownConnection) {
+		t.Fatalf("expected an unknown connection, got %v", err)
+	}
+
+	if len(srv.Requests()) != 0 {
+		t.Fatal("expected no requests")
+	}
+}
+
+func TestInvalidConnection(t *testing.T) {
+	srv := resttest.NewServer(rest.Repository[book]{Path: "/api/books", Connection: "broken"})
+	defer srv.Close()
+
+	myApp := app.FromContext[app.Application](srv.Context(context.Background(), ""))
+	broken := myApp.Connections["broken"]
+	broken.TLS = app.TLS{RootCAFile: filepath.Join(t.TempDir(), "missing.pem")}
+	myApp.Connections["broken"] = broken
+	ctx := app.WithContext(context.Background(), myApp)
+
+	impl := rest.Repository[book]{Path: "/api/books", Connection: "broken"}.New(ctx)
+	if _, err := impl.List(); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("expected the invalid configuration, got %v", err)
+	}
+
+	named := endpoints()
+	named.Connection = "broken"
+	if _, err := named.Repository(ctx).Load("1"); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("expected the invalid configuration, got %v", err)
+	}
+
+	if len(srv.Requests()) != 0 {
+		t.Fatal("expected no requests")
+	}
+}
@@ -0,0 +1,33 @@
+package rest
+
+import (
+	"context"
+	"github.com/gotrino/fusion/runtime/rest"
+	"github.com/gotrino/fusion/spec/app"
+	"github.com/gotrino/fusion/spec/http"
+	"time"
+)
+
+// Resource declares a singleton resource without an id, like /api/settings or /api/me.
+type Resource[T any] struct {
+	Path       string      // the resource path like /api/v1/settings or a template like /api/v1/authors/{authorID}/profile
+	Connection string      // Connection is the name of the backend, see app.Application.Connections. Empty means default.
+	Params     rest.Params // Params binds the placeholders of Path. Unbound ones are taken from the app.RouteParams.
+	Default    T
+	Resilience *app.Resilience // Resilience overrides the policy of the applications Connection, if not nil.
+	Timeout    time.Duration   // Timeout is the deadline of each single operation. Zero means no timeout.
+	Codecs     []http.Codec    // Codecs declares the supported encodings in order of preference. Defaults to json.
+}
+
+func (r Resource[T]) GetDefault() any {
+	return r.Default
+}
+
+func (Resource[T]) IsResource() bool {
+	return true
+}
+
+func (r Resource[T]) New(ctx context.Context) app.ResourceImplStencil {
+	repo := Repository[T]{Path: r.Path, Connection: r.Connection, Params: r.Params, Resilience: r.Resilience, Timeout: r.Timeout, Codecs: r.Codecs}.rest(ctx)
+	return rest.RESTResourceRepo[T]{Repo: repo}.ToStencil()
+}
@@ -0,0 +1,123 @@
+package rest_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	rest2 "github.com/gotrino/fusion/runtime/rest"
+	"github.com/gotrino/fusion/spec/app"
+	"github.com/gotrino/fusion/spec/rest"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+type profile struct {
+	Name string `json:"name"`
+}
+
+// profileServer answers each GET with the profile and records the path and the Authorization header.
+func profileServer(t *testing.T, delay time.Duration) (*httptest.Server, func() []string) {
+	var lock sync.Mutex
+	var requests []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		requests = append(requests, r.URL.Path+" "+r.Header.Get("Authorization"))
+		lock.Unlock()
+
+		select {
+		case <-time.After(delay):
+		case <-r.Context().Done():
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(profile{Name: "Frank"}); err != nil {
+			t.Error(err)
+		}
+	}))
+
+	return srv, func() []string {
+		lock.Lock()
+		defer lock.Unlock()
+
+		return append([]string{}, requests...)
+	}
+}
+
+func TestResourceNew(t *testing.T) {
+	srv, requests := profileServer(t, 0)
+	defer srv.Close()
+
+	c, err := app.ParseConnection(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	named := c
+	named.BasePath = "/backend"
+	named.Authentication = app.HardcodedBearer{Token: "profiles"}
+	ctx := app.WithContext(context.Background(), app.Application{
+		Authentication: app.HardcodedBearer{Token: "application"},
+		Connection:     c,
+		Connections:    map[string]app.Connection{"profiles": named},
+	})
+	ctx = app.WithContext(ctx, app.RouteParams{"author": "route", "section": "profile"})
+
+	tests := []struct {
+		name     string
+		resource rest.Resource[profile]
+		want     string
+	}{
+		{"route params", rest.Resource[profile]{Path: "/api/authors/{author}/{section}"}, "/api/authors/route/profile Bearer application"},
+		{"declared params", rest.Resource[profile]{Path: "/api/authors/{author}/{section}", Params: rest2.Params{"author": "frank herbert"}}, "/api/authors/frank herbert/profile Bearer application"},
+		{"named connection", rest.Resource[profile]{Path: "/api/me", Connection: "profiles"}, "/backend/api/me Bearer profiles"},
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := tt.resource.New(ctx).Load()
+			if err != nil || res.(profile).Name != "Frank" {
+				t.Fatal(res, err)
+			}
+
+			if got := requests(); len(got) != i+1 || got[i] != tt.want {
+				t.Fatalf("expected %q, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestResourceNewErrors(t *testing.T) {
+	srv, requests := profileServer(t, time.Hour)
+	defer srv.Close()
+
+	c, err := app.ParseConnection(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := app.WithContext(context.Background(), app.Application{Connection: c})
+	if _, err := (rest.Resource[profile]{Path: "/api/me", Connection: "typo"}).New(ctx).Load(); !errors.Is(err, app.ErrUnknownConnection) {
+		t.Fatalf("expected an unknown connection, got %v", err)
+	}
+
+	if _, err := (rest.Resource[profile]{Path: "/api/authors/{author}"}).New(ctx).Load(); err == nil {
+		t.Fatal("expected the unbound placeholder to fail")
+	}
+
+	if len(requests()) != 0 {
+		t.Fatalf("expected no requests, got %v", requests())
+	}
+
+	slow := rest.Resource[profile]{Path: "/api/me", Timeout: 10 * time.Millisecond, Resilience: &app.Resilience{}}
+	if _, err := slow.New(ctx).Load(); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected the timeout of the declaration, got %v", err)
+	}
+
+	if got := requests(); len(got) != 1 {
+		t.Fatalf("expected a single request without retries, got %v", got)
+	}
+}
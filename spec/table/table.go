@@ -7,11 +7,18 @@ import (
 )
 
 type DataTableStencil struct {
-	Repository app.Repository
-	Deletable  bool
-	Columns    []Column
-	OnRender   func(ctx context.Context, item any, col int) Cell
-	OnClick    func(ctx context.Context, item any)
+	Repository     app.Repository
+	Deletable      bool
+	BatchDeletable bool
+	Live           bool
+	Columns        []Column
+	OnRender       func(ctx context.Context, item any, col int) Cell
+	OnClick        func(ctx context.Context, item any)
+}
+
+// Each streams the rows of the repository into f, so that runtimes can render large tables incrementally.
+func (t DataTableStencil) Each(ctx context.Context, f func(item any) error) error {
+	return app.Each(ctx, t.Repository.New(ctx), f)
 }
 
 type Cell struct {
@@ -37,17 +44,34 @@ func NewSVG(svg svg.SVG, text ...string) Cell {
 	}
 }
 
+// NewDownload creates a cell which downloads the content of the entity with the given id, using the
+// app.FileImplStencil of the table repository.
+func NewDownload(text, id string) Cell {
+	return Cell{
+		Values:     []string{text, id},
+		RenderHint: "download-2",
+	}
+}
+
 type Column struct {
 	Name   string
 	Weight int
+	// Field is the name of the entity field shown by this column. If all columns declare a field, runtimes only
+	// fetch these fields from an app.FieldSelector, so the field holding the id should be declared as well.
+	Field string
 }
 
 type DataTable[T any] struct {
 	Repository app.Repository
 	Deletable  bool
-	Columns    []Column
-	OnRender   func(ctx context.Context, item T, col int) Cell
-	OnClick    func(ctx context.Context, item T)
+	// BatchDeletable allows to select and delete multiple rows at once. Runtimes use
+	// app.BatchRepositoryImplStencil if the repository implementation supports it.
+	BatchDeletable bool
+	// Live updates the rows whenever the repository reports a change, see app.WatchableImplStencil.
+	Live     bool
+	Columns  []Column
+	OnRender func(ctx context.Context, item T, col int) Cell
+	OnClick  func(ctx context.Context, item T)
 }
 
 func (DataTable[T]) IsFragment() bool {
@@ -56,9 +80,11 @@ func (DataTable[T]) IsFragment() bool {
 
 func (t DataTable[T]) ToStencil() any {
 	return DataTableStencil{
-		Repository: t.Repository,
-		Deletable:  t.Deletable,
-		Columns:    t.Columns,
+		Repository:     t.Repository,
+		Deletable:      t.Deletable,
+		BatchDeletable: t.BatchDeletable,
+		Live:           t.Live,
+		Columns:        t.Columns,
 		OnRender: func(ctx context.Context, item any, col int) Cell {
 			if t.OnRender != nil {
 				return t.OnRender(ctx, item.(T), col)